@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	accessReason   string
+	accessDuration string
+	accessLevel    string
+	accessWait     bool
+)
+
+var requestAccessCmd = &cobra.Command{
+	Use:   "request-access <cluster>",
+	Short: "Request temporary access to a cluster",
+	Long: `Ask an approver for temporary access to a cluster you cannot see yet.
+Once approved, the cluster shows up in 'ks select' until the access expires.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		serverURL := viper.GetString("server_url")
+		if serverURL == "" || (viper.GetString("token") == "" && !usesClientCert()) {
+			fmt.Println("Not logged in. Use 'ks login'.")
+			os.Exit(1)
+		}
+
+		reason := strings.TrimSpace(accessReason)
+		if reason == "" {
+			fmt.Print("Reason: ")
+			line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+			reason = strings.TrimSpace(line)
+		}
+		if reason == "" {
+			fmt.Println("A reason is required.")
+			os.Exit(1)
+		}
+
+		body, _ := json.Marshal(map[string]string{
+			"cluster":  args[0],
+			"reason":   reason,
+			"duration": accessDuration,
+			"level":    accessLevel,
+		})
+		resp, err := authorizedRequest("POST", serverURL+"/api/access-requests", body)
+		if err != nil {
+			fmt.Println("Error connecting to server:", err)
+			os.Exit(1)
+		}
+		defer resp.Body.Close()
+
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		if resp.StatusCode != http.StatusCreated {
+			fmt.Println("Request failed:", result["error"])
+			os.Exit(1)
+		}
+
+		id := fmt.Sprint(result["id"])
+		fmt.Printf("Access request #%s for %s submitted for approval.\n", id, args[0])
+		if accessWait {
+			waitForAccessReview(serverURL, id)
+		}
+	},
+}
+
+// waitForAccessReview polls the caller's requests until the one with the
+// given ID leaves the pending state.
+func waitForAccessReview(serverURL, id string) {
+	fmt.Println("Waiting for approval (Ctrl+C to stop waiting)...")
+	for {
+		time.Sleep(5 * time.Second)
+
+		resp, err := authorizedRequest("GET", serverURL+"/api/access-requests?mine=true", nil)
+		if err != nil {
+			continue
+		}
+		var requests []map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&requests)
+		resp.Body.Close()
+
+		for _, r := range requests {
+			if fmt.Sprint(r["id"]) != id || r["status"] == "pending" {
+				continue
+			}
+			note, _ := r["review_note"].(string)
+			switch r["status"] {
+			case "approved":
+				fmt.Println("Approved. Run 'ks select' to use the cluster.")
+			default:
+				fmt.Printf("Request %s.\n", r["status"])
+			}
+			if note != "" {
+				fmt.Println("Note:", note)
+			}
+			return
+		}
+	}
+}
+
+func init() {
+	requestAccessCmd.Flags().StringVarP(&accessReason, "reason", "r", "", "Why you need access (prompted if omitted)")
+	requestAccessCmd.Flags().StringVarP(&accessDuration, "duration", "d", "1h", "How long access should last, e.g. 30m or 4h")
+	requestAccessCmd.Flags().StringVarP(&accessLevel, "level", "l", "", "Access level to request: view, edit or admin (default admin)")
+	requestAccessCmd.Flags().BoolVarP(&accessWait, "wait", "w", false, "Wait until the request is approved or denied")
+	rootCmd.AddCommand(requestAccessCmd)
+}
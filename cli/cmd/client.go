@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/spf13/viper"
+)
+
+// configureTLS sets up the shared HTTP client from client_cert, client_key and
+// ca_cert. With a client certificate the server can identify the user without
+// a password or token.
+func configureTLS() error {
+	certFile := viper.GetString("client_cert")
+	keyFile := viper.GetString("client_key")
+	caFile := viper.GetString("ca_cert")
+	if certFile == "" && keyFile == "" && caFile == "" {
+		return nil
+	}
+	if (certFile == "") != (keyFile == "") {
+		return errors.New("client_cert and client_key must be set together")
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return fmt.Errorf("loading client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("%s: no certificates found", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	http.DefaultClient.Transport = transport
+	return nil
+}
+
+// usesClientCert reports whether requests authenticate with a client
+// certificate rather than a stored token.
+func usesClientCert() bool {
+	return viper.GetString("client_cert") != ""
+}
+
+// authorizedRequest sends a request with the stored access token. If the
+// server rejects the token, it is refreshed once and the request retried.
+func authorizedRequest(method, url string, body []byte) (*http.Response, error) {
+	resp, err := sendWithToken(method, url, body, viper.GetString("token"))
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	if !refreshToken() {
+		return resp, nil
+	}
+	resp.Body.Close()
+	return sendWithToken(method, url, body, viper.GetString("token"))
+}
+
+func sendWithToken(method, url string, body []byte, token string) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// refreshToken exchanges the stored refresh token for a new token pair and
+// saves it to the config file.
+func refreshToken() bool {
+	serverURL := viper.GetString("server_url")
+	refresh := viper.GetString("refresh_token")
+	if serverURL == "" || refresh == "" {
+		return false
+	}
+
+	jsonData, _ := json.Marshal(map[string]string{"refresh_token": refresh})
+	resp, err := http.Post(serverURL+"/api/refresh", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	saveTokens(result)
+	return true
+}
+
+func saveTokens(result map[string]interface{}) {
+	token, _ := result["token"].(string)
+	refresh, _ := result["refresh_token"].(string)
+
+	viper.Set("token", token)
+	viper.Set("refresh_token", refresh)
+	if err := viper.WriteConfig(); err != nil {
+		viper.SafeWriteConfig()
+	}
+}
@@ -5,11 +5,18 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/term"
 )
 
+var loginDevice bool
+
 var loginCmd = &cobra.Command{
 	Use:   "login",
 	Short: "Login to the server",
@@ -20,11 +27,19 @@ var loginCmd = &cobra.Command{
 			return
 		}
 
-		var username, password string
+		if loginDevice {
+			deviceLogin(serverURL)
+			return
+		}
+		if usesClientCert() {
+			certLogin(serverURL)
+			return
+		}
+
+		var username string
 		fmt.Print("Username: ")
 		fmt.Scanln(&username)
-		fmt.Print("Password: ")
-		fmt.Scanln(&password)
+		password := readPassword("Password: ")
 
 		data := map[string]string{
 			"username": username,
@@ -39,6 +54,10 @@ var loginCmd = &cobra.Command{
 		}
 		defer resp.Body.Close()
 
+		if resp.StatusCode == http.StatusTooManyRequests {
+			fmt.Printf("Too many failed attempts. Try again in %s seconds.\n", resp.Header.Get("Retry-After"))
+			return
+		}
 		if resp.StatusCode != http.StatusOK {
 			fmt.Println("Login failed. Check credentials.")
 			return
@@ -46,16 +65,232 @@ var loginCmd = &cobra.Command{
 
 		var result map[string]interface{}
 		json.NewDecoder(resp.Body).Decode(&result)
-		token := result["token"].(string)
 
-		viper.Set("token", token)
-		if err := viper.WriteConfig(); err != nil {
-			viper.SafeWriteConfig()
+		if mfaRequired, _ := result["mfa_required"].(bool); mfaRequired {
+			result = completeMFA(serverURL, result)
+			if result == nil {
+				return
+			}
+		}
+
+		saveTokens(result)
+		if changeRequired, _ := result["password_change_required"].(bool); changeRequired {
+			if !changeExpiredPassword(serverURL, password) {
+				return
+			}
 		}
 		fmt.Println("Login successful!")
 	},
 }
 
+// certLogin checks that the configured client certificate maps to a user.
+// Nothing is stored: every request presents the certificate again.
+func certLogin(serverURL string) {
+	resp, err := sendWithToken("GET", serverURL+"/api/my/user", nil, "")
+	if err != nil {
+		fmt.Println("Error connecting to server:", err)
+		return
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		fmt.Println("Client certificate was not accepted. Status:", resp.Status)
+		return
+	}
+
+	var user map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&user)
+	fmt.Printf("Authenticated as %v with client certificate.\n", user["username"])
+}
+
+// completeMFA runs the second login step, enrolling the user first if
+// policy requires MFA and none is set up yet. Enrolling takes a token from an
+// administrator.
+func completeMFA(serverURL string, login map[string]interface{}) map[string]interface{} {
+	mfaToken, _ := login["mfa_token"].(string)
+
+	if enrolled, _ := login["mfa_enrolled"].(bool); !enrolled {
+		fmt.Println("Multi-factor authentication is required for your account.")
+		var enrollmentToken string
+		fmt.Print("Enrolment token from your administrator: ")
+		fmt.Scanln(&enrollmentToken)
+
+		var enrollment map[string]interface{}
+		if !postJSON(serverURL+"/api/login/mfa/enroll", map[string]string{"mfa_token": mfaToken, "enrollment_token": enrollmentToken}, &enrollment) {
+			fmt.Println("Failed to start MFA enrolment. Check the enrolment token or ask your administrator for a new one.")
+			return nil
+		}
+		fmt.Println("Add this account to your authenticator app:")
+		fmt.Println("  Secret:", enrollment["secret"])
+		fmt.Println("  URI:   ", enrollment["provisioning_uri"])
+	}
+
+	var code string
+	fmt.Print("Verification code: ")
+	fmt.Scanln(&code)
+
+	var result map[string]interface{}
+	if !postJSON(serverURL+"/api/login/mfa", map[string]string{"mfa_token": mfaToken, "code": code}, &result) {
+		fmt.Println("Login failed. Invalid verification code.")
+		return nil
+	}
+
+	if codes, ok := result["recovery_codes"].([]interface{}); ok {
+		fmt.Println("Save these recovery codes somewhere safe. Each can be used once:")
+		for _, c := range codes {
+			fmt.Println("  ", c)
+		}
+	}
+	return result
+}
+
+// changeExpiredPassword prompts for a new password when the server requires
+// one before the session may be used.
+func changeExpiredPassword(serverURL, oldPassword string) bool {
+	fmt.Println("Your password has expired and must be changed.")
+
+	var policy map[string]interface{}
+	if resp, err := http.Get(serverURL + "/api/password-policy"); err == nil {
+		json.NewDecoder(resp.Body).Decode(&policy)
+		resp.Body.Close()
+		fmt.Println(describePasswordPolicy(policy))
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		newPassword := readPassword("New password: ")
+		confirm := readPassword("Confirm new password: ")
+		if newPassword != confirm {
+			fmt.Println("Passwords do not match.")
+			continue
+		}
+
+		body, _ := json.Marshal(map[string]string{"old_password": oldPassword, "new_password": newPassword})
+		resp, err := authorizedRequest("POST", serverURL+"/api/my/password", body)
+		if err != nil {
+			fmt.Println("Error connecting to server:", err)
+			return false
+		}
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			fmt.Println("Password rejected:", result["error"])
+			continue
+		}
+		if token, ok := result["token"].(string); ok {
+			viper.Set("token", token)
+			viper.WriteConfig()
+		}
+		fmt.Println("Password changed.")
+		return true
+	}
+	fmt.Println("Password not changed. Run 'ks login' again.")
+	return false
+}
+
+func describePasswordPolicy(policy map[string]interface{}) string {
+	rules := []string{fmt.Sprintf("at least %v characters", policy["min_length"])}
+	for key, rule := range map[string]string{
+		"require_uppercase": "an uppercase letter",
+		"require_lowercase": "a lowercase letter",
+		"require_digit":     "a digit",
+		"require_symbol":    "a symbol",
+	} {
+		if on, _ := policy[key].(bool); on {
+			rules = append(rules, rule)
+		}
+	}
+	sort.Strings(rules[1:])
+	return "Password must contain " + strings.Join(rules, ", ") + "."
+}
+
+// deviceLogin signs in without a password: the user approves a short code in
+// the web UI while the CLI polls for the resulting token.
+func deviceLogin(serverURL string) {
+	var code map[string]interface{}
+	if !postJSON(serverURL+"/api/device/code", map[string]string{}, &code) {
+		fmt.Println("Failed to start device login.")
+		return
+	}
+	deviceCode, _ := code["device_code"].(string)
+	interval, _ := code["interval"].(float64)
+	expiresIn, _ := code["expires_in"].(float64)
+
+	fmt.Printf("Open %v in your browser and enter the code: %v\n", code["verification_uri"], code["user_code"])
+	fmt.Println("Or open:", code["verification_uri_complete"])
+	fmt.Println("Waiting for approval...")
+
+	wait := time.Duration(interval) * time.Second
+	deadline := time.Now().Add(time.Duration(expiresIn) * time.Second)
+	for time.Now().Before(deadline) {
+		time.Sleep(wait)
+
+		jsonData, _ := json.Marshal(map[string]string{"device_code": deviceCode})
+		resp, err := http.Post(serverURL+"/api/device/token", "application/json", bytes.NewBuffer(jsonData))
+		if err != nil {
+			fmt.Println("Error connecting to server:", err)
+			return
+		}
+		var result map[string]interface{}
+		json.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK {
+			saveTokens(result)
+			if changeRequired, _ := result["password_change_required"].(bool); changeRequired {
+				fmt.Println("Your password has expired. Change it in the web UI before continuing.")
+				return
+			}
+			fmt.Println("Login successful!")
+			return
+		}
+
+		switch result["error"] {
+		case "authorization_pending":
+		case "slow_down":
+			wait += 5 * time.Second
+		case "access_denied":
+			fmt.Println("Login request was denied.")
+			return
+		default:
+			fmt.Println("Login request expired. Run 'ks login --device' again.")
+			return
+		}
+	}
+	fmt.Println("Login request expired. Run 'ks login --device' again.")
+}
+
+// readPassword prompts without echoing the input when stdin is a terminal.
+func readPassword(prompt string) string {
+	fmt.Print(prompt)
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		var password string
+		fmt.Scanln(&password)
+		return password
+	}
+	password, _ := term.ReadPassword(fd)
+	fmt.Println()
+	return string(password)
+}
+
+func postJSON(url string, data interface{}, result interface{}) bool {
+	jsonData, _ := json.Marshal(data)
+	resp, err := http.Post(url, "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		fmt.Println("Error connecting to server:", err)
+		return false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false
+	}
+	json.NewDecoder(resp.Body).Decode(result)
+	return true
+}
+
 var logoutCmd = &cobra.Command{
 	Use:   "logout",
 	Short: "Logout",
@@ -64,18 +299,20 @@ var logoutCmd = &cobra.Command{
 		token := viper.GetString("token")
 
 		if serverURL != "" && token != "" {
-			req, _ := http.NewRequest("POST", serverURL+"/api/logout", nil)
-			req.Header.Set("Authorization", "Bearer "+token)
-			http.DefaultClient.Do(req)
+			if resp, err := authorizedRequest("POST", serverURL+"/api/logout", nil); err == nil {
+				resp.Body.Close()
+			}
 		}
 
 		viper.Set("token", "")
+		viper.Set("refresh_token", "")
 		viper.WriteConfig()
 		fmt.Println("Logged out.")
 	},
 }
 
 func init() {
+	loginCmd.Flags().BoolVar(&loginDevice, "device", false, "Log in by approving a code in the web UI instead of entering a password")
 	rootCmd.AddCommand(loginCmd)
 	rootCmd.AddCommand(logoutCmd)
 }
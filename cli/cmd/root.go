@@ -27,6 +27,12 @@ func init() {
 	cobra.OnInitialize(initConfig)
 
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.kubeswitch.yaml)")
+	rootCmd.PersistentFlags().String("client-cert", "", "client certificate for mutual TLS (config: client_cert)")
+	rootCmd.PersistentFlags().String("client-key", "", "client certificate key for mutual TLS (config: client_key)")
+	rootCmd.PersistentFlags().String("ca-cert", "", "CA bundle used to verify the server (config: ca_cert)")
+	viper.BindPFlag("client_cert", rootCmd.PersistentFlags().Lookup("client-cert"))
+	viper.BindPFlag("client_key", rootCmd.PersistentFlags().Lookup("client-key"))
+	viper.BindPFlag("ca_cert", rootCmd.PersistentFlags().Lookup("ca-cert"))
 }
 
 func initConfig() {
@@ -48,4 +54,6 @@ func initConfig() {
 	if err := viper.ReadInConfig(); err == nil {
 		// fmt.Fprintln(os.Stderr, "Using config file:", viper.ConfigFileUsed())
 	}
+
+	cobra.CheckErr(configureTLS())
 }
@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"bufio"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/charmbracelet/bubbles/list"
 	tea "github.com/charmbracelet/bubbletea"
@@ -16,6 +19,14 @@ import (
 
 var docStyle = lipgloss.NewStyle().Margin(1, 2)
 
+var (
+	selectLevel      string
+	selectSelector   string
+	breakGlass       bool
+	breakGlassReason string
+	breakGlassFor    string
+)
+
 type item struct {
 	id, title, desc string
 }
@@ -77,15 +88,17 @@ var selectCmd = &cobra.Command{
 		serverURL := viper.GetString("server_url")
 		token := viper.GetString("token")
 
-		if serverURL == "" || token == "" {
+		if serverURL == "" || (token == "" && !usesClientCert()) {
 			fmt.Println("Not logged in. Use 'ks login'.")
 			os.Exit(1)
 		}
 
 		// Fetch clusters
-		req, _ := http.NewRequest("GET", serverURL+"/api/clusters", nil)
-		req.Header.Set("Authorization", "Bearer "+token)
-		resp, err := http.DefaultClient.Do(req)
+		clustersURL := serverURL + "/api/clusters"
+		if selectSelector != "" {
+			clustersURL += "?selector=" + url.QueryEscape(selectSelector)
+		}
+		resp, err := authorizedRequest("GET", clustersURL, nil)
 		if err != nil {
 			fmt.Println("Error fetching clusters:", err)
 			os.Exit(1)
@@ -113,6 +126,9 @@ var selectCmd = &cobra.Command{
 			if c["description"] != nil {
 				desc = c["description"].(string)
 			}
+			if level, _ := c["access_level"].(string); level != "" {
+				desc = strings.TrimSpace("[" + level + "] " + desc)
+			}
 			items = append(items, item{id: id, title: name, desc: desc})
 		}
 
@@ -130,28 +146,73 @@ var selectCmd = &cobra.Command{
 
 		finalModel := finalM.(model)
 		if finalModel.choice != "" {
-			downloadConfig(finalModel.choice, finalModel.choiceName, serverURL, token)
+			if breakGlass {
+				breakGlassAccess(finalModel.choice, finalModel.choiceName, serverURL)
+			}
+			downloadConfig(finalModel.choice, finalModel.choiceName, serverURL)
 		}
 	},
 }
 
-func downloadConfig(clusterID, clusterName, serverURL, token string) {
-	req, _ := http.NewRequest("GET", fmt.Sprintf("%s/api/clusters/%s/config", serverURL, clusterID), nil)
-	req.Header.Set("Authorization", "Bearer "+token)
-	resp, err := http.DefaultClient.Do(req)
+// breakGlassAccess grants the caller emergency access to the cluster. All
+// prompts go to stderr so that $(ks select --break-glass) still works.
+func breakGlassAccess(clusterID, clusterName, serverURL string) {
+	reason := strings.TrimSpace(breakGlassReason)
+	if reason == "" {
+		fmt.Fprintf(os.Stderr, "\033[31mBreak-glass access to %s is logged and reported.\033[0m\nReason: ", clusterName)
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		reason = strings.TrimSpace(line)
+	}
+	if reason == "" {
+		fmt.Fprintln(os.Stderr, "A reason is required.")
+		os.Exit(1)
+	}
+
+	body, _ := json.Marshal(map[string]string{
+		"reason":   reason,
+		"duration": breakGlassFor,
+		"level":    selectLevel,
+	})
+	resp, err := authorizedRequest("POST", fmt.Sprintf("%s/api/clusters/%s/break-glass", serverURL, clusterID), body)
 	if err != nil {
-		fmt.Println("Error downloading config:", err)
+		fmt.Fprintln(os.Stderr, "Error connecting to server:", err)
 		os.Exit(1)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		fmt.Println("Failed to download config.")
+	var result map[string]interface{}
+	json.NewDecoder(resp.Body).Decode(&result)
+	if hasAccess, _ := result["has_access"].(bool); resp.StatusCode == http.StatusBadRequest && hasAccess {
+		// Nothing to elevate, e.g. the caller re-ran the command while
+		// their earlier break-glass grant is still active.
+		fmt.Fprintf(os.Stderr, "You already have this access to %s, skipping break-glass\n", clusterName)
+		return
+	}
+	if resp.StatusCode != http.StatusCreated {
+		fmt.Fprintln(os.Stderr, "Break-glass failed:", result["error"])
+		os.Exit(1)
+	}
+	fmt.Fprintf(os.Stderr, "Break-glass %s access to %s granted until %s\n", result["level"], clusterName, result["expires_at"])
+}
+
+func downloadConfig(clusterID, clusterName, serverURL string) {
+	configURL := fmt.Sprintf("%s/api/clusters/%s/config", serverURL, clusterID)
+	if selectLevel != "" {
+		configURL += "?level=" + url.QueryEscape(selectLevel)
+	}
+	resp, err := authorizedRequest("GET", configURL, nil)
+	if err != nil {
+		fmt.Println("Error downloading config:", err)
 		os.Exit(1)
 	}
+	defer resp.Body.Close()
 
 	var result map[string]string
 	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintln(os.Stderr, "Failed to download config:", result["error"])
+		os.Exit(1)
+	}
 	configContent := result["kubeconfig"]
 
 	// Save to file
@@ -180,5 +241,10 @@ func downloadConfig(clusterID, clusterName, serverURL, token string) {
 }
 
 func init() {
+	selectCmd.Flags().StringVarP(&selectLevel, "level", "l", "", "Download a lower access level than granted: view or edit")
+	selectCmd.Flags().StringVarP(&selectSelector, "selector", "s", "", "Only list clusters whose labels match, e.g. env=prod,team=payments")
+	selectCmd.Flags().BoolVar(&breakGlass, "break-glass", false, "Grant yourself emergency access to the selected cluster (audited)")
+	selectCmd.Flags().StringVar(&breakGlassReason, "reason", "", "Justification for --break-glass, e.g. an incident number")
+	selectCmd.Flags().StringVar(&breakGlassFor, "duration", "1h", "How long --break-glass access lasts, at most 4h")
 	rootCmd.AddCommand(selectCmd)
 }
@@ -8,6 +8,7 @@ require (
 	github.com/charmbracelet/lipgloss v0.9.0
 	github.com/spf13/cobra v1.7.0
 	github.com/spf13/viper v1.16.0
+	golang.org/x/term v0.6.0
 )
 
 require (
@@ -37,7 +38,6 @@ require (
 	github.com/subosito/gotenv v1.4.2 // indirect
 	golang.org/x/sync v0.1.0 // indirect
 	golang.org/x/sys v0.12.0 // indirect
-	golang.org/x/term v0.6.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"errors"
+	"kubeswitch/server/models"
+	"log"
+	"sync"
+)
+
+var (
+	// ErrInvalidCredentials means the backend rejected the username or password.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUnavailable means the backend could not be reached.
+	ErrUnavailable = errors.New("authentication backend unavailable")
+)
+
+// Authenticator verifies a username and password against one backend and
+// returns the matching local user, provisioning it if necessary.
+type Authenticator interface {
+	Name() string
+	Authenticate(username, password string) (models.User, error)
+}
+
+var (
+	authenticatorsMu sync.Mutex
+	authenticators   []Authenticator
+)
+
+// Authenticators returns the configured password backends in the order they
+// are tried. Local users always come last so the seeded admin keeps working
+// when a directory is down.
+func Authenticators() []Authenticator {
+	authenticatorsMu.Lock()
+	defer authenticatorsMu.Unlock()
+
+	if authenticators == nil {
+		if cfg := LoadLDAPConfig(); cfg.Enabled() {
+			authenticators = append(authenticators, NewLDAPAuthenticator(cfg))
+		}
+		authenticators = append(authenticators, LocalAuthenticator{})
+	}
+	return authenticators
+}
+
+// Authenticate tries each backend in turn and returns the first match.
+func Authenticate(username, password string) (models.User, error) {
+	if password == "" {
+		return models.User{}, ErrInvalidCredentials
+	}
+
+	for _, a := range Authenticators() {
+		user, err := a.Authenticate(username, password)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			log.Printf("%s authentication failed: %v", a.Name(), err)
+		}
+	}
+	return models.User{}, ErrInvalidCredentials
+}
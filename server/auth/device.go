@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"os"
+	"strings"
+	"time"
+)
+
+// Device authorization follows RFC 8628: the CLI gets a device code to poll
+// with and a short user code that a logged-in user approves in the web UI.
+const (
+	DeviceCodeTTL      = 10 * time.Minute
+	DevicePollInterval = 5 * time.Second
+)
+
+// Poll errors use the RFC 8628 error codes so clients can switch on them.
+var (
+	ErrAuthorizationPending = errors.New("authorization_pending")
+	ErrSlowDown             = errors.New("slow_down")
+	ErrAccessDenied         = errors.New("access_denied")
+	ErrExpiredToken         = errors.New("expired_token")
+	ErrInvalidUserCode      = errors.New("invalid user code")
+	ErrDeviceCodeDecided    = errors.New("device code was already approved, denied or has expired")
+)
+
+// Consonants only, so codes are easy to type and never spell words.
+const userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+
+// DeviceVerificationURL is the web UI page where users enter the code. An
+// empty value means the caller should derive it from the request.
+func DeviceVerificationURL() string {
+	return os.Getenv("DEVICE_VERIFICATION_URL")
+}
+
+// CreateDeviceCode starts a device authorization and returns it together with
+// the raw device code, which is only stored hashed.
+func CreateDeviceCode(clientIP string) (models.DeviceCode, string, error) {
+	deviceCode, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return models.DeviceCode{}, "", err
+	}
+	userCode, err := generateUserCode()
+	if err != nil {
+		return models.DeviceCode{}, "", err
+	}
+
+	dc := models.DeviceCode{
+		DeviceCodeHash: utils.HashToken(deviceCode),
+		UserCode:       userCode,
+		ClientIP:       clientIP,
+		ExpiresAt:      time.Now().Add(DeviceCodeTTL),
+	}
+	if err := database.DB.Create(&dc).Error; err != nil {
+		return models.DeviceCode{}, "", err
+	}
+	return dc, deviceCode, nil
+}
+
+// FindPendingDeviceCode looks up an unexpired code that has not been approved
+// or denied yet. The user code is matched case- and dash-insensitively.
+func FindPendingDeviceCode(userCode string) (models.DeviceCode, error) {
+	var dc models.DeviceCode
+	err := database.DB.Where("user_code = ? AND approved_at IS NULL AND denied_at IS NULL AND expires_at > ?",
+		NormalizeUserCode(userCode), time.Now()).First(&dc).Error
+	if err != nil {
+		return dc, ErrInvalidUserCode
+	}
+	return dc, nil
+}
+
+// ApproveDeviceCode binds a pending code to the approving user. Only the
+// first decision on a code counts: approving or denying it again returns
+// ErrDeviceCodeDecided, so two users racing cannot both claim it.
+func ApproveDeviceCode(dc models.DeviceCode, userID uint) error {
+	now := time.Now()
+	return decideDeviceCode(dc, now, map[string]interface{}{
+		"user_id":     userID,
+		"approved_at": now,
+	})
+}
+
+func DenyDeviceCode(dc models.DeviceCode) error {
+	now := time.Now()
+	return decideDeviceCode(dc, now, map[string]interface{}{"denied_at": now})
+}
+
+func decideDeviceCode(dc models.DeviceCode, now time.Time, decision map[string]interface{}) error {
+	res := database.DB.Model(&models.DeviceCode{}).
+		Where("id = ? AND approved_at IS NULL AND denied_at IS NULL AND expires_at > ?", dc.ID, now).
+		Updates(decision)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrDeviceCodeDecided
+	}
+	return nil
+}
+
+// PollDeviceCode returns the approving user's ID once the code is approved.
+// The code is deleted at that point so it can be redeemed only once.
+func PollDeviceCode(deviceCode string) (uint, error) {
+	var dc models.DeviceCode
+	if err := database.DB.Where("device_code_hash = ?", utils.HashToken(deviceCode)).First(&dc).Error; err != nil {
+		return 0, ErrExpiredToken
+	}
+
+	now := time.Now()
+	if now.After(dc.ExpiresAt) {
+		return 0, ErrExpiredToken
+	}
+	if dc.DeniedAt != nil {
+		return 0, ErrAccessDenied
+	}
+
+	if dc.ApprovedAt == nil {
+		tooFast := dc.LastPolledAt != nil && now.Sub(*dc.LastPolledAt) < DevicePollInterval
+		database.DB.Model(&dc).Update("last_polled_at", now)
+		if tooFast {
+			return 0, ErrSlowDown
+		}
+		return 0, ErrAuthorizationPending
+	}
+
+	res := database.DB.Where("id = ?", dc.ID).Delete(&models.DeviceCode{})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return 0, ErrExpiredToken
+	}
+	return dc.UserID, nil
+}
+
+// PurgeDeviceCodes removes codes that expired without being redeemed.
+func PurgeDeviceCodes() error {
+	return database.DB.Where("expires_at < ?", time.Now()).Delete(&models.DeviceCode{}).Error
+}
+
+// NormalizeUserCode upper-cases the code and restores the XXXX-XXXX format.
+func NormalizeUserCode(code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	if len(code) != 8 {
+		return code
+	}
+	return code[:4] + "-" + code[4:]
+}
+
+func generateUserCode() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	for i := range b {
+		b[i] = userCodeAlphabet[int(b[i])%len(userCodeAlphabet)]
+	}
+	return string(b[:4]) + "-" + string(b[4:]), nil
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"errors"
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/models"
+	"testing"
+	"time"
+)
+
+func TestDeviceCodeApproval(t *testing.T) {
+	testutil.SetupDB(t)
+	dc, deviceCode, err := CreateDeviceCode("192.0.2.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := PollDeviceCode(deviceCode); !errors.Is(err, ErrAuthorizationPending) {
+		t.Fatalf("first poll: got %v, want ErrAuthorizationPending", err)
+	}
+	if _, err := PollDeviceCode(deviceCode); !errors.Is(err, ErrSlowDown) {
+		t.Fatalf("immediate second poll: got %v, want ErrSlowDown", err)
+	}
+
+	pending, err := FindPendingDeviceCode(" " + dc.UserCode[:4] + dc.UserCode[5:])
+	if err != nil || pending.ID != dc.ID {
+		t.Fatalf("user code without dash: got %d, %v", pending.ID, err)
+	}
+	if err := ApproveDeviceCode(pending, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApproveDeviceCode(pending, 8); !errors.Is(err, ErrDeviceCodeDecided) {
+		t.Errorf("second approval: got %v, want ErrDeviceCodeDecided", err)
+	}
+	if err := DenyDeviceCode(pending); !errors.Is(err, ErrDeviceCodeDecided) {
+		t.Errorf("denial after approval: got %v, want ErrDeviceCodeDecided", err)
+	}
+	if _, err := FindPendingDeviceCode(dc.UserCode); !errors.Is(err, ErrInvalidUserCode) {
+		t.Errorf("approved code is still pending: %v", err)
+	}
+
+	userID, err := PollDeviceCode(deviceCode)
+	if err != nil || userID != 7 {
+		t.Fatalf("poll after approval: got user %d, %v; want the first approver", userID, err)
+	}
+	if _, err := PollDeviceCode(deviceCode); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("second redemption: got %v, want ErrExpiredToken", err)
+	}
+}
+
+func TestDeviceCodeDenial(t *testing.T) {
+	testutil.SetupDB(t)
+	dc, deviceCode, err := CreateDeviceCode("192.0.2.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DenyDeviceCode(dc); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApproveDeviceCode(dc, 7); !errors.Is(err, ErrDeviceCodeDecided) {
+		t.Errorf("approval after denial: got %v, want ErrDeviceCodeDecided", err)
+	}
+	if _, err := PollDeviceCode(deviceCode); !errors.Is(err, ErrAccessDenied) {
+		t.Errorf("poll: got %v, want ErrAccessDenied", err)
+	}
+}
+
+func TestDeviceCodeExpiry(t *testing.T) {
+	testutil.SetupDB(t)
+	dc, deviceCode, err := CreateDeviceCode("192.0.2.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Model(&dc).Update("expires_at", time.Now().Add(-time.Second))
+
+	if _, err := FindPendingDeviceCode(dc.UserCode); !errors.Is(err, ErrInvalidUserCode) {
+		t.Errorf("expired code is still pending: %v", err)
+	}
+	if err := ApproveDeviceCode(dc, 7); !errors.Is(err, ErrDeviceCodeDecided) {
+		t.Errorf("approving an expired code: got %v, want ErrDeviceCodeDecided", err)
+	}
+	if _, err := PollDeviceCode(deviceCode); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("poll: got %v, want ErrExpiredToken", err)
+	}
+
+	if err := PurgeDeviceCodes(); err != nil {
+		t.Fatal(err)
+	}
+	var remaining int64
+	database.DB.Model(&models.DeviceCode{}).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("%d expired codes left after purge", remaining)
+	}
+}
@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"crypto/tls"
+	"fmt"
+	"kubeswitch/server/models"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAPConfig is read from the environment. LDAP login is enabled when a
+// server URL and base DN are set.
+type LDAPConfig struct {
+	URL               string // ldap://host:389 or ldaps://host:636
+	StartTLS          bool
+	InsecureSkipTLS   bool
+	BindDN            string // Service account used to look up users
+	BindPassword      string
+	BaseDN            string
+	UserFilter        string // %s is replaced with the escaped username
+	UsernameAttribute string
+	GroupAttribute    string
+	AdminGroups       []string // Members are mapped to the admin role
+	UserGroups        []string // If set, only members (or admins) may log in
+}
+
+func LoadLDAPConfig() LDAPConfig {
+	cfg := LDAPConfig{
+		URL:               os.Getenv("LDAP_URL"),
+		StartTLS:          os.Getenv("LDAP_START_TLS") == "true",
+		InsecureSkipTLS:   os.Getenv("LDAP_INSECURE_SKIP_VERIFY") == "true",
+		BindDN:            os.Getenv("LDAP_BIND_DN"),
+		BindPassword:      os.Getenv("LDAP_BIND_PASSWORD"),
+		BaseDN:            os.Getenv("LDAP_BASE_DN"),
+		UserFilter:        os.Getenv("LDAP_USER_FILTER"),
+		UsernameAttribute: os.Getenv("LDAP_USERNAME_ATTRIBUTE"),
+		GroupAttribute:    os.Getenv("LDAP_GROUP_ATTRIBUTE"),
+		// Group DNs contain commas, so these lists are separated by ";".
+		AdminGroups: splitGroups(os.Getenv("LDAP_ADMIN_GROUPS")),
+		UserGroups:  splitGroups(os.Getenv("LDAP_USER_GROUPS")),
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid=%s)"
+	}
+	if cfg.UsernameAttribute == "" {
+		cfg.UsernameAttribute = "uid"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	return cfg
+}
+
+func (cfg LDAPConfig) Enabled() bool {
+	return cfg.URL != "" && cfg.BaseDN != ""
+}
+
+// LDAPAuthenticator looks the user up with the service account, then binds
+// as the user to check the password.
+type LDAPAuthenticator struct {
+	Config LDAPConfig
+}
+
+func NewLDAPAuthenticator(cfg LDAPConfig) *LDAPAuthenticator {
+	return &LDAPAuthenticator{Config: cfg}
+}
+
+func (a *LDAPAuthenticator) Name() string { return "ldap" }
+
+func (a *LDAPAuthenticator) Authenticate(username, password string) (models.User, error) {
+	identity, err := a.verify(username, password)
+	if err != nil {
+		return models.User{}, err
+	}
+	return ProvisionUser("ldap", identity)
+}
+
+func (a *LDAPAuthenticator) verify(username, password string) (*Identity, error) {
+	// An empty password would be an unauthenticated bind, which succeeds.
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.dial()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer conn.Close()
+
+	if a.Config.BindDN != "" {
+		if err := conn.Bind(a.Config.BindDN, a.Config.BindPassword); err != nil {
+			return nil, fmt.Errorf("%w: service bind: %v", ErrUnavailable, err)
+		}
+	}
+
+	result, err := conn.Search(ldap.NewSearchRequest(
+		a.Config.BaseDN,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 10, false,
+		fmt.Sprintf(a.Config.UserFilter, ldap.EscapeFilter(username)),
+		[]string{"dn", a.Config.UsernameAttribute, a.Config.GroupAttribute},
+		nil,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("%w: search: %v", ErrUnavailable, err)
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := result.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%w: user bind: %v", ErrUnavailable, err)
+	}
+
+	role, ok := a.mapRole(entry.GetAttributeValues(a.Config.GroupAttribute))
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	name := entry.GetAttributeValue(a.Config.UsernameAttribute)
+	if name == "" {
+		name = username
+	}
+	return &Identity{Subject: entry.DN, Username: name, Role: role}, nil
+}
+
+func (a *LDAPAuthenticator) dial() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.Config.InsecureSkipTLS}
+	conn, err := ldap.DialURL(a.Config.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: 5 * time.Second}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetTimeout(10 * time.Second)
+
+	if a.Config.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+// mapRole maps group memberships to a role: members of AdminGroups are
+// admins and everyone else is a user. The second result is false when
+// UserGroups is configured and the user is in none of the allowed groups.
+func (a *LDAPAuthenticator) mapRole(groups []string) (string, bool) {
+	if groupMatch(groups, a.Config.AdminGroups) {
+		return "admin", true
+	}
+	if len(a.Config.UserGroups) == 0 || groupMatch(groups, a.Config.UserGroups) {
+		return "user", true
+	}
+	return "", false
+}
+
+// groupMatch compares groups by full DN or by their first RDN value (the CN),
+// case-insensitively.
+func groupMatch(groups, wanted []string) bool {
+	for _, g := range groups {
+		for _, w := range wanted {
+			if strings.EqualFold(g, w) || strings.EqualFold(groupCN(g), w) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func groupCN(dn string) string {
+	parsed, err := ldap.ParseDN(dn)
+	if err != nil || len(parsed.RDNs) == 0 || len(parsed.RDNs[0].Attributes) == 0 {
+		return dn
+	}
+	return parsed.RDNs[0].Attributes[0].Value
+}
+
+func splitGroups(s string) []string {
+	var groups []string
+	for _, g := range strings.Split(s, ";") {
+		if g = strings.TrimSpace(g); g != "" {
+			groups = append(groups, g)
+		}
+	}
+	return groups
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"errors"
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"testing"
+)
+
+func TestLDAPMapRole(t *testing.T) {
+	const (
+		admins     = "cn=kube-admins,ou=groups,dc=example,dc=com"
+		developers = "cn=developers,ou=groups,dc=example,dc=com"
+		sales      = "cn=sales,ou=groups,dc=example,dc=com"
+	)
+	tests := []struct {
+		name       string
+		userGroups []string
+		groups     []string
+		role       string
+		ok         bool
+	}{
+		{"admin group by DN", nil, []string{developers, admins}, "admin", true},
+		{"admin group by CN", nil, []string{"CN=Kube-Admins,OU=Groups,DC=example,DC=com"}, "admin", true},
+		{"no admin group", nil, []string{developers}, "user", true},
+		{"no groups", nil, nil, "user", true},
+		{"allowed group", []string{"developers"}, []string{developers}, "user", true},
+		{"admin without an allowed group", []string{"developers"}, []string{admins}, "admin", true},
+		{"not in an allowed group", []string{"developers"}, []string{sales}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := NewLDAPAuthenticator(LDAPConfig{AdminGroups: []string{admins}, UserGroups: tt.userGroups})
+			role, ok := a.mapRole(tt.groups)
+			if role != tt.role || ok != tt.ok {
+				t.Errorf("mapRole(%v) = %q, %v, want %q, %v", tt.groups, role, ok, tt.role, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLDAPDemotesFormerAdmin(t *testing.T) {
+	testutil.SetupDB(t)
+	a := NewLDAPAuthenticator(LDAPConfig{AdminGroups: []string{"kube-admins"}})
+	const dn = "uid=alice,ou=people,dc=example,dc=com"
+
+	for _, step := range []struct {
+		groups []string
+		want   string
+	}{
+		{[]string{"cn=kube-admins,ou=groups,dc=example,dc=com"}, "admin"},
+		{[]string{"cn=developers,ou=groups,dc=example,dc=com"}, "user"},
+	} {
+		role, _ := a.mapRole(step.groups)
+		user, err := ProvisionUser("ldap", &Identity{Subject: dn, Username: "alice", Role: role})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != step.want {
+			t.Errorf("groups %v: role = %q, want %q", step.groups, user.Role, step.want)
+		}
+	}
+}
+
+// TestAuthenticateFallsBackToLocal checks that local accounts can still log
+// in while the directory is unreachable.
+func TestAuthenticateFallsBackToLocal(t *testing.T) {
+	testutil.SetupDB(t)
+	previous := authenticators
+	authenticators = []Authenticator{
+		NewLDAPAuthenticator(LDAPConfig{URL: "ldap://127.0.0.1:1", BaseDN: "dc=example,dc=com"}),
+		LocalAuthenticator{},
+	}
+	t.Cleanup(func() { authenticators = previous })
+
+	hash, _ := utils.HashPassword("Secur3Pass!x")
+	database.DB.Create(&models.User{Username: "admin", Password: hash, Role: "admin", AuthSource: "local"})
+	database.DB.Create(&models.User{Username: "bob", Password: hash, Role: "user", AuthSource: "ldap", ExternalID: "uid=bob"})
+
+	user, err := Authenticate("admin", "Secur3Pass!x")
+	if err != nil || user.Username != "admin" {
+		t.Fatalf("local login while LDAP is down: %+v, %v", user, err)
+	}
+	if _, err := Authenticate("admin", "wrong"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("wrong password: got %v", err)
+	}
+	// Directory users have no local password to fall back to.
+	if _, err := Authenticate("bob", "Secur3Pass!x"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("LDAP user logged in locally: got %v", err)
+	}
+}
@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+)
+
+// LocalAuthenticator checks bcrypt hashes in the users table.
+type LocalAuthenticator struct{}
+
+func (LocalAuthenticator) Name() string { return "local" }
+
+func (LocalAuthenticator) Authenticate(username, password string) (models.User, error) {
+	var user models.User
+	if err := database.DB.Where("username = ? AND auth_source = ?", username, "local").First(&user).Error; err != nil {
+		return user, ErrInvalidCredentials
+	}
+	if !utils.CheckPasswordHash(password, user.Password) {
+		return user, ErrInvalidCredentials
+	}
+	return user, nil
+}
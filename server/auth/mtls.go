@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"os"
+	"strings"
+)
+
+// TLSConfig controls whether the server terminates TLS itself and whether it
+// accepts client certificates in place of bearer tokens.
+type TLSConfig struct {
+	CertFile     string // Server certificate
+	KeyFile      string
+	ClientCAFile string // CA that issues client certificates; empty disables mTLS
+	IdentityFrom string // "cn" (default) or "san"
+}
+
+func LoadTLSConfig() TLSConfig {
+	cfg := TLSConfig{
+		CertFile:     os.Getenv("TLS_CERT_FILE"),
+		KeyFile:      os.Getenv("TLS_KEY_FILE"),
+		ClientCAFile: os.Getenv("TLS_CLIENT_CA_FILE"),
+		IdentityFrom: strings.ToLower(os.Getenv("TLS_CLIENT_IDENTITY")),
+	}
+	if cfg.IdentityFrom == "" {
+		cfg.IdentityFrom = "cn"
+	}
+	return cfg
+}
+
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" && c.KeyFile != ""
+}
+
+// ServerTLSConfig builds the listener configuration. Client certificates are
+// verified when presented but not required, so browsers and token clients
+// keep working on the same port.
+func (c TLSConfig) ServerTLSConfig() (*tls.Config, error) {
+	if c.ClientCAFile != "" && !c.Enabled() {
+		return nil, errors.New("TLS_CLIENT_CA_FILE requires TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+	if c.IdentityFrom != "cn" && c.IdentityFrom != "san" {
+		return nil, fmt.Errorf("TLS_CLIENT_IDENTITY must be cn or san, got %q", c.IdentityFrom)
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificates found", c.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+// CertificateUser maps a verified client certificate to a user, either by
+// subject common name or by any DNS, email or URI subject alternative name.
+// Service accounts are excluded; they authenticate only with API tokens.
+func CertificateUser(cert *x509.Certificate) (models.User, error) {
+	var names []string
+	if LoadTLSConfig().IdentityFrom == "san" {
+		names = append(names, cert.DNSNames...)
+		names = append(names, cert.EmailAddresses...)
+		for _, uri := range cert.URIs {
+			names = append(names, uri.String())
+		}
+	} else if cert.Subject.CommonName != "" {
+		names = []string{cert.Subject.CommonName}
+	}
+
+	var user models.User
+	if len(names) == 0 {
+		return user, ErrInvalidCredentials
+	}
+	if err := database.DB.Where("username IN ? AND auth_source <> ?", names, "service").First(&user).Error; err != nil {
+		return user, ErrInvalidCredentials
+	}
+	return user, nil
+}
@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/models"
+	"net/url"
+	"testing"
+)
+
+func TestCertificateUser(t *testing.T) {
+	testutil.SetupDB(t)
+	for _, user := range []models.User{
+		{Username: "alice", Role: "user", AuthSource: "local"},
+		{Username: "bob@example.com", Role: "user", AuthSource: "ldap"},
+		{Username: "spiffe://example.com/ci", Role: "user", AuthSource: "local"},
+		{Username: "deploy-bot", Role: "user", AuthSource: "service"},
+	} {
+		database.DB.Create(&user)
+	}
+	spiffe, _ := url.Parse("spiffe://example.com/ci")
+
+	tests := []struct {
+		name     string
+		identity string
+		cert     x509.Certificate
+		want     string // "" when the certificate must be rejected
+	}{
+		{name: "common name", cert: x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}, want: "alice"},
+		{name: "unknown common name", cert: x509.Certificate{Subject: pkix.Name{CommonName: "mallory"}}},
+		{name: "no common name", cert: x509.Certificate{DNSNames: []string{"alice"}}},
+		{name: "service account by common name", cert: x509.Certificate{Subject: pkix.Name{CommonName: "deploy-bot"}}},
+		{
+			name:     "SANs are ignored in cn mode",
+			cert:     x509.Certificate{Subject: pkix.Name{CommonName: "mallory"}, EmailAddresses: []string{"bob@example.com"}},
+			identity: "cn",
+		},
+		{
+			name:     "DNS SAN",
+			cert:     x509.Certificate{Subject: pkix.Name{CommonName: "mallory"}, DNSNames: []string{"host.example.com", "alice"}},
+			identity: "san",
+			want:     "alice",
+		},
+		{name: "email SAN", cert: x509.Certificate{EmailAddresses: []string{"bob@example.com"}}, identity: "san", want: "bob@example.com"},
+		{name: "URI SAN", cert: x509.Certificate{URIs: []*url.URL{spiffe}}, identity: "san", want: "spiffe://example.com/ci"},
+		{name: "common name is ignored in san mode", cert: x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}, identity: "san"},
+		{name: "service account by SAN", cert: x509.Certificate{DNSNames: []string{"deploy-bot"}}, identity: "san"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TLS_CLIENT_IDENTITY", tt.identity)
+			user, err := CertificateUser(&tt.cert)
+			if tt.want == "" {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Errorf("got user %q, %v; want ErrInvalidCredentials", user.Username, err)
+				}
+				return
+			}
+			if err != nil || user.Username != tt.want {
+				t.Errorf("got user %q, %v; want %s", user.Username, err, tt.want)
+			}
+		})
+	}
+}
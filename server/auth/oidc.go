@@ -0,0 +1,269 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"kubeswitch/server/utils"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCConfig is read from the environment. OIDC login is enabled when an
+// issuer and client ID are set.
+type OIDCConfig struct {
+	IssuerURL     string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string // Must point at /api/oidc/callback
+	Scopes        []string
+	UsernameClaim string
+	RoleClaim     string
+	AdminValues   []string // Role claim values that map to the admin role
+	PostLoginURL  string   // Web UI page that receives the tokens
+}
+
+func LoadOIDCConfig() OIDCConfig {
+	cfg := OIDCConfig{
+		IssuerURL:     os.Getenv("OIDC_ISSUER_URL"),
+		ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:        splitList(os.Getenv("OIDC_SCOPES")),
+		UsernameClaim: os.Getenv("OIDC_USERNAME_CLAIM"),
+		RoleClaim:     os.Getenv("OIDC_ROLE_CLAIM"),
+		AdminValues:   splitList(os.Getenv("OIDC_ADMIN_VALUES")),
+		PostLoginURL:  os.Getenv("OIDC_POST_LOGIN_URL"),
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{oidc.ScopeOpenID, "profile", "email", "groups"}
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.RoleClaim == "" {
+		cfg.RoleClaim = "groups"
+	}
+	if cfg.PostLoginURL == "" {
+		cfg.PostLoginURL = "/oidc/callback"
+	}
+	return cfg
+}
+
+func (cfg OIDCConfig) Enabled() bool {
+	return cfg.IssuerURL != "" && cfg.ClientID != ""
+}
+
+// Identity is a user as asserted by an external identity provider.
+type Identity struct {
+	Subject  string
+	Username string
+	Role     string // "admin" or "user", as mapped from the provider's groups or claims
+	MFA      bool   // The provider reported multi-factor authentication
+}
+
+type OIDCProvider struct {
+	Config   OIDCConfig
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+
+	mu      sync.Mutex
+	pending map[string]pendingLogin
+}
+
+type pendingLogin struct {
+	nonce    string
+	verifier string
+	expires  time.Time
+}
+
+const pendingLoginTTL = 10 * time.Minute
+
+var (
+	oidcMu       sync.Mutex
+	oidcProvider *OIDCProvider
+)
+
+// OIDC returns the configured provider, running discovery against the issuer
+// on first use so the server still starts while the IdP is unreachable, and
+// again if the configuration has changed.
+func OIDC() (*OIDCProvider, error) {
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+
+	cfg := LoadOIDCConfig()
+	if !cfg.Enabled() {
+		return nil, errors.New("OIDC login is not configured")
+	}
+	if oidcProvider != nil && reflect.DeepEqual(oidcProvider.Config, cfg) {
+		return oidcProvider, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	provider, err := NewOIDCProvider(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	oidcProvider = provider
+	return oidcProvider, nil
+}
+
+// NewOIDCProvider runs discovery against the configured issuer.
+func NewOIDCProvider(ctx context.Context, cfg OIDCConfig) (*OIDCProvider, error) {
+	provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %w", err)
+	}
+
+	return &OIDCProvider{
+		Config: cfg,
+		oauth2: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			RedirectURL:  cfg.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       cfg.Scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		pending:  make(map[string]pendingLogin),
+	}, nil
+}
+
+// AuthCodeURL starts a login and returns the state to bind to the browser
+// together with the IdP URL to redirect to.
+func (p *OIDCProvider) AuthCodeURL() (string, string, error) {
+	state, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	for k, v := range p.pending {
+		if now.After(v.expires) {
+			delete(p.pending, k)
+		}
+	}
+	p.pending[state] = pendingLogin{nonce: nonce, verifier: verifier, expires: now.Add(pendingLoginTTL)}
+	p.mu.Unlock()
+
+	challenge := sha256.Sum256([]byte(verifier))
+	url := p.oauth2.AuthCodeURL(state,
+		oidc.Nonce(nonce),
+		oauth2.SetAuthURLParam("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:])),
+		oauth2.SetAuthURLParam("code_challenge_method", "S256"),
+	)
+	return state, url, nil
+}
+
+// Exchange completes a login started by AuthCodeURL.
+func (p *OIDCProvider) Exchange(ctx context.Context, state, code string) (*Identity, error) {
+	p.mu.Lock()
+	pending, ok := p.pending[state]
+	delete(p.pending, state)
+	p.mu.Unlock()
+	if !ok || time.Now().After(pending.expires) {
+		return nil, errors.New("unknown or expired login state")
+	}
+
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.SetAuthURLParam("code_verifier", pending.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange failed: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("no id_token in token response")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id_token: %w", err)
+	}
+	if idToken.Nonce != pending.nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, err
+	}
+
+	username, _ := claims[p.Config.UsernameClaim].(string)
+	if username == "" {
+		return nil, fmt.Errorf("id_token has no %q claim", p.Config.UsernameClaim)
+	}
+
+	return &Identity{
+		Subject:  idToken.Subject,
+		Username: username,
+		Role:     MapRole(claimValues(claims[p.Config.RoleClaim]), p.Config.AdminValues),
+		MFA:      usedMFA(claimValues(claims["amr"])),
+	}, nil
+}
+
+// usedMFA reports whether the amr claim (RFC 8176) lists multi-factor
+// authentication.
+func usedMFA(amr []string) bool {
+	for _, method := range amr {
+		if method == "mfa" {
+			return true
+		}
+	}
+	return false
+}
+
+// MapRole returns "admin" if any of the values is in adminValues, and "user"
+// otherwise.
+func MapRole(values, adminValues []string) string {
+	for _, v := range values {
+		for _, a := range adminValues {
+			if strings.EqualFold(v, a) {
+				return "admin"
+			}
+		}
+	}
+	return "user"
+}
+
+// claimValues flattens a string or string array claim.
+func claimValues(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"kubeswitch/server/auth/oidctest"
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/models"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestOIDC(t *testing.T, issuer *oidctest.Issuer, configure func(*OIDCConfig)) *OIDCProvider {
+	t.Helper()
+	cfg := OIDCConfig{
+		IssuerURL:     issuer.URL,
+		ClientID:      issuer.ClientID,
+		ClientSecret:  issuer.ClientSecret,
+		RedirectURL:   "https://kubeswitch.example.com/api/oidc/callback",
+		Scopes:        []string{"openid", "groups"},
+		UsernameClaim: "preferred_username",
+		RoleClaim:     "groups",
+		AdminValues:   []string{"kube-admins"},
+	}
+	if configure != nil {
+		configure(&cfg)
+	}
+	provider, err := NewOIDCProvider(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+// login runs the authorization-code flow and returns what Exchange makes
+// of the ID token issued with claims.
+func login(t *testing.T, issuer *oidctest.Issuer, p *OIDCProvider, claims map[string]interface{}) (*Identity, error) {
+	t.Helper()
+	state, authURL, err := p.AuthCodeURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, returnedState := issuer.Authorize(t, authURL, claims)
+	if returnedState != state {
+		t.Fatalf("issuer returned state %q, want %q", returnedState, state)
+	}
+	return p.Exchange(context.Background(), state, code)
+}
+
+func TestOIDCExchangeMapsClaims(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	p := newTestOIDC(t, issuer, nil)
+
+	identity, err := login(t, issuer, p, map[string]interface{}{
+		"sub":                "u-123",
+		"preferred_username": "alice",
+		"groups":             []string{"developers", "Kube-Admins"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *identity != (Identity{Subject: "u-123", Username: "alice", Role: "admin"}) {
+		t.Errorf("got %+v", identity)
+	}
+
+	identity, err = login(t, issuer, p, map[string]interface{}{"preferred_username": "bob", "groups": []string{"developers"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Role != "user" {
+		t.Errorf("role = %q, want user", identity.Role)
+	}
+
+	if _, err := login(t, issuer, p, map[string]interface{}{"groups": []string{"developers"}}); err == nil ||
+		!strings.Contains(err.Error(), "preferred_username") {
+		t.Errorf("missing username claim: got %v", err)
+	}
+}
+
+func TestOIDCExchangeCustomClaims(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	p := newTestOIDC(t, issuer, func(cfg *OIDCConfig) {
+		cfg.UsernameClaim = "email"
+		cfg.RoleClaim = "role"
+		cfg.AdminValues = []string{"platform"}
+	})
+
+	identity, err := login(t, issuer, p, map[string]interface{}{"email": "carol@example.com", "role": "platform"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if identity.Username != "carol@example.com" || identity.Role != "admin" {
+		t.Errorf("got %+v", identity)
+	}
+}
+
+func TestOIDCExchangeChecksState(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	p := newTestOIDC(t, issuer, nil)
+	claims := map[string]interface{}{"preferred_username": "alice"}
+
+	_, authURL, _ := p.AuthCodeURL()
+	code, _ := issuer.Authorize(t, authURL, claims)
+	if _, err := p.Exchange(context.Background(), "forged-state", code); err == nil {
+		t.Error("exchanged with a state that was never issued")
+	}
+
+	state, authURL, _ := p.AuthCodeURL()
+	code, _ = issuer.Authorize(t, authURL, claims)
+	if _, err := p.Exchange(context.Background(), state, code); err != nil {
+		t.Fatal(err)
+	}
+	code, _ = issuer.Authorize(t, authURL, claims)
+	if _, err := p.Exchange(context.Background(), state, code); err == nil {
+		t.Error("a state was accepted twice")
+	}
+
+	state, authURL, _ = p.AuthCodeURL()
+	code, _ = issuer.Authorize(t, authURL, claims)
+	p.mu.Lock()
+	pending := p.pending[state]
+	pending.expires = time.Now().Add(-time.Second)
+	p.pending[state] = pending
+	p.mu.Unlock()
+	if _, err := p.Exchange(context.Background(), state, code); err == nil {
+		t.Error("an expired login was accepted")
+	}
+}
+
+func TestOIDCExchangeChecksNonce(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	p := newTestOIDC(t, issuer, nil)
+
+	// An ID token minted for a different login, e.g. replayed by an attacker
+	_, err := login(t, issuer, p, map[string]interface{}{"preferred_username": "alice", "nonce": "other-login"})
+	if err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Errorf("got %v, want a nonce mismatch", err)
+	}
+}
+
+func TestOIDCExchangeSendsPKCEVerifier(t *testing.T) {
+	issuer := oidctest.NewIssuer(t)
+	p := newTestOIDC(t, issuer, nil)
+
+	state, _, _ := p.AuthCodeURL()
+	if _, err := p.Exchange(context.Background(), state, "unknown-code"); err == nil {
+		t.Error("exchanged an unknown code")
+	}
+
+	// A code issued for another challenge, as if intercepted from another
+	// login, must not be redeemable with this login's verifier.
+	state, authURL, _ := p.AuthCodeURL()
+	u, _ := url.Parse(authURL)
+	q := u.Query()
+	q.Set("code_challenge", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM")
+	u.RawQuery = q.Encode()
+	code, _ := issuer.Authorize(t, u.String(), map[string]interface{}{"preferred_username": "alice"})
+	if _, err := p.Exchange(context.Background(), state, code); err == nil || !strings.Contains(err.Error(), "code exchange failed") {
+		t.Errorf("got %v, want the code exchange to fail", err)
+	}
+}
+
+func TestProvisionUser(t *testing.T) {
+	testutil.SetupDB(t)
+	database.DB.Create(&models.User{Username: "local-admin", Role: "admin"})
+
+	user, err := ProvisionUser("oidc", &Identity{Subject: "u-1", Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == 0 || user.Role != "user" || user.AuthSource != "oidc" || user.ExternalID != "u-1" {
+		t.Fatalf("provisioned %+v", user)
+	}
+
+	// A custom role assigned in kubeswitch survives logins without the
+	// admin group.
+	database.DB.Model(&user).Update("role", "auditor")
+	user, err = ProvisionUser("oidc", &Identity{Subject: "u-1", Username: "alice", Role: "user"})
+	if err != nil || user.Role != "auditor" {
+		t.Fatalf("custom role not kept: %+v, %v", user, err)
+	}
+
+	user, _ = ProvisionUser("oidc", &Identity{Subject: "u-1", Username: "alice", Role: "admin"})
+	var stored models.User
+	database.DB.First(&stored, user.ID)
+	if stored.Role != "admin" {
+		t.Errorf("asserted role not synced: %q", stored.Role)
+	}
+
+	// Removed from the admin group at the provider
+	user, _ = ProvisionUser("oidc", &Identity{Subject: "u-1", Username: "alice", Role: "user"})
+	database.DB.First(&stored, user.ID)
+	if user.Role != "user" || stored.Role != "user" {
+		t.Errorf("former admin not demoted: %q", stored.Role)
+	}
+
+	if _, err := ProvisionUser("oidc", &Identity{Subject: "u-2", Username: "local-admin", Role: "admin"}); err != ErrUsernameTaken {
+		t.Errorf("took over a local account: %v", err)
+	}
+	if _, err := ProvisionUser("ldap", &Identity{Subject: "u-1", Username: "alice"}); err != ErrUsernameTaken {
+		t.Errorf("an LDAP identity took over the OIDC user: %v", err)
+	}
+
+	var provisioned int64
+	database.DB.Model(&models.AuditLog{}).Where("action = ?", "ProvisionUser").Count(&provisioned)
+	if provisioned != 1 {
+		t.Errorf("got %d provisioning audit entries, want 1", provisioned)
+	}
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"errors"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+)
+
+var ErrUsernameTaken = errors.New("A user with this username already exists")
+
+// ProvisionUser finds the user for an external identity, creating it on
+// first login, and syncs its role with the one the provider mapped. Users
+// on a built-in role follow the provider, so someone removed from the admin
+// group is demoted on their next login; a custom role assigned in kubeswitch
+// is kept unless the provider asserts admin.
+func ProvisionUser(source string, identity *Identity) (models.User, error) {
+	role := identity.Role
+	if role == "" {
+		role = utils.DefaultRole
+	}
+
+	var user models.User
+	err := database.DB.Where("auth_source = ? AND external_id = ?", source, identity.Subject).First(&user).Error
+	if err != nil {
+		var existing int64
+		database.DB.Model(&models.User{}).Where("username = ?", identity.Username).Count(&existing)
+		if existing > 0 {
+			return user, ErrUsernameTaken
+		}
+
+		user = models.User{
+			Username:   identity.Username,
+			Role:       role,
+			AuthSource: source,
+			ExternalID: identity.Subject,
+		}
+		if err := database.DB.Create(&user).Error; err != nil {
+			return user, err
+		}
+		utils.LogAudit(user.ID, "ProvisionUser", "Provisioned user "+user.Username+" from "+source, "")
+		return user, nil
+	}
+
+	if roleNeedsSync(user.Role, role) {
+		if err := database.DB.Model(&user).Update("role", role).Error; err != nil {
+			return user, err
+		}
+		user.Role = role
+	}
+	return user, nil
+}
+
+// roleNeedsSync reports whether a user on current has to be moved to the
+// role the provider asserted, following the rules of ProvisionUser.
+func roleNeedsSync(current, asserted string) bool {
+	return current != asserted && (asserted == "admin" || utils.IsBuiltInRole(current))
+}
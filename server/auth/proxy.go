@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+var (
+	ErrProxyNoUsername  = errors.New("Auth proxy sent an empty username")
+	ErrProxyGroupDenied = errors.New("User is not in an allowed group")
+	ErrProxyMFARequired = errors.New("MFA is required for this account, but the auth proxy does not enforce it")
+)
+
+// ProxyConfig enables authentication by an upstream proxy such as
+// oauth2-proxy. The identity headers are only trusted on connections that
+// come directly from TrustedCIDRs, so clients cannot set them themselves.
+type ProxyConfig struct {
+	TrustedCIDRs []*net.IPNet
+	UserHeader   string
+	GroupsHeader string   // Comma-separated group list
+	AdminGroups  []string // Members are mapped to the admin role
+	UserGroups   []string // If set, only members (or admins) are let in
+	MFA          bool     // The proxy only lets in users who completed MFA
+}
+
+func LoadProxyConfig() (ProxyConfig, error) {
+	cfg := ProxyConfig{
+		UserHeader:   os.Getenv("AUTH_PROXY_USER_HEADER"),
+		GroupsHeader: os.Getenv("AUTH_PROXY_GROUPS_HEADER"),
+		AdminGroups:  splitList(os.Getenv("AUTH_PROXY_ADMIN_GROUPS")),
+		UserGroups:   splitList(os.Getenv("AUTH_PROXY_USER_GROUPS")),
+		MFA:          os.Getenv("AUTH_PROXY_MFA") == "true",
+	}
+	if cfg.UserHeader == "" {
+		cfg.UserHeader = "X-Forwarded-User"
+	}
+	if cfg.GroupsHeader == "" {
+		cfg.GroupsHeader = "X-Forwarded-Groups"
+	}
+
+	networks, err := utils.ParseCIDRs(splitList(os.Getenv("AUTH_PROXY_TRUSTED_CIDRS")))
+	if err != nil {
+		return cfg, fmt.Errorf("AUTH_PROXY_TRUSTED_CIDRS: %w", err)
+	}
+	cfg.TrustedCIDRs = networks
+	return cfg, nil
+}
+
+// TrustedProxies returns the reverse proxies whose forwarding headers
+// determine the client IP (TRUSTED_PROXIES, addresses or CIDRs) and, if set,
+// the headers to read it from (TRUSTED_PROXY_HEADERS). With no trusted
+// proxies the TCP peer address is used.
+func TrustedProxies() (proxies, headers []string) {
+	return splitList(os.Getenv("TRUSTED_PROXIES")), splitList(os.Getenv("TRUSTED_PROXY_HEADERS"))
+}
+
+func (cfg ProxyConfig) Enabled() bool {
+	return len(cfg.TrustedCIDRs) > 0
+}
+
+// Trusted reports whether the request came straight from a trusted proxy.
+// It deliberately looks at the TCP peer rather than X-Forwarded-For.
+func (cfg ProxyConfig) Trusted(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range cfg.TrustedCIDRs {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Asserted reports whether the request carries an identity from a trusted
+// proxy.
+func (cfg ProxyConfig) Asserted(r *http.Request) bool {
+	return cfg.Enabled() && cfg.Trusted(r) && r.Header.Get(cfg.UserHeader) != ""
+}
+
+// ProxyUser returns the user asserted by the proxy headers, creating it on
+// first sight and syncing its role with the groups header: members of
+// AdminGroups are admins and everyone else allowed in is a user. Users the
+// MFA policy applies to are refused unless the proxy enforces MFA. It runs
+// on every request, so known users whose role is in sync are only read.
+func (cfg ProxyConfig) ProxyUser(r *http.Request) (models.User, error) {
+	username := strings.TrimSpace(r.Header.Get(cfg.UserHeader))
+	if username == "" {
+		return models.User{}, ErrProxyNoUsername
+	}
+	groups := splitList(r.Header.Get(cfg.GroupsHeader))
+
+	role := "user"
+	if groupMatch(groups, cfg.AdminGroups) {
+		role = "admin"
+	} else if len(cfg.UserGroups) > 0 && !groupMatch(groups, cfg.UserGroups) {
+		return models.User{}, ErrProxyGroupDenied
+	}
+
+	var user models.User
+	err := database.DB.Where("auth_source = ? AND external_id = ?", "proxy", username).First(&user).Error
+	if err != nil || roleNeedsSync(user.Role, role) {
+		if user, err = ProvisionUser("proxy", &Identity{Subject: username, Username: username, Role: role}); err != nil {
+			return user, err
+		}
+	}
+	if !cfg.MFA && utils.MFARequired(user.Role) {
+		return models.User{}, ErrProxyMFARequired
+	}
+	return user, nil
+}
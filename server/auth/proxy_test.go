@@ -0,0 +1,82 @@
+package auth
+
+import (
+	"errors"
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/models"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestProxyUserRejectsBlankUsername(t *testing.T) {
+	testutil.SetupDB(t)
+	t.Setenv("AUTH_PROXY_TRUSTED_CIDRS", "192.0.2.0/24")
+	cfg, err := LoadProxyConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/clusters", nil)
+	req.Header.Set("X-Forwarded-User", "  ")
+	if _, err := cfg.ProxyUser(req); !errors.Is(err, ErrProxyNoUsername) {
+		t.Fatalf("got %v, want ErrProxyNoUsername", err)
+	}
+	var count int64
+	database.DB.Model(&models.User{}).Count(&count)
+	if count != 0 {
+		t.Errorf("%d users created for a blank username", count)
+	}
+
+	req.Header.Set("X-Forwarded-User", " alice ")
+	if user, err := cfg.ProxyUser(req); err != nil || user.Username != "alice" {
+		t.Errorf("got %q, %v, want alice", user.Username, err)
+	}
+}
+
+func TestProxyUserSyncsOnlyOnChange(t *testing.T) {
+	testutil.SetupDB(t)
+	t.Setenv("AUTH_PROXY_TRUSTED_CIDRS", "192.0.2.0/24")
+	t.Setenv("AUTH_PROXY_ADMIN_GROUPS", "platform")
+	cfg, err := LoadProxyConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("GET", "/api/clusters", nil)
+	req.Header.Set("X-Forwarded-User", "alice")
+
+	user, err := cfg.ProxyUser(req)
+	if err != nil || user.Role != "user" {
+		t.Fatalf("first request: got role %q, %v", user.Role, err)
+	}
+	stale := time.Now().Add(-time.Hour).Truncate(time.Second)
+	database.DB.Model(&user).UpdateColumn("updated_at", stale)
+
+	for i := 0; i < 3; i++ {
+		if _, err := cfg.ProxyUser(req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stored models.User
+	database.DB.First(&stored, user.ID)
+	if !stored.UpdatedAt.Equal(stale) {
+		t.Errorf("known user was written on every request: updated_at %v", stored.UpdatedAt)
+	}
+
+	req.Header.Set("X-Forwarded-Groups", "developers, platform")
+	if user, err = cfg.ProxyUser(req); err != nil || user.Role != "admin" {
+		t.Fatalf("admin group: got role %q, %v", user.Role, err)
+	}
+	database.DB.First(&stored, user.ID)
+	if stored.Role != "admin" {
+		t.Errorf("stored role %q, want admin", stored.Role)
+	}
+
+	// A custom role assigned in kubeswitch is kept for non-admins
+	database.DB.Model(&stored).Update("role", "auditor")
+	req.Header.Del("X-Forwarded-Groups")
+	if user, err = cfg.ProxyUser(req); err != nil || user.Role != "auditor" {
+		t.Errorf("custom role: got %q, %v", user.Role, err)
+	}
+}
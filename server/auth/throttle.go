@@ -0,0 +1,181 @@
+package auth
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ThrottleConfig controls brute-force protection on the login endpoints.
+type ThrottleConfig struct {
+	MaxUserFailures int           // Failures before a username is locked
+	MaxIPFailures   int           // Failures before a client IP is locked
+	LockoutDuration time.Duration // How long a lock lasts
+	FailureWindow   time.Duration // Failures older than this are forgotten
+	MaxDelay        time.Duration // Cap for the progressive delay
+}
+
+func LoadThrottleConfig() ThrottleConfig {
+	return ThrottleConfig{
+		MaxUserFailures: envInt("LOGIN_MAX_FAILURES", 5),
+		MaxIPFailures:   envInt("LOGIN_MAX_IP_FAILURES", 20),
+		LockoutDuration: envDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		FailureWindow:   envDuration("LOGIN_FAILURE_WINDOW", 15*time.Minute),
+		MaxDelay:        30 * time.Second,
+	}
+}
+
+func UserThrottleKey(username string) string {
+	return "user:" + strings.ToLower(strings.TrimSpace(username))
+}
+
+func IPThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// CheckLogin reports whether a login attempt may proceed. When it may not,
+// it returns how long the caller has to wait and whether this is a lockout
+// rather than a progressive delay.
+func CheckLogin(username, ip string) (time.Duration, bool) {
+	cfg := LoadThrottleConfig()
+	now := time.Now()
+
+	var wait time.Duration
+	locked := false
+	for _, key := range []string{UserThrottleKey(username), IPThrottleKey(ip)} {
+		var t models.LoginThrottle
+		if err := database.DB.Where("key = ?", key).First(&t).Error; err != nil {
+			continue
+		}
+
+		if t.LockedUntil != nil && now.Before(*t.LockedUntil) {
+			locked = true
+			if d := t.LockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+			continue
+		}
+		if now.Sub(t.LastFailureAt) > cfg.FailureWindow {
+			continue
+		}
+		if d := t.LastFailureAt.Add(failureDelay(t.Failures, cfg.MaxDelay)).Sub(now); d > wait {
+			wait = d
+		}
+	}
+	return wait, locked
+}
+
+// RecordLoginFailure increments the username and IP counters and returns the
+// keys that became locked by this failure.
+func RecordLoginFailure(username, ip string) []string {
+	cfg := LoadThrottleConfig()
+	var lockedKeys []string
+
+	limits := map[string]int{
+		UserThrottleKey(username): cfg.MaxUserFailures,
+		IPThrottleKey(ip):         cfg.MaxIPFailures,
+	}
+	for key, max := range limits {
+		locked, err := recordFailure(key, max, cfg)
+		if err != nil {
+			log.Printf("Failed to record login failure for %s: %v", key, err)
+			continue
+		}
+		if locked {
+			lockedKeys = append(lockedKeys, key)
+		}
+	}
+	return lockedKeys
+}
+
+// recordFailure counts a failure against key and locks it once the count
+// reaches max. Concurrent failures may all have passed CheckLogin, so the
+// counter is only changed with single statements: every failure is counted
+// and exactly one of them sets the lock.
+func recordFailure(key string, max int, cfg ThrottleConfig) (bool, error) {
+	now := time.Now()
+
+	// Start counting afresh once the window or a previous lock has passed.
+	err := database.DB.Model(&models.LoginThrottle{}).
+		Where("key = ? AND (last_failure_at < ? OR locked_until < ?)", key, now.Add(-cfg.FailureWindow), now).
+		Updates(map[string]interface{}{"failures": 0, "locked_until": nil}).Error
+	if err != nil {
+		return false, err
+	}
+
+	t := models.LoginThrottle{Key: key, Failures: 1, LastFailureAt: now}
+	err = database.DB.Clauses(
+		clause.OnConflict{
+			Columns: []clause.Column{{Name: "key"}},
+			DoUpdates: clause.Assignments(map[string]interface{}{
+				"failures":        gorm.Expr("failures + 1"),
+				"last_failure_at": now,
+			}),
+		},
+		clause.Returning{Columns: []clause.Column{{Name: "id"}, {Name: "failures"}}},
+	).Create(&t).Error
+	if err != nil {
+		return false, err
+	}
+	if max <= 0 || t.Failures < max {
+		return false, nil
+	}
+
+	until := now.Add(cfg.LockoutDuration)
+	res := database.DB.Model(&models.LoginThrottle{}).
+		Where("key = ? AND locked_until IS NULL", key).
+		Update("locked_until", until)
+	return res.RowsAffected == 1, res.Error
+}
+
+// ResetLoginFailures clears the counter for a username after a successful
+// login. IP counters are left to expire so that one valid account cannot be
+// used to reset a password-spraying client.
+func ResetLoginFailures(username string) {
+	database.DB.Where("key = ?", UserThrottleKey(username)).Delete(&models.LoginThrottle{})
+}
+
+// PurgeLoginThrottles removes entries that no longer affect logins.
+func PurgeLoginThrottles() error {
+	cfg := LoadThrottleConfig()
+	now := time.Now()
+	return database.DB.
+		Where("last_failure_at < ? AND (locked_until IS NULL OR locked_until < ?)", now.Add(-cfg.FailureWindow), now).
+		Delete(&models.LoginThrottle{}).Error
+}
+
+// failureDelay doubles the wait with every failure: 1s, 2s, 4s, ...
+func failureDelay(failures int, max time.Duration) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	if failures > 16 {
+		return max
+	}
+	d := time.Second << (failures - 1)
+	if d > max {
+		return max
+	}
+	return d
+}
+
+func envInt(name string, defaultValue int) int {
+	if v, err := strconv.Atoi(os.Getenv(name)); err == nil {
+		return v
+	}
+	return defaultValue
+}
+
+func envDuration(name string, defaultValue time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(name)); err == nil {
+		return v
+	}
+	return defaultValue
+}
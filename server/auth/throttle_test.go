@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/models"
+	"sync"
+	"testing"
+)
+
+// TestConcurrentLoginFailures sends a burst of failures that all passed
+// CheckLogin before any was recorded.
+func TestConcurrentLoginFailures(t *testing.T) {
+	testutil.SetupFileDB(t)
+	t.Setenv("LOGIN_MAX_FAILURES", "5")
+
+	const attempts = 20
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	locks := 0
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, key := range RecordLoginFailure("alice", "203.0.113.7") {
+				if key == UserThrottleKey("alice") {
+					mu.Lock()
+					locks++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	var throttle models.LoginThrottle
+	if err := database.DB.Where("key = ?", UserThrottleKey("alice")).First(&throttle).Error; err != nil {
+		t.Fatal(err)
+	}
+	if throttle.Failures != attempts {
+		t.Errorf("counted %d failures, want %d", throttle.Failures, attempts)
+	}
+	if locks != 1 || throttle.LockedUntil == nil {
+		t.Errorf("locked %d times, locked until %v; want exactly one lock", locks, throttle.LockedUntil)
+	}
+	if _, locked := CheckLogin("alice", "198.51.100.1"); !locked {
+		t.Error("username is not locked after the burst")
+	}
+}
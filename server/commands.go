@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/kms"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"log"
+	"os"
+	"time"
+)
+
+// runCommand runs a maintenance command instead of the server, e.g.
+// `kubeswitch-server rotate-keys`.
+func runCommand(args []string) {
+	switch args[0] {
+	case "rotate-keys":
+		database.Connect()
+		if err := kms.Configure(); err != nil {
+			log.Fatal("Failed to configure KMS: ", err)
+		}
+		if !kms.Enabled() {
+			log.Fatal("Set KMS_PROVIDER to the provider to encrypt with")
+		}
+		count, err := utils.ReencryptKubeconfigs(context.Background())
+		detail := fmt.Sprintf("Re-encrypted %d kubeconfigs", count)
+		if err != nil {
+			utils.LogAudit(0, "RotateKeys", detail+" before failing: "+err.Error(), "")
+			log.Fatalf("%s before failing: %v", detail, err)
+		}
+		utils.LogAudit(0, "RotateKeys", detail, "")
+		log.Print(detail)
+	case "mfa-enrollment-token":
+		// For the first admin once MFA is required, when nobody else can
+		// issue one.
+		if len(args) != 2 {
+			log.Fatal("Usage: kubeswitch-server mfa-enrollment-token <username>")
+		}
+		database.Connect()
+		var user models.User
+		if err := database.DB.Where("username = ?", args[1]).First(&user).Error; err != nil {
+			log.Fatalf("User %q not found", args[1])
+		}
+		if user.MFAEnabled {
+			log.Fatalf("User %q already uses MFA", args[1])
+		}
+		token, expiresAt, err := utils.IssueMFAEnrollmentToken(&user)
+		if err != nil {
+			log.Fatal("Failed to create enrolment token: ", err)
+		}
+		utils.LogAudit(0, "CreateMFAEnrollmentToken", "Issued an MFA enrolment token for user "+user.Username+" from the command line", "")
+		fmt.Printf("%s\n(valid until %s)\n", token, expiresAt.Format(time.RFC3339))
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\nCommands:\n"+
+			"  rotate-keys                      Re-encrypt all stored kubeconfigs with the current KMS key\n"+
+			"  mfa-enrollment-token <username>  Let the user enrol in MFA during their next login\n", args[0])
+		os.Exit(2)
+	}
+}
@@ -0,0 +1,246 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/policy"
+	"kubeswitch/server/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxAccessDuration caps how long a just-in-time grant can last.
+const maxAccessDuration = 7 * 24 * time.Hour
+
+type CreateAccessRequestInput struct {
+	Cluster  string `json:"cluster" binding:"required"` // Cluster name
+	Reason   string `json:"reason" binding:"required"`
+	Duration string `json:"duration" binding:"required"` // e.g. "4h"
+	Level    string `json:"level" binding:"omitempty,oneof=view edit admin"`
+}
+
+type ReviewAccessRequestInput struct {
+	Note string `json:"note"`
+}
+
+func CreateAccessRequest(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	var input CreateAccessRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	duration, err := time.ParseDuration(input.Duration)
+	if err != nil || duration < time.Minute || duration > maxAccessDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Duration must be between 1m and %s", maxAccessDuration)})
+		return
+	}
+
+	var cluster models.Cluster
+	if err := database.DB.Where("name = ?", input.Cluster).First(&cluster).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+	level := input.Level
+	if level == "" {
+		level = utils.LevelAdmin
+	}
+	if utils.HasCapability(c.GetString("role"), utils.CapKubeconfigRead) ||
+		utils.LevelAtLeast(utils.ClusterAccessLevel(userID, cluster.ID), level) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You already have this access to the cluster"})
+		return
+	}
+
+	var pending int64
+	database.DB.Model(&models.AccessRequest{}).
+		Where("user_id = ? AND cluster_id = ? AND status = ?", userID, cluster.ID, "pending").Count(&pending)
+	if pending > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You already have a pending request for this cluster"})
+		return
+	}
+
+	request := models.AccessRequest{
+		UserID:          userID,
+		ClusterID:       cluster.ID,
+		Level:           level,
+		Reason:          input.Reason,
+		DurationMinutes: int(duration / time.Minute),
+		Status:          "pending",
+	}
+	if err := database.DB.Create(&request).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create access request"})
+		return
+	}
+	request, _ = loadAccessRequest(request.ID)
+
+	summary := fmt.Sprintf("%s requests %s access to %s for %s: %s", request.User.Username, level, cluster.Name, duration, input.Reason)
+	utils.LogClusterAudit(c, cluster.ID, "RequestAccess", summary)
+	utils.Notify("access_request.created", summary, request)
+
+	c.JSON(http.StatusCreated, request)
+}
+
+// GetAccessRequests lists every request to reviewers, and to everyone else
+// their own requests and those for clusters they own. ?status= filters by
+// status.
+func GetAccessRequests(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	query := database.DB.Preload("User", utils.Unscoped).Preload("Cluster", utils.Unscoped).
+		Preload("Reviewer", utils.Unscoped).Order("created_at desc")
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if c.Query("mine") == "true" {
+		query = query.Where("user_id = ?", userID)
+	} else if !canReviewAccessRequests(c) {
+		// Owners review the requests for their own clusters
+		query = query.Where("user_id = ? OR cluster_id IN ?", userID, append(utils.OwnedClusterIDs(userID), 0))
+	}
+
+	requests := []models.AccessRequest{}
+	query.Find(&requests)
+	c.JSON(http.StatusOK, requests)
+}
+
+func ApproveAccessRequest(c *gin.Context) {
+	reviewAccessRequest(c, true)
+}
+
+func DenyAccessRequest(c *gin.Context) {
+	reviewAccessRequest(c, false)
+}
+
+// CancelAccessRequest withdraws the caller's own pending request.
+func CancelAccessRequest(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	request, ok := findAccessRequest(c)
+	if !ok {
+		return
+	}
+	if request.UserID != userID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only cancel your own requests"})
+		return
+	}
+	if request.Status != "pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only pending requests can be cancelled"})
+		return
+	}
+
+	if err := database.DB.Model(&request).Update("status", "cancelled").Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel request"})
+		return
+	}
+
+	utils.LogClusterAudit(c, request.ClusterID, "CancelAccessRequest", "Cancelled request for access to "+request.Cluster.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Request cancelled"})
+}
+
+func reviewAccessRequest(c *gin.Context, approve bool) {
+	reviewerID := c.MustGet("user_id").(uint)
+	var input ReviewAccessRequestInput
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	request, ok := findAccessRequest(c)
+	if !ok {
+		return
+	}
+	if !canReviewAccessRequests(c) && !utils.IsClusterOwner(reviewerID, request.ClusterID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not allowed to review access requests"})
+		return
+	}
+	if request.UserID == reviewerID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot review your own request"})
+		return
+	}
+	if request.Status != "pending" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Request is no longer pending"})
+		return
+	}
+
+	// Approving grants access, so it answers to admin policies like any
+	// other permission change, including for cluster owners.
+	if approve && !policy.Allow(c, policy.RequestInput(c, policy.ActionAdmin, &request.Cluster, request.Level)) {
+		return
+	}
+
+	now := time.Now()
+	status := "denied"
+	if approve {
+		status = "approved"
+	}
+
+	tx := database.DB.Begin()
+	if approve {
+		expiresAt := now.Add(time.Duration(request.DurationMinutes) * time.Minute)
+		perm := models.Permission{UserID: request.UserID, ClusterID: request.ClusterID, Level: request.Level, ExpiresAt: &expiresAt}
+		if err := tx.Create(&perm).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant access"})
+			return
+		}
+	}
+	// Only update a request that is still pending, so two reviewers racing
+	// cannot both act on it.
+	result := tx.Model(&models.AccessRequest{}).Where("id = ? AND status = ?", request.ID, "pending").Updates(map[string]interface{}{
+		"status":      status,
+		"reviewer_id": reviewerID,
+		"review_note": input.Note,
+		"reviewed_at": now,
+	})
+	if result.Error != nil || result.RowsAffected == 0 {
+		tx.Rollback()
+		c.JSON(http.StatusConflict, gin.H{"error": "Request is no longer pending"})
+		return
+	}
+	tx.Commit()
+
+	var summary string
+	if approve {
+		summary = fmt.Sprintf("Approved %s access of %s to %s for %s", request.Level, request.User.Username, request.Cluster.Name,
+			time.Duration(request.DurationMinutes)*time.Minute)
+		utils.LogClusterAudit(c, request.ClusterID, "ApproveAccessRequest", summary)
+	} else {
+		summary = fmt.Sprintf("Denied access of %s to %s", request.User.Username, request.Cluster.Name)
+		utils.LogClusterAudit(c, request.ClusterID, "DenyAccessRequest", summary)
+	}
+	if input.Note != "" {
+		summary += ": " + input.Note
+	}
+
+	request, _ = loadAccessRequest(request.ID)
+	utils.Notify("access_request."+status, summary, request)
+	c.JSON(http.StatusOK, request)
+}
+
+// canReviewAccessRequests reports whether the caller may approve or deny
+// access requests.
+func canReviewAccessRequests(c *gin.Context) bool {
+	return utils.HasCapability(c.GetString("role"), utils.CapAccessRequestsReview)
+}
+
+func findAccessRequest(c *gin.Context) (models.AccessRequest, bool) {
+	var request models.AccessRequest
+	if err := database.DB.Preload("User", utils.Unscoped).Preload("Cluster", utils.Unscoped).
+		First(&request, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Access request not found"})
+		return request, false
+	}
+	return request, true
+}
+
+func loadAccessRequest(id uint) (models.AccessRequest, error) {
+	var request models.AccessRequest
+	err := database.DB.Preload("User", utils.Unscoped).Preload("Cluster", utils.Unscoped).
+		Preload("Reviewer", utils.Unscoped).First(&request, id).Error
+	return request, err
+}
@@ -0,0 +1,47 @@
+package controllers
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"net/http"
+	"testing"
+)
+
+// TestApprovalFollowsAdminPolicies checks that a cluster owner, who reviews
+// requests without the reviewer capability, cannot approve past a policy.
+func TestApprovalFollowsAdminPolicies(t *testing.T) {
+	setupTestDB(t)
+	owner := createUser(t, "olivia", "user")
+	alice := createUser(t, "alice", "user")
+	cluster := createCluster(t, "prod")
+	database.DB.Create(&models.ClusterOwner{ClusterID: cluster.ID, UserID: &owner.ID})
+
+	var requests []models.AccessRequest
+	for i := 0; i < 2; i++ {
+		request := models.AccessRequest{UserID: alice.ID, ClusterID: cluster.ID, Level: "admin", DurationMinutes: 60, Status: "pending"}
+		database.DB.Create(&request)
+		requests = append(requests, request)
+	}
+	database.DB.Create(&models.Policy{Name: "no-prod-grants", Action: "admin", Condition: `cluster.name == "prod"`})
+
+	r := testRouter(owner)
+	r.POST("/access-requests/:id/approve", ApproveAccessRequest)
+	r.POST("/access-requests/:id/deny", DenyAccessRequest)
+
+	w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/access-requests/%d/approve", requests[0].ID), nil)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("approve: status %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+	}
+	var granted int64
+	database.DB.Model(&models.Permission{}).Where("user_id = ?", alice.ID).Count(&granted)
+	if granted != 0 {
+		t.Errorf("%d permissions granted despite the policy", granted)
+	}
+
+	// Denying grants nothing and is still allowed.
+	w = doJSON(t, r, http.MethodPost, fmt.Sprintf("/access-requests/%d/deny", requests[1].ID), nil)
+	if w.Code != http.StatusOK {
+		t.Errorf("deny: status %d: %s", w.Code, w.Body)
+	}
+}
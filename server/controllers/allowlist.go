@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AllowlistInput replaces a source-IP allowlist. Entries are CIDR blocks or
+// single addresses; an empty list removes the restriction.
+type AllowlistInput struct {
+	AllowedCIDRs []string `json:"allowed_cidrs"`
+}
+
+// bindAllowlist parses and normalises the request body.
+func bindAllowlist(c *gin.Context) ([]string, bool) {
+	var input AllowlistInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	cidrs, err := utils.NormalizeCIDRs(input.AllowedCIDRs)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return cidrs, true
+}
+
+// checkSelfLockout rejects an allowlist that would block the caller's own
+// next request.
+func checkSelfLockout(c *gin.Context, cidrs []string) bool {
+	if !utils.IPInCIDRs(c.ClientIP(), cidrs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The allowlist does not include your current address " + c.ClientIP()})
+		return false
+	}
+	return true
+}
+
+func formatAllowlist(cidrs []string) string {
+	if len(cidrs) == 0 {
+		return "any address"
+	}
+	return strings.Join(cidrs, ", ")
+}
+
+func SetUserAllowlist(c *gin.Context) {
+	cidrs, ok := bindAllowlist(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+	if user.ID == c.GetUint("user_id") && !checkSelfLockout(c, cidrs) {
+		return
+	}
+
+	user.AllowedCIDRs = cidrs
+	if err := database.DB.Model(&user).Select("allowed_cidrs").Updates(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update allowlist"})
+		return
+	}
+
+	utils.LogAuditContext(c, "SetUserAllowlist", "Allowed user "+user.Username+" to connect from "+formatAllowlist(cidrs))
+	c.JSON(http.StatusOK, user)
+}
+
+func SetGroupAllowlist(c *gin.Context) {
+	cidrs, ok := bindAllowlist(c)
+	if !ok {
+		return
+	}
+
+	group, ok := findGroup(c)
+	if !ok {
+		return
+	}
+	var members int64
+	database.DB.Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", group.ID, c.GetUint("user_id")).Count(&members)
+	if members > 0 && !checkSelfLockout(c, cidrs) {
+		return
+	}
+
+	group.AllowedCIDRs = cidrs
+	if err := database.DB.Model(&group).Select("allowed_cidrs").Updates(&group).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update allowlist"})
+		return
+	}
+
+	utils.LogAuditContext(c, "SetGroupAllowlist", "Allowed members of group "+group.Name+" to connect from "+formatAllowlist(cidrs))
+	c.JSON(http.StatusOK, group)
+}
+
+// SetClusterAllowlist restricts where the cluster's kubeconfig can be
+// downloaded from, e.g. production only from corporate networks.
+func SetClusterAllowlist(c *gin.Context) {
+	cidrs, ok := bindAllowlist(c)
+	if !ok {
+		return
+	}
+
+	cluster, ok := findCluster(c)
+	if !ok {
+		return
+	}
+
+	cluster.AllowedCIDRs = cidrs
+	if err := database.DB.Model(&cluster).Select("allowed_cidrs").Updates(&cluster).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update allowlist"})
+		return
+	}
+
+	utils.LogClusterAudit(c, cluster.ID, "SetClusterAllowlist", "Allowed config downloads for "+cluster.Name+" from "+formatAllowlist(cidrs))
+	c.JSON(http.StatusOK, cluster)
+}
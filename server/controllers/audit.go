@@ -8,8 +8,14 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// GetAuditLogs lists the audit trail, newest first. ?severity=high returns
+// only entries that need review, such as break-glass access.
 func GetAuditLogs(c *gin.Context) {
 	var logs []models.AuditLog
-	database.DB.Preload("User").Order("created_at desc").Find(&logs)
+	query := database.DB.Preload("User").Order("created_at desc")
+	if severity := c.Query("severity"); severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
+	query.Find(&logs)
 	c.JSON(http.StatusOK, logs)
 }
@@ -1,10 +1,15 @@
 package controllers
 
 import (
+	"errors"
+	"kubeswitch/server/auth"
 	"kubeswitch/server/database"
 	"kubeswitch/server/models"
 	"kubeswitch/server/utils"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,30 +26,160 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	var user models.User
-	if err := database.DB.Where("username = ?", input.Username).First(&user).Error; err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	if !checkLoginThrottle(c, input.Username) {
 		return
 	}
 
-	if !utils.CheckPasswordHash(input.Password, user.Password) {
+	user, err := auth.Authenticate(input.Username, input.Password)
+	if err != nil {
+		recordLoginFailure(c, input.Username, "invalid credentials")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	token, err := utils.GenerateToken(user.ID, user.Username, user.Role)
+	// Password accepted; the second factor is checked by LoginMFA.
+	if user.MFAEnabled || mfaRequired(user) {
+		mfaToken, err := utils.GenerateMFAToken(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"mfa_required": true,
+			"mfa_enrolled": user.MFAEnabled,
+			"mfa_token":    mfaToken,
+		})
+		return
+	}
+
+	tokens, err := createTokens(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
 		return
 	}
 
+	auth.ResetLoginFailures(input.Username)
 	utils.LogAudit(user.ID, "Login", "User logged in", c.ClientIP())
 
-	c.JSON(http.StatusOK, gin.H{"token": token, "role": user.Role})
+	c.JSON(http.StatusOK, tokens)
+}
+
+// checkLoginThrottle rejects the attempt with 429 while the username or
+// client IP is locked out or still inside its progressive delay.
+func checkLoginThrottle(c *gin.Context, username string) bool {
+	wait, locked := auth.CheckLogin(username, c.ClientIP())
+	if wait <= 0 {
+		return true
+	}
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	if locked {
+		utils.LogAudit(lookupUserID(username), "LoginBlocked", "Login attempt for "+username+" rejected while locked", c.ClientIP())
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, account temporarily locked", "retry_after": seconds})
+	} else {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed attempts, try again later", "retry_after": seconds})
+	}
+	return false
+}
+
+// recordLoginFailure audits a failed attempt and any lockout it triggers.
+func recordLoginFailure(c *gin.Context, username, reason string) {
+	userID := lookupUserID(username)
+	utils.LogAudit(userID, "LoginFailed", "Failed login for "+username+": "+reason, c.ClientIP())
+	for _, key := range auth.RecordLoginFailure(username, c.ClientIP()) {
+		utils.LogAudit(userID, "AccountLocked", "Locked "+key+" after repeated login failures", c.ClientIP())
+	}
+}
+
+func lookupUserID(username string) uint {
+	var user models.User
+	database.DB.Select("id").Where("username = ?", username).First(&user)
+	return user.ID
+}
+
+// createTokens starts a new session for the user and returns an access token
+// together with the session's first refresh token.
+func createTokens(c *gin.Context, user models.User) (gin.H, error) {
+	session, refreshToken, err := utils.CreateSession(user.ID, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := utils.GenerateToken(user, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":                    token,
+		"refresh_token":            refreshToken,
+		"expires_in":               int(utils.AccessTokenTTL.Seconds()),
+		"role":                     user.Role,
+		"capabilities":             utils.EffectiveCapabilities(user.Role),
+		"password_change_required": utils.PasswordExpired(user),
+	}, nil
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+func Refresh(c *gin.Context) {
+	var input RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	session, refreshToken, err := utils.RotateRefreshToken(input.RefreshToken, c.ClientIP())
+	if err != nil {
+		if errors.Is(err, utils.ErrRefreshTokenReused) {
+			utils.LogAudit(session.UserID, "RefreshTokenReuse", "Refresh token reused, session revoked", c.ClientIP())
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, session.UserID).Error; err != nil {
+		utils.RevokeSession(session.ID)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	token, err := utils.GenerateToken(user, session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"token":                    token,
+		"refresh_token":            refreshToken,
+		"expires_in":               int(utils.AccessTokenTTL.Seconds()),
+		"role":                     user.Role,
+		"capabilities":             utils.EffectiveCapabilities(user.Role),
+		"password_change_required": utils.PasswordExpired(user),
+	})
 }
 
 func Logout(c *gin.Context) {
 	userID := c.MustGet("user_id").(uint)
+
+	if jti := c.GetString("jti"); jti != "" {
+		if err := utils.RevokeToken(jti, c.MustGet("token_exp").(time.Time)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+			return
+		}
+	}
+	if sessionID := c.GetUint("session_id"); sessionID != 0 {
+		if err := utils.RevokeSession(sessionID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+	}
+
 	utils.LogAudit(userID, "Logout", "User logged out", c.ClientIP())
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
 }
@@ -56,5 +191,17 @@ func GetCurrentUser(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"username": user.Username, "role": user.Role})
+	c.JSON(http.StatusOK, gin.H{
+		"id":           user.ID,
+		"username":     user.Username,
+		"role":         user.Role,
+		"capabilities": utils.EffectiveCapabilities(user.Role),
+	})
+}
+
+// GetJWKS publishes the keys that verify access tokens, so other services can
+// validate them without sharing a secret.
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.JWKS())
 }
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultBreakGlassDuration = time.Hour
+	maxBreakGlassDuration     = 4 * time.Hour
+	minBreakGlassReason       = 10 // Characters, so "incident" alone is not enough
+)
+
+type BreakGlassInput struct {
+	Reason   string `json:"reason" binding:"required"`
+	Duration string `json:"duration"` // Defaults to 1h
+	Level    string `json:"level" binding:"omitempty,oneof=view edit admin"`
+}
+
+// BreakGlass grants the caller immediate, short-lived access to a cluster
+// during an incident, without waiting for approval. Every use raises a
+// high-severity audit event and a notification.
+func BreakGlass(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	var input BreakGlassInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	reason := strings.TrimSpace(input.Reason)
+	if len([]rune(reason)) < minBreakGlassReason {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Reason must be at least %d characters", minBreakGlassReason)})
+		return
+	}
+	duration := defaultBreakGlassDuration
+	if input.Duration != "" {
+		var err error
+		duration, err = time.ParseDuration(input.Duration)
+		if err != nil || duration < time.Minute || duration > maxBreakGlassDuration {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Duration must be between 1m and %s", maxBreakGlassDuration)})
+			return
+		}
+	}
+	level := input.Level
+	if level == "" {
+		level = utils.LevelAdmin
+	}
+
+	cluster, ok := findCluster(c)
+	if !ok {
+		return
+	}
+	if utils.LevelAtLeast(utils.ClusterAccessLevel(userID, cluster.ID), level) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":      "You already have this access to the cluster",
+			"has_access": true,
+		})
+		return
+	}
+
+	expiresAt := time.Now().Add(duration)
+	perm := models.Permission{UserID: userID, ClusterID: cluster.ID, Level: level, ExpiresAt: &expiresAt, BreakGlass: true}
+	if err := database.DB.Create(&perm).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to grant access"})
+		return
+	}
+
+	summary := fmt.Sprintf("BREAK-GLASS: %s granted themselves %s access to %s for %s: %s",
+		c.GetString("username"), level, cluster.Name, duration, reason)
+	utils.LogClusterAlert(c, cluster.ID, "BreakGlass", summary)
+	utils.Notify("break_glass", summary, gin.H{
+		"severity":   utils.SeverityHigh,
+		"user":       c.GetString("username"),
+		"cluster":    cluster.Name,
+		"level":      level,
+		"reason":     reason,
+		"expires_at": expiresAt,
+		"ip":         c.ClientIP(),
+	})
+
+	c.JSON(http.StatusCreated, gin.H{"cluster_id": cluster.ID, "level": level, "expires_at": expiresAt})
+}
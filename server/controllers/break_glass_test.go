@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func createBreakGlass(t *testing.T, user models.User, cluster models.Cluster, expiresAt time.Time) models.Permission {
+	t.Helper()
+	perm := models.Permission{UserID: user.ID, ClusterID: cluster.ID, Level: "admin", ExpiresAt: &expiresAt, BreakGlass: true}
+	if err := database.DB.Create(&perm).Error; err != nil {
+		t.Fatalf("create break-glass grant: %v", err)
+	}
+	return perm
+}
+
+// assertOnlyBreakGlass checks that the user's only grant on the cluster is
+// the untouched break-glass one.
+func assertOnlyBreakGlass(t *testing.T, want models.Permission) {
+	t.Helper()
+	var perms []models.Permission
+	database.DB.Where("user_id = ? AND cluster_id = ?", want.UserID, want.ClusterID).Find(&perms)
+	if len(perms) != 1 {
+		t.Fatalf("got %d grants, want only the break-glass grant", len(perms))
+	}
+	if got := perms[0]; got.ID != want.ID || !got.BreakGlass || !got.ExpiresAt.Equal(*want.ExpiresAt) {
+		t.Errorf("break-glass grant changed: got %+v, want %+v", got, want)
+	}
+}
+
+func TestSetClusterPermissionsKeepsBreakGlass(t *testing.T) {
+	setupTestDB(t)
+	admin := createUser(t, "admin", "admin")
+	responder := createUser(t, "responder", "user")
+	other := createUser(t, "other", "user")
+	cluster := createCluster(t, "prod")
+	breakGlass := createBreakGlass(t, responder, cluster, time.Now().Add(time.Hour))
+
+	r := testRouter(admin)
+	r.POST("/clusters/:id/permissions", SetClusterPermissions)
+	w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/clusters/%d/permissions", cluster.ID), map[string]interface{}{
+		"grants": []map[string]interface{}{{"user_id": other.ID, "level": "view"}},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	assertOnlyBreakGlass(t, breakGlass)
+	var count int64
+	database.DB.Model(&models.Permission{}).Where("user_id = ? AND cluster_id = ? AND level = ?", other.ID, cluster.ID, "view").Count(&count)
+	if count != 1 {
+		t.Errorf("new grant was not stored")
+	}
+}
+
+func TestSetUserPermissionsKeepsBreakGlass(t *testing.T) {
+	setupTestDB(t)
+	admin := createUser(t, "admin", "admin")
+	responder := createUser(t, "responder", "user")
+	prod := createCluster(t, "prod")
+	staging := createCluster(t, "staging")
+	breakGlass := createBreakGlass(t, responder, prod, time.Now().Add(time.Hour))
+
+	r := testRouter(admin)
+	r.POST("/users/:id/permissions", SetUserPermissions)
+	w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/users/%d/permissions", responder.ID), map[string]interface{}{
+		"cluster_ids": []uint{staging.ID},
+	})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	assertOnlyBreakGlass(t, breakGlass)
+}
+
+func TestBreakGlassExpiry(t *testing.T) {
+	setupTestDB(t)
+	responder := createUser(t, "responder", "user")
+	cluster := createCluster(t, "prod")
+
+	r := testRouter(responder)
+	r.POST("/clusters/:id/break-glass", BreakGlass)
+	path := fmt.Sprintf("/clusters/%d/break-glass", cluster.ID)
+
+	w := doJSON(t, r, http.MethodPost, path, map[string]string{"reason": "INC-42 database down", "duration": "5h"})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("duration over the maximum: status %d, want 400", w.Code)
+	}
+
+	before := time.Now()
+	w = doJSON(t, r, http.MethodPost, path, map[string]string{"reason": "INC-42 database down", "duration": "30m"})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+	var perm models.Permission
+	if err := database.DB.Where("user_id = ? AND cluster_id = ? AND break_glass = ?", responder.ID, cluster.ID, true).First(&perm).Error; err != nil {
+		t.Fatalf("break-glass grant not stored: %v", err)
+	}
+	if perm.ExpiresAt == nil || perm.ExpiresAt.Before(before.Add(30*time.Minute)) || perm.ExpiresAt.After(time.Now().Add(30*time.Minute)) {
+		t.Fatalf("expires_at = %v, want 30m from now", perm.ExpiresAt)
+	}
+	if !utils.HasBreakGlassAccess(responder.ID, cluster.ID) || utils.ClusterAccessLevel(responder.ID, cluster.ID) != utils.LevelAdmin {
+		t.Fatal("break-glass grant is not active")
+	}
+
+	w = doJSON(t, r, http.MethodPost, path, map[string]string{"reason": "INC-42 database down"})
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"has_access":true`) {
+		t.Fatalf("repeated break-glass: status %d: %s", w.Code, w.Body)
+	}
+
+	expired := time.Now().Add(-time.Second)
+	database.DB.Model(&perm).Update("expires_at", expired)
+	if utils.HasBreakGlassAccess(responder.ID, cluster.ID) || utils.CanAccessCluster(responder.ID, cluster.ID) {
+		t.Fatal("expired break-glass grant still gives access")
+	}
+
+	if err := utils.PurgeExpiredPermissions(); err != nil {
+		t.Fatal(err)
+	}
+	var remaining int64
+	database.DB.Model(&models.Permission{}).Where("user_id = ?", responder.ID).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("expired break-glass grant was not purged")
+	}
+	var logged int64
+	database.DB.Model(&models.AuditLog{}).Where("user_id = 0 AND actor = ? AND cluster_id = ? AND action = ? AND detail LIKE ?",
+		utils.SystemActor, cluster.ID, "PermissionExpired", "%"+responder.Username+"%").Count(&logged)
+	if logged != 1 {
+		t.Errorf("expiry was not audited")
+	}
+}
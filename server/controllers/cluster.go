@@ -1,18 +1,24 @@
 package controllers
 
 import (
+	"fmt"
 	"kubeswitch/server/database"
+	"kubeswitch/server/kms"
 	"kubeswitch/server/models"
+	"kubeswitch/server/policy"
 	"kubeswitch/server/utils"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 type CreateClusterInput struct {
-	Name        string `json:"name" binding:"required"`
-	Kubeconfig  string `json:"kubeconfig" binding:"required"`
-	Description string `json:"description"`
+	Name        string            `json:"name" binding:"required"`
+	Kubeconfig  string            `json:"kubeconfig" binding:"required"`
+	Description string            `json:"description"`
+	Labels      map[string]string `json:"labels"`
 }
 
 func CreateCluster(c *gin.Context) {
@@ -21,47 +27,133 @@ func CreateCluster(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := utils.ValidateClusterLabels(input.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	kubeconfig, info, ok := prepareKubeconfig(c, input.Kubeconfig)
+	if !ok {
+		return
+	}
 
+	// Selector grants apply to the new cluster as soon as it exists
 	cluster := models.Cluster{
-		Name:        input.Name,
-		Kubeconfig:  input.Kubeconfig,
-		Description: input.Description,
+		Name:           input.Name,
+		KubeconfigInfo: &info,
+		Description:    input.Description,
+		Labels:         input.Labels,
 	}
 
+	// The kubeconfig is encrypted for the cluster's ID, which is only known
+	// once the row exists. Sealing may call out to the KMS, so it happens
+	// after the insert has committed rather than inside a transaction; until
+	// then the cluster has no kubeconfig to serve.
 	if err := database.DB.Create(&cluster).Error; err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to create cluster"})
 		return
 	}
+	sealed, ok := sealKubeconfig(c, cluster.ID, utils.LevelAdmin, kubeconfig)
+	if ok {
+		if err := database.DB.Model(&cluster).UpdateColumn("kubeconfig", sealed).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create cluster"})
+			ok = false
+		}
+	}
+	if !ok {
+		// Hard delete, so the name can be used again
+		if err := database.DB.Unscoped().Delete(&cluster).Error; err != nil {
+			log.Println("Failed to remove cluster "+cluster.Name+" after a failed create:", err)
+		}
+		return
+	}
 
-	userID := c.MustGet("user_id").(uint)
-	utils.LogAudit(userID, "CreateCluster", "Created cluster "+cluster.Name, c.ClientIP())
+	utils.LogClusterAudit(c, cluster.ID, "CreateCluster", "Created cluster "+cluster.Name)
 
 	c.JSON(http.StatusCreated, cluster)
 }
 
+// prepareKubeconfig validates and normalises a posted kubeconfig, responding
+// with the problems found per field if it is unusable.
+func prepareKubeconfig(c *gin.Context, raw string) (string, models.KubeconfigInfo, bool) {
+	kubeconfig, info, errs := utils.ParseKubeconfig(raw)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid kubeconfig", "errors": errs})
+		return "", info, false
+	}
+	return kubeconfig, info, true
+}
+
+// sealKubeconfig encrypts the kubeconfig a cluster serves at level for
+// storage.
+func sealKubeconfig(c *gin.Context, clusterID uint, level, kubeconfig string) (string, bool) {
+	sealed, err := kms.Seal(c.Request.Context(), kubeconfig, kms.KubeconfigAAD(clusterID, level))
+	if err != nil {
+		log.Println("Failed to encrypt kubeconfig:", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encrypt kubeconfig"})
+		return "", false
+	}
+	return sealed, true
+}
+
 func GetClusters(c *gin.Context) {
 	role := c.MustGet("role").(string)
 	userID := c.MustGet("user_id").(uint)
 
 	var clusters []models.Cluster
+	readAll := utils.HasCapability(role, utils.CapKubeconfigRead)
+
+	// ?selector=env=prod,team!=payments narrows the list, e.g. to preview a
+	// selector grant
+	selector := labels.Everything()
+	if query := c.Query("selector"); query != "" {
+		parsed, err := labels.Parse(query)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid selector: " + err.Error()})
+			return
+		}
+		selector = parsed
+	}
 
-	if role == "admin" {
+	// Everyone who hands out or restricts cluster access, or may break the
+	// glass on it, needs to see every cluster
+	if readAll || utils.HasCapability(role, utils.CapClustersList, utils.CapPermissionsManage, utils.CapGroupsManage,
+		utils.CapPoliciesManage, utils.CapBreakGlass) {
 		database.DB.Find(&clusters)
 	} else {
-		// Find clusters where user has permission
-		var permissions []models.Permission
-		database.DB.Where("user_id = ?", userID).Find(&permissions)
-		
-		var clusterIDs []uint
-		for _, p := range permissions {
-			clusterIDs = append(clusterIDs, p.ClusterID)
-		}
-
+		// Find clusters the user has access to, directly or via a group,
+		// or owns
+		clusterIDs := append(utils.AccessibleClusterIDs(userID), utils.OwnedClusterIDs(userID)...)
 		if len(clusterIDs) > 0 {
 			database.DB.Where("id IN ?", clusterIDs).Find(&clusters)
 		}
 	}
 
+	matching := clusters[:0]
+	for _, cluster := range clusters {
+		if utils.MatchesLabels(selector, cluster.Labels) {
+			matching = append(matching, cluster)
+		}
+	}
+	clusters = matching
+
+	// Owned clusters are listed so that owners can manage them, but owning
+	// a cluster grants no access level: as in GetClusterConfig, only grants
+	// and the kubeconfig:read capability do.
+	granted := utils.ClusterAccessLevels(userID)
+	owned := make(map[uint]bool)
+	for _, id := range utils.OwnedClusterIDs(userID) {
+		owned[id] = true
+	}
+	levels := utils.ClusterLevels(clusters)
+	for i := range clusters {
+		clusters[i].Levels = levels[clusters[i].ID]
+		clusters[i].AccessLevel = granted[clusters[i].ID]
+		clusters[i].Owned = owned[clusters[i].ID]
+		if readAll {
+			clusters[i].AccessLevel = utils.LevelAdmin
+		}
+	}
+
 	c.JSON(http.StatusOK, clusters)
 }
 
@@ -70,46 +162,133 @@ func GetClusterConfig(c *gin.Context) {
 	userID := c.MustGet("user_id").(uint)
 	role := c.MustGet("role").(string)
 
-	// Check permission
-	if role != "admin" {
-		var perm models.Permission
-		if err := database.DB.Where("user_id = ? AND cluster_id = ?", userID, clusterID).First(&perm).Error; err != nil {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-			return
+	var cluster models.Cluster
+	found := database.DB.First(&cluster, clusterID).Error == nil
+
+	level := utils.LevelAdmin
+	if !utils.HasCapability(role, utils.CapKubeconfigRead) {
+		level = ""
+		if found {
+			level = utils.ClusterAccessLevel(userID, cluster.ID)
 		}
 	}
 
-	var cluster models.Cluster
-	if err := database.DB.First(&cluster, clusterID).Error; err != nil {
+	// Check permission before revealing whether the cluster exists
+	if level == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return
+	}
+	if !found {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
 		return
 	}
+	// The cluster allowlist applies to everyone, including administrators
+	if ip := c.ClientIP(); !utils.IPInCIDRs(ip, cluster.AllowedCIDRs) {
+		utils.LogClusterAudit(c, cluster.ID, "IPDenied", "Config download for "+cluster.Name+" from "+ip+" rejected by cluster allowlist")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Downloads of this cluster's kubeconfig are not allowed from " + ip})
+		return
+	}
+
+	// Callers may ask for a lower level than they hold, e.g. a read-only
+	// kubeconfig for dashboards.
+	if requested := c.Query("level"); requested != "" {
+		if !utils.IsValidAccessLevel(requested) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid access level"})
+			return
+		}
+		if !utils.LevelAtLeast(level, requested) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access level not granted"})
+			return
+		}
+		level = requested
+	}
+
+	kubeconfig, served, ok := utils.ClusterKubeconfig(cluster, level)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No kubeconfig is configured for your access level"})
+		return
+	}
+	in := policy.RequestInput(c, policy.ActionKubeconfig, &cluster, served)
+	in.BreakGlass = utils.HasBreakGlassAccess(userID, cluster.ID)
+	if !policy.Allow(c, in) {
+		return
+	}
+	kubeconfig, err := kms.Open(c.Request.Context(), kubeconfig, kms.KubeconfigAAD(cluster.ID, served))
+	if err != nil {
+		log.Println("Failed to decrypt kubeconfig of cluster "+cluster.Name+":", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decrypt kubeconfig"})
+		return
+	}
 
-	utils.LogAudit(userID, "GetConfig", "Retrieved config for "+cluster.Name, c.ClientIP())
+	// Downloads under break-glass access are flagged for review as well
+	if in.BreakGlass {
+		utils.LogClusterAlert(c, cluster.ID, "GetConfig", "Retrieved "+served+" config for "+cluster.Name+" with break-glass access")
+	} else {
+		utils.LogClusterAudit(c, cluster.ID, "GetConfig", "Retrieved "+served+" config for "+cluster.Name)
+	}
 
-	c.JSON(http.StatusOK, gin.H{"kubeconfig": cluster.Kubeconfig})
+	c.JSON(http.StatusOK, gin.H{"kubeconfig": kubeconfig, "level": served})
 }
 
 func DeleteCluster(c *gin.Context) {
-	clusterID := c.Param("id")
-	
-	if err := database.DB.Delete(&models.Cluster{}, clusterID).Error; err != nil {
+	cluster, ok := findCluster(c)
+	if !ok {
+		return
+	}
+
+	// Grants, owners and kubeconfig variants go with the cluster; pending
+	// requests for it can no longer be approved.
+	tx := database.DB.Begin()
+	if err := tx.Where("cluster_id = ?", cluster.ID).Delete(&models.Permission{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cluster permissions"})
+		return
+	}
+	if err := tx.Where("cluster_id = ?", cluster.ID).Delete(&models.GroupPermission{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cluster permissions"})
+		return
+	}
+	if err := tx.Where("cluster_id = ?", cluster.ID).Delete(&models.ClusterOwner{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cluster ownership"})
+		return
+	}
+	if err := tx.Where("cluster_id = ?", cluster.ID).Delete(&models.ClusterCredential{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cluster kubeconfigs"})
+		return
+	}
+	if err := tx.Model(&models.AccessRequest{}).Where("cluster_id = ? AND status = ?", cluster.ID, "pending").
+		Update("status", "cancelled").Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel access requests"})
+		return
+	}
+	if err := tx.Delete(&cluster).Error; err != nil {
+		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cluster"})
 		return
 	}
+	tx.Commit()
 
-	userID := c.MustGet("user_id").(uint)
-	utils.LogAudit(userID, "DeleteCluster", "Deleted cluster "+clusterID, c.ClientIP())
+	utils.LogClusterAudit(c, cluster.ID, "DeleteCluster", "Deleted cluster "+cluster.Name)
 
 	c.JSON(http.StatusOK, gin.H{"message": "Cluster deleted"})
 }
 
+// SetClusterPermissionsInput replaces who can access a cluster. Users in
+// UserIDs are granted without a time limit; Grants may carry a window.
 type SetClusterPermissionsInput struct {
-	UserIDs []uint `json:"user_ids" binding:"required"`
+	UserIDs []uint           `json:"user_ids"`
+	Grants  []UserGrantInput `json:"grants" binding:"dive"`
 }
 
+// ImportKubeconfigInput replaces the kubeconfig served at Level, which
+// defaults to admin (the cluster's own kubeconfig).
 type ImportKubeconfigInput struct {
 	Kubeconfig string `json:"kubeconfig" binding:"required"`
+	Level      string `json:"level" binding:"omitempty,oneof=view edit admin"`
 }
 
 func SetClusterPermissions(c *gin.Context) {
@@ -119,6 +298,16 @@ func SetClusterPermissions(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.UserIDs == nil && input.Grants == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_ids or grants is required"})
+		return
+	}
+	for _, grant := range input.Grants {
+		if err := grant.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	var cluster models.Cluster
 	if err := database.DB.First(&cluster, clusterID).Error; err != nil {
@@ -126,23 +315,36 @@ func SetClusterPermissions(c *gin.Context) {
 		return
 	}
 
+	var previous []models.Permission
+	database.DB.Where("cluster_id = ? AND break_glass IS NOT ?", cluster.ID, true).Order("id").Find(&previous)
+
 	// Transaction to update permissions
 	tx := database.DB.Begin()
-	
-	// Remove existing permissions for this cluster
-	if err := tx.Where("cluster_id = ?", cluster.ID).Delete(&models.Permission{}).Error; err != nil {
+
+	// Remove existing permissions for this cluster. Break-glass grants are
+	// kept until they expire so that they cannot be hidden by an edit.
+	if err := tx.Where("cluster_id = ? AND break_glass IS NOT ?", cluster.ID, true).Delete(&models.Permission{}).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear permissions"})
 		return
 	}
 
 	// Add new permissions
+	perms := make([]models.Permission, 0, len(input.UserIDs)+len(input.Grants))
 	for _, userID := range input.UserIDs {
-		perm := models.Permission{
-			UserID:    userID,
+		perms = append(perms, models.Permission{UserID: userID, ClusterID: cluster.ID})
+	}
+	for _, grant := range input.Grants {
+		perms = append(perms, models.Permission{
+			UserID:    grant.UserID,
 			ClusterID: cluster.ID,
-		}
-		if err := tx.Create(&perm).Error; err != nil {
+			Level:     grant.Level,
+			NotBefore: grant.NotBefore,
+			ExpiresAt: grant.ExpiresAt,
+		})
+	}
+	for i := range perms {
+		if err := tx.Create(&perms[i]).Error; err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add permission"})
 			return
@@ -150,6 +352,18 @@ func SetClusterPermissions(c *gin.Context) {
 	}
 
 	tx.Commit()
+
+	utils.LogClusterAudit(c, cluster.ID, "SetClusterPermissions", fmt.Sprintf("Changed access to cluster %s from %s to %s",
+		cluster.Name, formatPermissions(previous), formatPermissions(perms)))
+
+	// Owners, and administrators, may grant themselves access. That is
+	// allowed so they can download the kubeconfig, but flagged for review.
+	callerID := c.GetUint("user_id")
+	before, after := userPermissions(previous, callerID), userPermissions(perms, callerID)
+	if formatPermissions(before) != formatPermissions(after) {
+		utils.LogClusterAlert(c, cluster.ID, "SelfGrant", fmt.Sprintf("%s changed their own access to cluster %s from %s to %s",
+			c.GetString("username"), cluster.Name, formatPermissions(before), formatPermissions(after)))
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Permissions updated"})
 }
 
@@ -160,25 +374,19 @@ func GetClusterPermissions(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
 		return
 	}
-	
+
 	var userIDs []uint
+	grants := make([]map[string]interface{}, 0, len(perms))
 	for _, p := range perms {
 		userIDs = append(userIDs, p.UserID)
+		grants = append(grants, grantView(p))
 	}
-	
-	c.JSON(http.StatusOK, gin.H{"user_ids": userIDs})
+
+	c.JSON(http.StatusOK, gin.H{"user_ids": userIDs, "grants": grants})
 }
 
 func ImportKubeconfig(c *gin.Context) {
 	clusterID := c.Param("id")
-	userID := c.MustGet("user_id").(uint)
-	role := c.MustGet("role").(string)
-
-	// Only admin can import kubeconfig
-	if role != "admin" {
-		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
-		return
-	}
 
 	var input ImportKubeconfigInput
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -192,14 +400,66 @@ func ImportKubeconfig(c *gin.Context) {
 		return
 	}
 
+	level := input.Level
+	if level == "" {
+		level = utils.LevelAdmin
+	}
+	kubeconfig, info, ok := prepareKubeconfig(c, input.Kubeconfig)
+	if !ok {
+		return
+	}
+	kubeconfig, ok = sealKubeconfig(c, cluster.ID, level, kubeconfig)
+	if !ok {
+		return
+	}
+
 	// Update kubeconfig
-	cluster.Kubeconfig = input.Kubeconfig
-	if err := database.DB.Save(&cluster).Error; err != nil {
+	var err error
+	if level == utils.LevelAdmin {
+		cluster.Kubeconfig = kubeconfig
+		cluster.KubeconfigInfo = &info
+		err = database.DB.Save(&cluster).Error
+	} else {
+		credential := models.ClusterCredential{ClusterID: cluster.ID, Level: level}
+		err = database.DB.Where(credential).
+			Assign(models.ClusterCredential{Kubeconfig: kubeconfig, KubeconfigInfo: &info}).
+			FirstOrCreate(&credential).Error
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update kubeconfig"})
 		return
 	}
 
-	utils.LogAudit(userID, "ImportKubeconfig", "Imported kubeconfig for "+cluster.Name, c.ClientIP())
+	utils.LogClusterAudit(c, cluster.ID, "ImportKubeconfig", "Imported "+level+" kubeconfig for "+cluster.Name+" ("+info.Server+", "+info.AuthType+")")
+
+	c.JSON(http.StatusOK, gin.H{"message": "Kubeconfig imported successfully", "kubeconfig_info": info})
+}
+
+// DeleteClusterCredential removes a lower-level kubeconfig variant. Users
+// granted that level then receive the next lower variant, if any.
+func DeleteClusterCredential(c *gin.Context) {
+	level := c.Param("level")
+	if level == utils.LevelAdmin || !utils.IsValidAccessLevel(level) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Only view and edit kubeconfigs can be removed"})
+		return
+	}
+
+	var cluster models.Cluster
+	if err := database.DB.First(&cluster, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	result := database.DB.Where("cluster_id = ? AND level = ?", cluster.ID, level).Delete(&models.ClusterCredential{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete kubeconfig"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No kubeconfig for this level"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Kubeconfig imported successfully"})
+	utils.LogClusterAudit(c, cluster.ID, "DeleteKubeconfig", "Removed "+level+" kubeconfig of "+cluster.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Kubeconfig deleted"})
 }
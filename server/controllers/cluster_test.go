@@ -0,0 +1,307 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/kms"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+current-context: prod
+users:
+- name: admin
+  user:
+    token: very-secret
+`
+
+// enableLocalKMS encrypts kubeconfigs with a random local key for the
+// duration of the test.
+func enableLocalKMS(t *testing.T) {
+	t.Helper()
+	// Registered first so it runs after the environment has been restored
+	t.Cleanup(func() { kms.Configure() })
+
+	key := make([]byte, 32)
+	rand.Read(key)
+	path := filepath.Join(t.TempDir(), "kek")
+	if err := os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("KMS_PROVIDER", "local")
+	t.Setenv("KMS_LOCAL_KEY_FILE", path)
+	if err := kms.Configure(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestClusterCreateWithPassphraseKMS creates the first cluster with a
+// passphrase key, whose salt is stored in the database, against a file
+// database where a second connection would wait on the create transaction.
+func TestClusterCreateWithPassphraseKMS(t *testing.T) {
+	db, err := database.Open(filepath.Join(t.TempDir(), "kubeswitch.db") + "?_busy_timeout=1000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = previous
+	})
+	utils.SeedRoles()
+	admin := createUser(t, "admin", "admin")
+
+	t.Cleanup(func() { kms.Configure() })
+	t.Setenv("KMS_PROVIDER", "local")
+	t.Setenv("KMS_LOCAL_PASSPHRASE", "correct horse battery staple")
+	if err := kms.Configure(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := testRouter(admin)
+	r.POST("/clusters", CreateCluster)
+	r.GET("/clusters/:id/config", GetClusterConfig)
+
+	w := doJSON(t, r, http.MethodPost, "/clusters", map[string]string{"name": "prod", "kubeconfig": testKubeconfig})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", w.Code, w.Body)
+	}
+	var cluster models.Cluster
+	json.Unmarshal(w.Body.Bytes(), &cluster)
+
+	var stored models.Cluster
+	database.DB.First(&stored, cluster.ID)
+	if !kms.IsSealed(stored.Kubeconfig) {
+		t.Fatalf("kubeconfig stored in plaintext: %q", stored.Kubeconfig)
+	}
+	w = doJSON(t, r, http.MethodGet, fmt.Sprintf("/clusters/%d/config", cluster.ID), nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "very-secret") {
+		t.Fatalf("download: status %d: %s", w.Code, w.Body)
+	}
+}
+
+// TestClusterCreateSealFailure seals through a Vault stand-in that writes
+// to the database while the request is in flight, which would time out if
+// the create held the write lock, and then fails.
+func TestClusterCreateSealFailure(t *testing.T) {
+	testutil.SetupFileDB(t)
+	utils.SeedRoles()
+	admin := createUser(t, "admin", "admin")
+
+	var writeErr error
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeErr = database.DB.Create(&models.AuditLog{Action: "Test", Detail: "write while sealing"}).Error
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"Vault is sealed"}})
+	}))
+	defer vault.Close()
+	t.Cleanup(func() { kms.Configure() })
+	t.Setenv("KMS_PROVIDER", "vault")
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TRANSIT_KEY", "kubeswitch")
+	t.Setenv("VAULT_TOKEN", "s.test")
+	if err := kms.Configure(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := testRouter(admin)
+	r.POST("/clusters", CreateCluster)
+	w := doJSON(t, r, http.MethodPost, "/clusters", map[string]string{"name": "prod", "kubeconfig": testKubeconfig})
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("create: status %d: %s", w.Code, w.Body)
+	}
+	if writeErr != nil {
+		t.Errorf("database write during sealing: %v", writeErr)
+	}
+	var left int64
+	database.DB.Unscoped().Model(&models.Cluster{}).Count(&left)
+	if left != 0 {
+		t.Errorf("%d clusters left after the failed create", left)
+	}
+}
+
+func TestClusterKubeconfigEncryption(t *testing.T) {
+	setupTestDB(t)
+	enableLocalKMS(t)
+	admin := createUser(t, "admin", "admin")
+
+	r := testRouter(admin)
+	r.POST("/clusters", CreateCluster)
+	r.POST("/clusters/:id/import", ImportKubeconfig)
+	r.GET("/clusters/:id/config", GetClusterConfig)
+
+	var ids []uint
+	for _, name := range []string{"prod", "staging"} {
+		w := doJSON(t, r, http.MethodPost, "/clusters", map[string]string{"name": name, "kubeconfig": testKubeconfig})
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create %s: status %d: %s", name, w.Code, w.Body)
+		}
+		var cluster models.Cluster
+		json.Unmarshal(w.Body.Bytes(), &cluster)
+		ids = append(ids, cluster.ID)
+	}
+	prod, staging := ids[0], ids[1]
+
+	var stored models.Cluster
+	database.DB.First(&stored, prod)
+	if !kms.IsSealed(stored.Kubeconfig) || strings.Contains(stored.Kubeconfig, "very-secret") {
+		t.Fatalf("kubeconfig stored in plaintext: %q", stored.Kubeconfig)
+	}
+
+	w := doJSON(t, r, http.MethodGet, fmt.Sprintf("/clusters/%d/config", prod), nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "very-secret") {
+		t.Fatalf("download: status %d: %s", w.Code, w.Body)
+	}
+
+	w = doJSON(t, r, http.MethodPost, fmt.Sprintf("/clusters/%d/import", prod), map[string]string{"kubeconfig": testKubeconfig, "level": "view"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: status %d: %s", w.Code, w.Body)
+	}
+	w = doJSON(t, r, http.MethodGet, fmt.Sprintf("/clusters/%d/config?level=view", prod), nil)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"level":"view"`) {
+		t.Fatalf("view download: status %d: %s", w.Code, w.Body)
+	}
+
+	// A ciphertext copied into another record does not decrypt there.
+	var credential models.ClusterCredential
+	database.DB.Where("cluster_id = ? AND level = ?", prod, "view").First(&credential)
+	database.DB.Model(&models.Cluster{}).Where("id = ?", staging).UpdateColumn("kubeconfig", stored.Kubeconfig)
+	database.DB.Model(&models.Cluster{}).Where("id = ?", prod).UpdateColumn("kubeconfig", credential.Kubeconfig)
+	for _, id := range ids {
+		w = doJSON(t, r, http.MethodGet, fmt.Sprintf("/clusters/%d/config", id), nil)
+		if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "very-secret") {
+			t.Errorf("cluster %d served a kubeconfig sealed for another record: status %d", id, w.Code)
+		}
+	}
+}
+
+func TestDeleteClusterRemovesDependents(t *testing.T) {
+	setupTestDB(t)
+	admin := createUser(t, "admin", "admin")
+	alice := createUser(t, "alice", "user")
+	prod, staging := createCluster(t, "prod"), createCluster(t, "staging")
+	group := models.Group{Name: "platform"}
+	database.DB.Create(&group)
+	for _, cluster := range []models.Cluster{prod, staging} {
+		database.DB.Create(&models.Permission{UserID: alice.ID, ClusterID: cluster.ID, Level: "view"})
+		database.DB.Create(&models.GroupPermission{GroupID: group.ID, ClusterID: cluster.ID, Level: "view"})
+		database.DB.Create(&models.ClusterOwner{ClusterID: cluster.ID, UserID: &alice.ID})
+		database.DB.Create(&models.ClusterCredential{ClusterID: cluster.ID, Level: "view", Kubeconfig: "sealed"})
+		database.DB.Create(&models.AccessRequest{UserID: alice.ID, ClusterID: cluster.ID, Status: "pending"})
+	}
+
+	r := testRouter(admin)
+	r.DELETE("/clusters/:id", DeleteCluster)
+	if w := doJSON(t, r, http.MethodDelete, fmt.Sprintf("/clusters/%d", prod.ID), nil); w.Code != http.StatusOK {
+		t.Fatalf("delete: status %d: %s", w.Code, w.Body)
+	}
+
+	for _, model := range []interface{}{&models.Permission{}, &models.GroupPermission{}, &models.ClusterOwner{}, &models.ClusterCredential{}} {
+		var left, kept int64
+		database.DB.Model(model).Where("cluster_id = ?", prod.ID).Count(&left)
+		database.DB.Model(model).Where("cluster_id = ?", staging.ID).Count(&kept)
+		if left != 0 || kept != 1 {
+			t.Errorf("%T: %d rows left for the deleted cluster, %d for the other, want 0 and 1", model, left, kept)
+		}
+	}
+	var pending int64
+	database.DB.Model(&models.AccessRequest{}).Where("cluster_id = ? AND status = ?", prod.ID, "pending").Count(&pending)
+	if pending != 0 {
+		t.Errorf("%d access requests for the deleted cluster still pending", pending)
+	}
+}
+
+func TestClusterConfigLevels(t *testing.T) {
+	setupTestDB(t)
+	admin := createUser(t, "admin", "admin")
+	viewer := createUser(t, "viewer", "user")
+	editor := createUser(t, "editor", "user")
+	operator := createUser(t, "operator", "user")
+	outsider := createUser(t, "outsider", "user")
+	cluster := createCluster(t, "prod")
+	database.DB.Model(&cluster).UpdateColumn("kubeconfig", "admin-config")
+	// No edit-level kubeconfig: edit grants fall back to the view one
+	database.DB.Create(&models.ClusterCredential{ClusterID: cluster.ID, Level: utils.LevelView, Kubeconfig: "view-config"})
+
+	database.DB.Create(&models.Permission{UserID: viewer.ID, ClusterID: cluster.ID, Level: utils.LevelView})
+	database.DB.Create(&models.Permission{UserID: editor.ID, ClusterID: cluster.ID, Level: utils.LevelView})
+	group := models.Group{Name: "editors"}
+	database.DB.Create(&group)
+	database.DB.Create(&models.GroupMember{GroupID: group.ID, UserID: editor.ID})
+	database.DB.Create(&models.GroupPermission{GroupID: group.ID, ClusterID: cluster.ID, Level: utils.LevelEdit})
+	database.DB.Create(&models.Permission{UserID: operator.ID, ClusterID: cluster.ID, Level: utils.LevelAdmin})
+
+	tests := []struct {
+		name   string
+		user   models.User
+		path   string
+		status int
+		served string
+	}{
+		{"view grant", viewer, "", http.StatusOK, "view"},
+		{"view grant asking for more", viewer, "?level=edit", http.StatusForbidden, ""},
+		{"highest of direct and group grant", editor, "?level=edit", http.StatusOK, "view"},
+		{"edit grant asking for admin", editor, "?level=admin", http.StatusForbidden, ""},
+		{"admin grant", operator, "", http.StatusOK, "admin"},
+		{"admin grant asking for less", operator, "?level=view", http.StatusOK, "view"},
+		{"invalid level", operator, "?level=root", http.StatusBadRequest, ""},
+		{"no grant", outsider, "", http.StatusForbidden, ""},
+		{"kubeconfig:read", admin, "", http.StatusOK, "admin"},
+		{"kubeconfig:read asking for less", admin, "?level=view", http.StatusOK, "view"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := testRouter(tt.user)
+			r.GET("/clusters/:id/config", GetClusterConfig)
+			w := doJSON(t, r, http.MethodGet, fmt.Sprintf("/clusters/%d/config%s", cluster.ID, tt.path), nil)
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			if tt.served == "" {
+				return
+			}
+			var body struct{ Kubeconfig, Level string }
+			json.Unmarshal(w.Body.Bytes(), &body)
+			if body.Level != tt.served || body.Kubeconfig != tt.served+"-config" {
+				t.Errorf("served %q (%q), want %s", body.Level, body.Kubeconfig, tt.served)
+			}
+		})
+	}
+
+	// Unknown clusters look the same as forbidden ones unless the caller
+	// could read them anyway
+	r := testRouter(outsider)
+	r.GET("/clusters/:id/config", GetClusterConfig)
+	if w := doJSON(t, r, http.MethodGet, "/clusters/999/config", nil); w.Code != http.StatusForbidden {
+		t.Errorf("unknown cluster without access: status %d, want 403", w.Code)
+	}
+	r = testRouter(admin)
+	r.GET("/clusters/:id/config", GetClusterConfig)
+	if w := doJSON(t, r, http.MethodGet, "/clusters/999/config", nil); w.Code != http.StatusNotFound {
+		t.Errorf("unknown cluster with kubeconfig:read: status %d, want 404", w.Code)
+	}
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"errors"
+	"kubeswitch/server/auth"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestDeviceCode starts a device login for a CLI that cannot or should not
+// read a password.
+func RequestDeviceCode(c *gin.Context) {
+	dc, deviceCode, err := auth.CreateDeviceCode(c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create device code"})
+		return
+	}
+
+	verificationURI := auth.DeviceVerificationURL()
+	if verificationURI == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		verificationURI = scheme + "://" + c.Request.Host + "/device"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"device_code":               deviceCode,
+		"user_code":                 dc.UserCode,
+		"verification_uri":          verificationURI,
+		"verification_uri_complete": verificationURI + "?user_code=" + url.QueryEscape(dc.UserCode),
+		"expires_in":                int(auth.DeviceCodeTTL.Seconds()),
+		"interval":                  int(auth.DevicePollInterval.Seconds()),
+	})
+}
+
+type DeviceTokenInput struct {
+	DeviceCode string `json:"device_code" binding:"required"`
+}
+
+// DeviceToken is polled by the CLI. It answers with an RFC 8628 error code
+// until the user approves the request, then issues a normal token pair.
+func DeviceToken(c *gin.Context) {
+	var input DeviceTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := auth.PollDeviceCode(input.DeviceCode)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": auth.ErrAccessDenied.Error()})
+		return
+	}
+
+	tokens, err := createTokens(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	utils.LogAudit(user.ID, "Login", "User logged in via device authorization", c.ClientIP())
+	c.JSON(http.StatusOK, tokens)
+}
+
+// GetDeviceCode shows the approving user where a pending request came from.
+func GetDeviceCode(c *gin.Context) {
+	dc, err := auth.FindPendingDeviceCode(c.Param("code"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Code is invalid or has expired"})
+		return
+	}
+	c.JSON(http.StatusOK, dc)
+}
+
+type DeviceApprovalInput struct {
+	UserCode string `json:"user_code" binding:"required"`
+	Approve  bool   `json:"approve"`
+}
+
+// ApproveDevice approves or denies a pending device login for the caller.
+func ApproveDevice(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	var input DeviceApprovalInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	dc, err := auth.FindPendingDeviceCode(input.UserCode)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Code is invalid or has expired"})
+		return
+	}
+
+	if !input.Approve {
+		if err := auth.DenyDeviceCode(dc); err != nil {
+			deviceDecisionError(c, err, "Failed to deny device")
+			return
+		}
+		utils.LogAuditContext(c, "DeviceDenied", "Denied device login requested from "+dc.ClientIP)
+		c.JSON(http.StatusOK, gin.H{"message": "Device denied"})
+		return
+	}
+
+	if err := auth.ApproveDeviceCode(dc, userID); err != nil {
+		deviceDecisionError(c, err, "Failed to approve device")
+		return
+	}
+	utils.LogAuditContext(c, "DeviceApproved", "Approved device login requested from "+dc.ClientIP)
+	c.JSON(http.StatusOK, gin.H{"message": "Device approved"})
+}
+
+func deviceDecisionError(c *gin.Context, err error, message string) {
+	if errors.Is(err, auth.ErrDeviceCodeDecided) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Code has already been approved or denied, or has expired"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
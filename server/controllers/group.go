@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type GroupInput struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+}
+
+// SetGroupPermissionsInput replaces a group's grants. Clusters in
+// ClusterIDs are granted at the admin level; Grants may pick a level.
+type SetGroupPermissionsInput struct {
+	ClusterIDs []uint            `json:"cluster_ids"`
+	Grants     []GroupGrantInput `json:"grants" binding:"dive"`
+}
+
+type GroupGrantInput struct {
+	ClusterID uint   `json:"cluster_id" binding:"required"`
+	Level     string `json:"level" binding:"omitempty,oneof=view edit admin"`
+	PermissionWindow
+}
+
+type SetGroupMembersInput struct {
+	UserIDs []uint `json:"user_ids" binding:"required"`
+}
+
+func GetGroups(c *gin.Context) {
+	var groups []models.Group
+	database.DB.Order("name").Find(&groups)
+
+	type memberCount struct {
+		GroupID uint
+		Count   int64
+	}
+	var counts []memberCount
+	database.DB.Model(&models.GroupMember{}).Select("group_id, count(*) as count").Group("group_id").Scan(&counts)
+	byGroup := make(map[uint]int64, len(counts))
+	for _, mc := range counts {
+		byGroup[mc.GroupID] = mc.Count
+	}
+	for i := range groups {
+		groups[i].MemberCount = byGroup[groups[i].ID]
+	}
+
+	c.JSON(http.StatusOK, groups)
+}
+
+func CreateGroup(c *gin.Context) {
+	var input GroupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group := models.Group{Name: input.Name, Description: input.Description}
+	if err := database.DB.Create(&group).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A group with this name already exists"})
+		return
+	}
+
+	utils.LogAuditContext(c, "CreateGroup", "Created group "+group.Name)
+	c.JSON(http.StatusCreated, group)
+}
+
+func UpdateGroup(c *gin.Context) {
+	var input GroupInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, ok := findGroup(c)
+	if !ok {
+		return
+	}
+
+	oldName := group.Name
+	group.Name = input.Name
+	group.Description = input.Description
+	if err := database.DB.Save(&group).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A group with this name already exists"})
+		return
+	}
+
+	utils.LogAuditContext(c, "UpdateGroup", "Updated group "+oldName)
+	c.JSON(http.StatusOK, group)
+}
+
+func DeleteGroup(c *gin.Context) {
+	group, ok := findGroup(c)
+	if !ok {
+		return
+	}
+
+	var owned int64
+	database.DB.Model(&models.User{}).Where("owner_group_id = ? AND owner_id IS NULL", group.ID).Count(&owned)
+	if owned > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Group owns service accounts; transfer or delete them first"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Where("group_id = ?", group.ID).Delete(&models.GroupMember{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group members"})
+		return
+	}
+	if err := tx.Where("group_id = ?", group.ID).Delete(&models.GroupPermission{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group permissions"})
+		return
+	}
+	if err := tx.Where("group_id = ?", group.ID).Delete(&models.LabelPermission{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group permissions"})
+		return
+	}
+	if err := tx.Where("group_id = ?", group.ID).Delete(&models.ClusterOwner{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group cluster ownership"})
+		return
+	}
+	if err := tx.Model(&models.User{}).Where("owner_group_id = ?", group.ID).Update("owner_group_id", nil).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update service account owners"})
+		return
+	}
+	if err := tx.Delete(&group).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group"})
+		return
+	}
+	tx.Commit()
+
+	utils.LogAuditContext(c, "DeleteGroup", "Deleted group "+group.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Group deleted"})
+}
+
+func GetGroupMembers(c *gin.Context) {
+	group, ok := findGroup(c)
+	if !ok {
+		return
+	}
+	userIDs := []uint{}
+	database.DB.Model(&models.GroupMember{}).Where("group_id = ?", group.ID).Pluck("user_id", &userIDs)
+	c.JSON(http.StatusOK, gin.H{"user_ids": userIDs})
+}
+
+// SetGroupMembers replaces the member list of a group.
+func SetGroupMembers(c *gin.Context) {
+	var input SetGroupMembersInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	group, ok := findGroup(c)
+	if !ok {
+		return
+	}
+
+	userIDs := uniqueIDs(input.UserIDs)
+	var found int64
+	database.DB.Model(&models.User{}).Where("id IN ?", userIDs).Count(&found)
+	if found != int64(len(userIDs)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown user in member list"})
+		return
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Where("group_id = ?", group.ID).Delete(&models.GroupMember{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear members"})
+		return
+	}
+	for _, userID := range userIDs {
+		if err := tx.Create(&models.GroupMember{GroupID: group.ID, UserID: userID}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add member"})
+			return
+		}
+	}
+	tx.Commit()
+
+	utils.LogAuditContext(c, "SetGroupMembers", fmt.Sprintf("Set %d members of group %s", len(userIDs), group.Name))
+	c.JSON(http.StatusOK, gin.H{"message": "Members updated"})
+}
+
+func GetGroupPermissions(c *gin.Context) {
+	group, ok := findGroup(c)
+	if !ok {
+		return
+	}
+	var perms []models.GroupPermission
+	database.DB.Where("group_id = ?", group.ID).Find(&perms)
+
+	clusterIDs := make([]uint, 0, len(perms))
+	grants := make([]gin.H, 0, len(perms))
+	for _, p := range perms {
+		clusterIDs = append(clusterIDs, p.ClusterID)
+		grants = append(grants, windowView(gin.H{"cluster_id": p.ClusterID, "level": p.Level}, p.NotBefore, p.ExpiresAt))
+	}
+	c.JSON(http.StatusOK, gin.H{"cluster_ids": clusterIDs, "grants": grants})
+}
+
+// SetGroupPermissions replaces the clusters every member of the group can
+// access.
+func SetGroupPermissions(c *gin.Context) {
+	var input SetGroupPermissionsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.ClusterIDs == nil && input.Grants == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cluster_ids or grants is required"})
+		return
+	}
+
+	group, ok := findGroup(c)
+	if !ok {
+		return
+	}
+
+	perms := make([]models.GroupPermission, 0, len(input.ClusterIDs)+len(input.Grants))
+	for _, clusterID := range uniqueIDs(input.ClusterIDs) {
+		perms = append(perms, models.GroupPermission{GroupID: group.ID, ClusterID: clusterID})
+	}
+	for _, grant := range input.Grants {
+		if err := grant.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		perms = append(perms, models.GroupPermission{
+			GroupID:   group.ID,
+			ClusterID: grant.ClusterID,
+			Level:     grant.Level,
+			NotBefore: grant.NotBefore,
+			ExpiresAt: grant.ExpiresAt,
+		})
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Where("group_id = ?", group.ID).Delete(&models.GroupPermission{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear permissions"})
+		return
+	}
+	for _, perm := range perms {
+		if err := tx.Create(&perm).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add permission"})
+			return
+		}
+	}
+	tx.Commit()
+
+	utils.LogAuditContext(c, "SetGroupPermissions", fmt.Sprintf("Granted group %s access to %d clusters", group.Name, len(perms)))
+	c.JSON(http.StatusOK, gin.H{"message": "Permissions updated"})
+}
+
+func findGroup(c *gin.Context) (models.Group, bool) {
+	var group models.Group
+	if err := database.DB.First(&group, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Group not found"})
+		return group, false
+	}
+	return group, true
+}
+
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
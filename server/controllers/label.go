@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LabelGrantInput grants access to every cluster matching Selector. Grants
+// without a level are given admin access, like cluster grants.
+type LabelGrantInput struct {
+	Selector string `json:"selector" binding:"required"`
+	Level    string `json:"level" binding:"omitempty,oneof=view edit admin"`
+	PermissionWindow
+}
+
+type SetLabelPermissionsInput struct {
+	Grants []LabelGrantInput `json:"grants" binding:"required,dive"`
+}
+
+type SetClusterLabelsInput struct {
+	Labels map[string]string `json:"labels"`
+}
+
+// SetClusterLabels replaces a cluster's labels. This can change who has
+// access through selector grants.
+func SetClusterLabels(c *gin.Context) {
+	var input SetClusterLabelsInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := utils.ValidateClusterLabels(input.Labels); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var cluster models.Cluster
+	if err := database.DB.First(&cluster, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return
+	}
+
+	oldLabels := cluster.Labels
+	cluster.Labels = input.Labels
+	if err := database.DB.Model(&cluster).Select("labels").Updates(&cluster).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update labels"})
+		return
+	}
+
+	utils.LogClusterAudit(c, cluster.ID, "SetClusterLabels", fmt.Sprintf("Changed labels of cluster %s from %s to %s",
+		cluster.Name, utils.FormatLabels(oldLabels), utils.FormatLabels(cluster.Labels)))
+	c.JSON(http.StatusOK, cluster)
+}
+
+func GetUserLabelPermissions(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	listLabelPermissions(c, "user_id", user.ID)
+}
+
+// SetUserLabelPermissions replaces the selector grants of a user.
+func SetUserLabelPermissions(c *gin.Context) {
+	var input SetLabelPermissionsInput
+	if !bindLabelGrants(c, &input) {
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+
+	perms := make([]models.LabelPermission, 0, len(input.Grants))
+	for _, grant := range input.Grants {
+		perms = append(perms, models.LabelPermission{UserID: &user.ID, Selector: grant.Selector, Level: grant.Level, NotBefore: grant.NotBefore, ExpiresAt: grant.ExpiresAt})
+	}
+	if !replaceLabelPermissions(c, "user_id", user.ID, perms) {
+		return
+	}
+
+	utils.LogAuditContext(c, "SetUserLabelPermissions", "Set selector grants of user "+user.Username+" to "+formatLabelGrants(input.Grants))
+	c.JSON(http.StatusOK, gin.H{"message": "Permissions updated"})
+}
+
+func GetGroupLabelPermissions(c *gin.Context) {
+	group, ok := findGroup(c)
+	if !ok {
+		return
+	}
+	listLabelPermissions(c, "group_id", group.ID)
+}
+
+// SetGroupLabelPermissions replaces the selector grants of a group.
+func SetGroupLabelPermissions(c *gin.Context) {
+	var input SetLabelPermissionsInput
+	if !bindLabelGrants(c, &input) {
+		return
+	}
+
+	group, ok := findGroup(c)
+	if !ok {
+		return
+	}
+
+	perms := make([]models.LabelPermission, 0, len(input.Grants))
+	for _, grant := range input.Grants {
+		perms = append(perms, models.LabelPermission{GroupID: &group.ID, Selector: grant.Selector, Level: grant.Level, NotBefore: grant.NotBefore, ExpiresAt: grant.ExpiresAt})
+	}
+	if !replaceLabelPermissions(c, "group_id", group.ID, perms) {
+		return
+	}
+
+	utils.LogAuditContext(c, "SetGroupLabelPermissions", "Set selector grants of group "+group.Name+" to "+formatLabelGrants(input.Grants))
+	c.JSON(http.StatusOK, gin.H{"message": "Permissions updated"})
+}
+
+// listLabelPermissions lists the selector grants whose owner column (user_id
+// or group_id) is id.
+func listLabelPermissions(c *gin.Context, column string, id uint) {
+	var perms []models.LabelPermission
+	if err := database.DB.Where(column+" = ?", id).Order("id").Find(&perms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
+		return
+	}
+
+	grants := make([]gin.H, 0, len(perms))
+	for _, p := range perms {
+		grants = append(grants, windowView(gin.H{"selector": p.Selector, "level": p.Level}, p.NotBefore, p.ExpiresAt))
+	}
+	c.JSON(http.StatusOK, gin.H{"grants": grants})
+}
+
+// bindLabelGrants binds the input and normalises each selector, so that the
+// stored form is the one Kubernetes would print.
+func bindLabelGrants(c *gin.Context, input *SetLabelPermissionsInput) bool {
+	if err := c.ShouldBindJSON(input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	for i, grant := range input.Grants {
+		selector, err := utils.ParseLabelSelector(grant.Selector)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid selector %q: %v", grant.Selector, err)})
+			return false
+		}
+		if err := grant.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+		input.Grants[i].Selector = selector.String()
+		if grant.Level == "" {
+			input.Grants[i].Level = utils.LevelAdmin
+		}
+	}
+	return true
+}
+
+func replaceLabelPermissions(c *gin.Context, column string, id uint, perms []models.LabelPermission) bool {
+	tx := database.DB.Begin()
+	if err := tx.Where(column+" = ?", id).Delete(&models.LabelPermission{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear permissions"})
+		return false
+	}
+	for _, perm := range perms {
+		if err := tx.Create(&perm).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add permission"})
+			return false
+		}
+	}
+	tx.Commit()
+	return true
+}
+
+func formatLabelGrants(grants []LabelGrantInput) string {
+	if len(grants) == 0 {
+		return "(none)"
+	}
+	list := make([]string, 0, len(grants))
+	for _, grant := range grants {
+		list = append(list, fmt.Sprintf("%q (%s)", grant.Selector, grant.Level))
+	}
+	return strings.Join(list, ", ")
+}
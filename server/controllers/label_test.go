@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func labelCluster(t *testing.T, name string, clusterLabels map[string]string) models.Cluster {
+	t.Helper()
+	cluster := createCluster(t, name)
+	cluster.Labels = clusterLabels
+	if err := database.DB.Model(&cluster).Select("labels").Updates(&cluster).Error; err != nil {
+		t.Fatal(err)
+	}
+	return cluster
+}
+
+// visibleClusters lists the clusters GetClusters returns to user, with the
+// level granted on each.
+func visibleClusters(t *testing.T, user models.User) map[string]string {
+	t.Helper()
+	r := testRouter(user)
+	r.GET("/clusters", GetClusters)
+	w := doJSON(t, r, http.MethodGet, "/clusters", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("list clusters: status %d: %s", w.Code, w.Body)
+	}
+	var clusters []models.Cluster
+	if err := json.Unmarshal(w.Body.Bytes(), &clusters); err != nil {
+		t.Fatal(err)
+	}
+	visible := make(map[string]string, len(clusters))
+	for _, cluster := range clusters {
+		visible[cluster.Name] = cluster.AccessLevel
+	}
+	return visible
+}
+
+func TestSelectorGrants(t *testing.T) {
+	setupTestDB(t)
+	admin := createUser(t, "admin", "admin")
+	developer := createUser(t, "developer", "user")
+	contractor := createUser(t, "contractor", "user")
+	group := models.Group{Name: "contractors"}
+	database.DB.Create(&group)
+	database.DB.Create(&models.GroupMember{GroupID: group.ID, UserID: contractor.ID})
+	labelCluster(t, "dev", map[string]string{"env": "dev"})
+	prod := labelCluster(t, "prod", map[string]string{"env": "prod"})
+	labelCluster(t, "unlabelled", nil)
+
+	r := testRouter(admin)
+	r.POST("/users/:id/label-permissions", SetUserLabelPermissions)
+	r.POST("/groups/:id/label-permissions", SetGroupLabelPermissions)
+	r.POST("/clusters/:id/labels", SetClusterLabels)
+	grants := map[string]interface{}{"grants": []map[string]string{{"selector": "env=dev", "level": "view"}}}
+	if w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/users/%d/label-permissions", developer.ID), grants); w.Code != http.StatusOK {
+		t.Fatalf("grant env=dev: status %d: %s", w.Code, w.Body)
+	}
+	grants = map[string]interface{}{"grants": []map[string]string{{"selector": "env!=prod", "level": "edit"}}}
+	if w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/groups/%d/label-permissions", group.ID), grants); w.Code != http.StatusOK {
+		t.Fatalf("grant env!=prod: status %d: %s", w.Code, w.Body)
+	}
+
+	// A cluster created after the grant is covered by it
+	labelCluster(t, "dev-2", map[string]string{"env": "dev"})
+	if got, want := visibleClusters(t, developer), map[string]string{"dev": "view", "dev-2": "view"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("env=dev grant sees %v, want %v", got, want)
+	}
+	// env!=prod also matches clusters without an env label
+	if got, want := visibleClusters(t, contractor), map[string]string{"dev": "edit", "dev-2": "edit", "unlabelled": "edit"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("env!=prod grant sees %v, want %v", got, want)
+	}
+
+	// Relabelling moves the cluster into the grants, and is audited with
+	// both label sets
+	relabel := map[string]interface{}{"labels": map[string]string{"env": "dev", "team": "payments"}}
+	if w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/clusters/%d/labels", prod.ID), relabel); w.Code != http.StatusOK {
+		t.Fatalf("relabel prod: status %d: %s", w.Code, w.Body)
+	}
+	if level := visibleClusters(t, developer)["prod"]; level != "view" {
+		t.Errorf("relabelled cluster: level %q, want view", level)
+	}
+	var entry models.AuditLog
+	database.DB.Where("action = ? AND cluster_id = ?", "SetClusterLabels", prod.ID).First(&entry)
+	if want := "Changed labels of cluster prod from env=prod to env=dev,team=payments"; entry.Detail != want {
+		t.Errorf("audit detail %q, want %q", entry.Detail, want)
+	}
+}
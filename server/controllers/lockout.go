@@ -0,0 +1,66 @@
+package controllers
+
+import (
+	"kubeswitch/server/auth"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLockouts lists usernames and client IPs that are currently locked out.
+func GetLockouts(c *gin.Context) {
+	var lockouts []models.LoginThrottle
+	database.DB.Where("locked_until > ?", time.Now()).Order("locked_until desc").Find(&lockouts)
+	c.JSON(http.StatusOK, lockouts)
+}
+
+func DeleteLockout(c *gin.Context) {
+	lockoutID := c.Param("id")
+	adminUserID := c.MustGet("user_id").(uint)
+
+	var lockout models.LoginThrottle
+	if err := database.DB.First(&lockout, lockoutID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Lockout not found"})
+		return
+	}
+	// Clearing a username lockout unlocks that account, as UnlockUser does.
+	if strings.HasPrefix(lockout.Key, "user:") {
+		var user models.User
+		err := database.DB.Where("LOWER(username) = ?", strings.TrimPrefix(lockout.Key, "user:")).First(&user).Error
+		if err == nil && !canManageUser(c, user) {
+			return
+		}
+	}
+
+	if err := database.DB.Delete(&lockout).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove lockout"})
+		return
+	}
+
+	utils.LogAudit(adminUserID, "Unlock", "Admin removed lockout for "+lockout.Key, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout removed"})
+}
+
+func UnlockUser(c *gin.Context) {
+	userID := c.Param("id")
+	adminUserID := c.MustGet("user_id").(uint)
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+
+	auth.ResetLoginFailures(user.Username)
+
+	utils.LogAudit(adminUserID, "Unlock", "Admin unlocked user "+user.Username, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
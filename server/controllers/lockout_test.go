@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"fmt"
+	"kubeswitch/server/auth"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDeleteLockoutChecksTargetUser(t *testing.T) {
+	setupTestDB(t)
+	database.DB.Create(&models.Role{Name: "helpdesk", Capabilities: utils.CapUsersManage})
+	helpdesk := createUser(t, "helpdesk", "helpdesk")
+	createUser(t, "Root", "admin")
+	createUser(t, "alice", "user")
+
+	r := testRouter(helpdesk)
+	r.DELETE("/users/lockouts/:id", DeleteLockout)
+	until := time.Now().Add(time.Hour)
+	lock := func(key string) models.LoginThrottle {
+		lockout := models.LoginThrottle{Key: key, Failures: 5, LastFailureAt: time.Now(), LockedUntil: &until}
+		database.DB.Create(&lockout)
+		return lockout
+	}
+
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{auth.UserThrottleKey("Root"), http.StatusForbidden},
+		{auth.UserThrottleKey("alice"), http.StatusOK},
+		{auth.UserThrottleKey("nobody"), http.StatusOK},
+		{auth.IPThrottleKey("203.0.113.7"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		lockout := lock(tt.key)
+		w := doJSON(t, r, http.MethodDelete, fmt.Sprintf("/users/lockouts/%d", lockout.ID), nil)
+		if w.Code != tt.want {
+			t.Errorf("%s: status %d, want %d: %s", tt.key, w.Code, tt.want, w.Body)
+		}
+		var remaining int64
+		database.DB.Model(&models.LoginThrottle{}).Where("key = ?", tt.key).Count(&remaining)
+		if removed := remaining == 0; removed != (tt.want == http.StatusOK) {
+			t.Errorf("%s: removed = %v", tt.key, removed)
+		}
+	}
+}
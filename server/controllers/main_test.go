@@ -0,0 +1,76 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	os.Exit(m.Run())
+}
+
+// setupTestDB points database.DB at a fresh in-memory database with the
+// built-in roles for the duration of the test.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	testutil.SetupDB(t)
+	utils.SeedRoles()
+}
+
+func createUser(t *testing.T, username, role string) models.User {
+	t.Helper()
+	user := models.User{Username: username, Role: role}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	return user
+}
+
+func createCluster(t *testing.T, name string) models.Cluster {
+	t.Helper()
+	cluster := models.Cluster{Name: name, Kubeconfig: "apiVersion: v1\nkind: Config\n"}
+	if err := database.DB.Create(&cluster).Error; err != nil {
+		t.Fatalf("create cluster %s: %v", name, err)
+	}
+	return cluster
+}
+
+// testRouter returns a router whose requests are authenticated as user,
+// as AuthMiddleware would leave them.
+func testRouter(user models.User) *gin.Engine {
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("user_id", user.ID)
+		c.Set("username", user.Username)
+		c.Set("role", user.Role)
+		c.Next()
+	})
+	return r
+}
+
+func doJSON(t *testing.T, h http.Handler, method, path string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			t.Fatalf("encode body: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
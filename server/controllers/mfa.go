@@ -0,0 +1,437 @@
+package controllers
+
+import (
+	"errors"
+	"kubeswitch/server/auth"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+type MFACodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type LoginMFAInput struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
+
+type LoginMFAEnrollInput struct {
+	MFAToken        string `json:"mfa_token" binding:"required"`
+	EnrollmentToken string `json:"enrollment_token" binding:"required"`
+}
+
+type MFAPolicyInput struct {
+	RequireForAdmins *bool `json:"require_for_admins" binding:"required"`
+}
+
+// mfaRequired reports whether policy forces the user to use MFA.
+func mfaRequired(user models.User) bool {
+	return utils.MFARequired(user.Role)
+}
+
+// verifySecondFactor accepts a current TOTP code or an unused recovery code.
+func verifySecondFactor(user *models.User, code string) bool {
+	code = strings.TrimSpace(code)
+
+	if step, ok := utils.ValidateTOTP(user.MFASecret, code, time.Now()); ok {
+		if step <= user.MFALastStep {
+			return false
+		}
+		res := database.DB.Model(&models.User{}).
+			Where("id = ? AND mfa_last_step < ?", user.ID, step).
+			Update("mfa_last_step", step)
+		return res.Error == nil && res.RowsAffected == 1
+	}
+
+	res := database.DB.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, utils.HashToken(strings.ToLower(code))).
+		Update("used_at", time.Now())
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// beginMFAEnrollment stores a fresh, not yet active secret for the user.
+func beginMFAEnrollment(user *models.User) (gin.H, error) {
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(user).Update("mfa_secret", secret).Error; err != nil {
+		return nil, err
+	}
+	return gin.H{
+		"secret":           secret,
+		"provisioning_uri": utils.TOTPProvisioningURI(secret, user.Username),
+	}, nil
+}
+
+var errInvalidMFACode = errors.New("Invalid verification code")
+
+// activateMFA confirms enrolment with a first code and returns new recovery
+// codes, which are only shown once.
+func activateMFA(user *models.User, code string) ([]string, error) {
+	if user.MFASecret == "" {
+		return nil, errors.New("MFA enrolment has not been started")
+	}
+	step, ok := utils.ValidateTOTP(user.MFASecret, strings.TrimSpace(code), time.Now())
+	if !ok {
+		return nil, errInvalidMFACode
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := replaceRecoveryCodes(tx, user.ID, codes); err != nil {
+			return err
+		}
+		return tx.Model(user).Updates(map[string]interface{}{
+			"mfa_enabled": true, "mfa_last_step": step, "mfa_enroll_hash": "", "mfa_enroll_expires_at": nil,
+		}).Error
+	})
+	return codes, err
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	for _, code := range codes {
+		if err := tx.Create(&models.RecoveryCode{UserID: userID, CodeHash: utils.HashToken(code)}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func disableMFA(userID uint) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).
+			Updates(map[string]interface{}{"mfa_enabled": false, "mfa_secret": "", "mfa_last_step": 0}).Error
+	})
+}
+
+// LoginMFA completes the second step of a login. For users that policy
+// requires to enrol, a valid code also activates MFA.
+func LoginMFA(c *gin.Context) {
+	var input LoginMFAInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := utils.ValidateMFAToken(input.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	if !checkLoginThrottle(c, user.Username) {
+		return
+	}
+
+	var recoveryCodes []string
+	if user.MFAEnabled {
+		if !verifySecondFactor(&user, input.Code) {
+			recordLoginFailure(c, user.Username, "invalid verification code")
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid verification code"})
+			return
+		}
+	} else {
+		recoveryCodes, err = activateMFA(&user, input.Code)
+		if err != nil {
+			recordLoginFailure(c, user.Username, "MFA enrolment failed: "+err.Error())
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		utils.LogAudit(user.ID, "EnableMFA", "User enabled MFA during login", c.ClientIP())
+	}
+
+	tokens, err := createTokens(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	if recoveryCodes != nil {
+		tokens["recovery_codes"] = recoveryCodes
+	}
+
+	auth.ResetLoginFailures(user.Username)
+	utils.LogAudit(user.ID, "Login", "User logged in with MFA", c.ClientIP())
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// LoginMFAEnroll lets a user who must use MFA but has not enrolled yet get a
+// secret during login. The password alone is not enough, or whoever stole it
+// could register their own authenticator: it also takes an enrolment token
+// that an admin issued to the user.
+func LoginMFAEnroll(c *gin.Context) {
+	var input LoginMFAEnrollInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID, err := utils.ValidateMFAToken(input.MFAToken)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired MFA token"})
+		return
+	}
+	if user.MFAEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is already enabled"})
+		return
+	}
+	if !checkLoginThrottle(c, user.Username) {
+		return
+	}
+	if !utils.ValidMFAEnrollmentToken(user, strings.TrimSpace(input.EnrollmentToken)) {
+		recordLoginFailure(c, user.Username, "invalid MFA enrolment token")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired enrolment token; ask an administrator for a new one"})
+		return
+	}
+
+	enrollment, err := beginMFAEnrollment(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start MFA enrolment"})
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+func GetMyMFA(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var remaining int64
+	database.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", userID).Count(&remaining)
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.MFAEnabled,
+		"required":                 mfaRequired(user),
+		"recovery_codes_remaining": remaining,
+	})
+}
+
+func EnrollMyMFA(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.MFAEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is already enabled"})
+		return
+	}
+
+	enrollment, err := beginMFAEnrollment(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start MFA enrolment"})
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+func ActivateMyMFA(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	var input MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if user.MFAEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is already enabled"})
+		return
+	}
+
+	codes, err := activateMFA(&user, input.Code)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	utils.LogAudit(userID, "EnableMFA", "User enabled MFA", c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+func DisableMyMFA(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	var input MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !user.MFAEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is not enabled"})
+		return
+	}
+	if mfaRequired(user) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is required for your role"})
+		return
+	}
+	if !verifySecondFactor(&user, input.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	if err := disableMFA(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable MFA"})
+		return
+	}
+
+	utils.LogAudit(userID, "DisableMFA", "User disabled MFA", c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "MFA disabled"})
+}
+
+func RegenerateMyRecoveryCodes(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	var input MFACodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !user.MFAEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is not enabled"})
+		return
+	}
+	if !verifySecondFactor(&user, input.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid verification code"})
+		return
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	if err := replaceRecoveryCodes(database.DB, userID, codes); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recovery codes"})
+		return
+	}
+
+	utils.LogAudit(userID, "RegenerateRecoveryCodes", "User regenerated MFA recovery codes", c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// AdminResetMFA clears a user's MFA enrolment, e.g. after a lost device.
+func AdminResetMFA(c *gin.Context) {
+	targetUserID := c.Param("id")
+	adminUserID := c.MustGet("user_id").(uint)
+
+	var user models.User
+	if err := database.DB.First(&user, targetUserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+
+	if err := disableMFA(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset MFA"})
+		return
+	}
+
+	utils.LogAudit(adminUserID, "AdminResetMFA", "Admin reset MFA for user "+user.Username, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "MFA reset successfully"})
+}
+
+// AdminCreateMFAEnrollmentToken issues the one-time token a user needs to
+// enrol in MFA while logging in. Hand it over out of band.
+func AdminCreateMFAEnrollmentToken(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+	if user.MFAEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "MFA is already enabled; reset it first"})
+		return
+	}
+
+	token, expiresAt, err := utils.IssueMFAEnrollmentToken(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create enrolment token"})
+		return
+	}
+
+	utils.LogAuditContext(c, "CreateMFAEnrollmentToken", "Issued an MFA enrolment token for user "+user.Username)
+	c.JSON(http.StatusCreated, gin.H{"enrollment_token": token, "expires_at": expiresAt})
+}
+
+func GetMFAPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"require_for_admins": utils.GetBoolSetting(utils.SettingMFARequiredForAdmins, false),
+	})
+}
+
+func SetMFAPolicy(c *gin.Context) {
+	adminUserID := c.MustGet("user_id").(uint)
+	var input MFAPolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	value := strconv.FormatBool(*input.RequireForAdmins)
+	if err := utils.SetSetting(utils.SettingMFARequiredForAdmins, value); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update MFA policy"})
+		return
+	}
+
+	utils.LogAudit(adminUserID, "SetMFAPolicy", "Admin set MFA required for admins to "+value, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "MFA policy updated"})
+}
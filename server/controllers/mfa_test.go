@@ -0,0 +1,140 @@
+package controllers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoginMFACodesWorkOnce(t *testing.T) {
+	setupTestDB(t)
+	loadTestSigningKey(t)
+	secret, _ := utils.GenerateTOTPSecret()
+	user := models.User{Username: "alice", Role: "user", MFAEnabled: true, MFASecret: secret}
+	database.DB.Create(&user)
+	codes, _ := utils.GenerateRecoveryCodes(2)
+	if err := replaceRecoveryCodes(database.DB, user.ID, codes); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	r.POST("/login/mfa", LoginMFA)
+	login := func(code string) int {
+		mfaToken, err := utils.GenerateMFAToken(user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doJSON(t, r, http.MethodPost, "/login/mfa", map[string]string{"mfa_token": mfaToken, "code": code}).Code
+	}
+
+	if code := login(codes[0]); code != http.StatusOK {
+		t.Fatalf("recovery code: status %d", code)
+	}
+	if code := login(codes[0]); code != http.StatusUnauthorized {
+		t.Errorf("reused recovery code: status %d, want 401", code)
+	}
+	var remaining int64
+	database.DB.Model(&models.RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+	if remaining != 1 {
+		t.Errorf("%d unused recovery codes, want 1", remaining)
+	}
+
+	// TOTP codes cannot be replayed within their window either. Clear the
+	// delay the failed attempt above triggered first.
+	database.DB.Where("1 = 1").Delete(&models.LoginThrottle{})
+	totp := currentTOTP(t, secret)
+	if code := login(totp); code != http.StatusOK {
+		t.Fatalf("TOTP code: status %d", code)
+	}
+	if code := login(totp); code != http.StatusUnauthorized {
+		t.Errorf("replayed TOTP code: status %d, want 401", code)
+	}
+}
+
+// currentTOTP computes the code an authenticator app would show now.
+func currentTOTP(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:])&0x7fffffff)%1000000)
+}
+
+// TestLoginEnrollmentNeedsAdminToken checks that a password alone cannot
+// register an authenticator for an admin the MFA policy covers.
+func TestLoginEnrollmentNeedsAdminToken(t *testing.T) {
+	setupTestDB(t)
+	loadTestSigningKey(t)
+	admin := createUser(t, "admin", "admin")
+	root := createUser(t, "root", "admin")
+	utils.SetSetting(utils.SettingMFARequiredForAdmins, "true")
+
+	r := gin.New()
+	r.POST("/login/mfa", LoginMFA)
+	r.POST("/login/mfa/enroll", LoginMFAEnroll)
+	enroll := func(token string) *httptest.ResponseRecorder {
+		mfaToken, err := utils.GenerateMFAToken(root.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Failed attempts delay the next one; start each from a clean slate.
+		database.DB.Where("1 = 1").Delete(&models.LoginThrottle{})
+		return doJSON(t, r, http.MethodPost, "/login/mfa/enroll", map[string]string{"mfa_token": mfaToken, "enrollment_token": token})
+	}
+
+	if w := enroll("guessed"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("enrol without an issued token: status %d", w.Code)
+	}
+
+	issuer := testRouter(admin)
+	issuer.POST("/users/:id/mfa/enrollment-token", AdminCreateMFAEnrollmentToken)
+	w := doJSON(t, issuer, http.MethodPost, fmt.Sprintf("/users/%d/mfa/enrollment-token", root.ID), nil)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("issue token: status %d: %s", w.Code, w.Body)
+	}
+	var issued struct {
+		EnrollmentToken string `json:"enrollment_token"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &issued)
+
+	w = enroll(issued.EnrollmentToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("enrol: status %d: %s", w.Code, w.Body)
+	}
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &enrollment)
+	mfaToken, _ := utils.GenerateMFAToken(root.ID)
+	w = doJSON(t, r, http.MethodPost, "/login/mfa", map[string]string{"mfa_token": mfaToken, "code": currentTOTP(t, enrollment.Secret)})
+	if w.Code != http.StatusOK {
+		t.Fatalf("activate: status %d: %s", w.Code, w.Body)
+	}
+
+	// Activation uses up the token, so it does not survive an MFA reset.
+	if err := disableMFA(root.ID); err != nil {
+		t.Fatal(err)
+	}
+	if w := enroll(issued.EnrollmentToken); w.Code != http.StatusUnauthorized {
+		t.Errorf("reused enrolment token: status %d", w.Code)
+	}
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"fmt"
+	"kubeswitch/server/auth"
+	"kubeswitch/server/utils"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+)
+
+const oidcStateCookie = "ks_oidc_state"
+
+// GetAuthConfig tells the login page which login methods are available.
+func GetAuthConfig(c *gin.Context) {
+	proxy, _ := auth.LoadProxyConfig()
+	c.JSON(http.StatusOK, gin.H{
+		"oidc":  auth.LoadOIDCConfig().Enabled(),
+		"proxy": proxy.Enabled(),
+	})
+}
+
+// OIDCLogin redirects the browser to the identity provider.
+func OIDCLogin(c *gin.Context) {
+	provider, err := auth.OIDC()
+	if err != nil {
+		log.Println("OIDC login unavailable:", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "OIDC login is not available"})
+		return
+	}
+
+	state, authURL, err := provider.AuthCodeURL()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start OIDC login"})
+		return
+	}
+
+	// Bind the state to this browser to prevent login CSRF.
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, state, 600, "/api/oidc", "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// OIDCCallback finishes the authorization-code flow, provisions the user on
+// first login and hands the tokens to the web UI in the URL fragment.
+func OIDCCallback(c *gin.Context) {
+	provider, err := auth.OIDC()
+	if err != nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "OIDC login is not available"})
+		return
+	}
+
+	if errParam := c.Query("error"); errParam != "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Identity provider returned " + errParam})
+		return
+	}
+
+	state := c.Query("state")
+	cookieState, err := c.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookieState != state {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid OIDC state"})
+		return
+	}
+	c.SetCookie(oidcStateCookie, "", -1, "/api/oidc", "", c.Request.TLS != nil, true)
+
+	identity, err := provider.Exchange(c.Request.Context(), state, c.Query("code"))
+	if err != nil {
+		log.Println("OIDC login failed:", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "OIDC login failed"})
+		return
+	}
+
+	user, err := auth.ProvisionUser("oidc", identity)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if !identity.MFA && mfaRequired(user) {
+		utils.LogAudit(user.ID, "LoginFailed", "Failed login for "+user.Username+": identity provider did not report MFA", c.ClientIP())
+		c.JSON(http.StatusForbidden, gin.H{"error": "MFA is required for this account, but the identity provider did not report it"})
+		return
+	}
+
+	tokens, err := createTokens(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	utils.LogAudit(user.ID, "Login", "User logged in via OIDC", c.ClientIP())
+
+	// Lists such as the capabilities repeat their key once per element
+	fragment := url.Values{}
+	for k, v := range tokens {
+		if list, ok := v.([]string); ok {
+			for _, item := range list {
+				fragment.Add(k, item)
+			}
+			continue
+		}
+		fragment.Set(k, fmt.Sprint(v))
+	}
+	c.Redirect(http.StatusFound, provider.Config.PostLoginURL+"#"+fragment.Encode())
+}
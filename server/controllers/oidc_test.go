@@ -0,0 +1,193 @@
+package controllers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"kubeswitch/server/auth/oidctest"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// loadTestSigningKey makes the server able to issue access tokens.
+func loadTestSigningKey(t *testing.T) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	t.Setenv("JWT_SIGNING_KEY_FILE", path)
+	if err := utils.LoadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOIDCLoginFlow(t *testing.T) {
+	setupTestDB(t)
+	loadTestSigningKey(t)
+	issuer := oidctest.NewIssuer(t)
+	t.Setenv("OIDC_ISSUER_URL", issuer.URL)
+	t.Setenv("OIDC_CLIENT_ID", issuer.ClientID)
+	t.Setenv("OIDC_CLIENT_SECRET", issuer.ClientSecret)
+	t.Setenv("OIDC_REDIRECT_URL", "https://kubeswitch.example.com/api/oidc/callback")
+	t.Setenv("OIDC_ADMIN_VALUES", "kube-admins")
+	createUser(t, "mallory", "user")
+
+	r := gin.New()
+	r.GET("/api/oidc/login", OIDCLogin)
+	r.GET("/api/oidc/callback", OIDCCallback)
+
+	// start begins a login in the browser and returns the state cookie and
+	// the callback the identity provider redirects back to.
+	start := func(t *testing.T, claims map[string]interface{}) (*http.Cookie, string) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+		if w.Code != http.StatusFound {
+			t.Fatalf("login: status %d: %s", w.Code, w.Body)
+		}
+		var cookie *http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == oidcStateCookie {
+				cookie = c
+			}
+		}
+		if cookie == nil || !cookie.HttpOnly {
+			t.Fatalf("no HttpOnly state cookie: %v", w.Result().Cookies())
+		}
+		code, state := issuer.Authorize(t, w.Header().Get("Location"), claims)
+		if state != cookie.Value {
+			t.Fatalf("state %q not bound to the browser cookie %q", state, cookie.Value)
+		}
+		return cookie, "/api/oidc/callback?" + url.Values{"state": {state}, "code": {code}}.Encode()
+	}
+	callback := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("provisions the user and hands over tokens", func(t *testing.T) {
+		cookie, path := start(t, map[string]interface{}{"sub": "u-1", "preferred_username": "alice", "groups": []string{"kube-admins"}})
+		w := callback(path, cookie)
+		if w.Code != http.StatusFound {
+			t.Fatalf("callback: status %d: %s", w.Code, w.Body)
+		}
+		location, _ := url.Parse(w.Header().Get("Location"))
+		fragment, _ := url.ParseQuery(location.Fragment)
+		if location.Path != "/oidc/callback" || fragment.Get("token") == "" || fragment.Get("refresh_token") == "" || fragment.Get("role") != "admin" {
+			t.Fatalf("redirected to %s", location)
+		}
+
+		var user models.User
+		if err := database.DB.Where("auth_source = ? AND external_id = ?", "oidc", "u-1").First(&user).Error; err != nil {
+			t.Fatalf("user not provisioned: %v", err)
+		}
+		if user.Username != "alice" || user.Role != "admin" {
+			t.Errorf("provisioned %+v", user)
+		}
+		if claims, err := utils.ValidateToken(fragment.Get("token")); err != nil || claims["username"] != "alice" {
+			t.Errorf("access token: %v, %v", claims, err)
+		}
+		if got, want := fragment["capabilities"], utils.EffectiveCapabilities("admin"); !reflect.DeepEqual(got, want) {
+			t.Errorf("capabilities = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("demotes an admin removed from the admin group", func(t *testing.T) {
+		cookie, path := start(t, map[string]interface{}{"sub": "u-1", "preferred_username": "alice", "groups": []string{"developers"}})
+		w := callback(path, cookie)
+		if w.Code != http.StatusFound {
+			t.Fatalf("callback: status %d: %s", w.Code, w.Body)
+		}
+		location, _ := url.Parse(w.Header().Get("Location"))
+		fragment, _ := url.ParseQuery(location.Fragment)
+		var user models.User
+		database.DB.Where("username = ?", "alice").First(&user)
+		if user.Role != "user" || fragment.Get("role") != "user" {
+			t.Errorf("role = %q, handed over %q, want user", user.Role, fragment.Get("role"))
+		}
+	})
+
+	t.Run("keeps a custom role without the admin group", func(t *testing.T) {
+		database.DB.Model(&models.User{}).Where("username = ?", "alice").Update("role", "auditor")
+		cookie, path := start(t, map[string]interface{}{"sub": "u-1", "preferred_username": "alice", "groups": []string{"developers"}})
+		if w := callback(path, cookie); w.Code != http.StatusFound {
+			t.Fatalf("callback: status %d: %s", w.Code, w.Body)
+		}
+		var user models.User
+		database.DB.Where("username = ?", "alice").First(&user)
+		if user.Role != "auditor" {
+			t.Errorf("role = %q, want auditor", user.Role)
+		}
+	})
+
+	t.Run("rejects a missing or foreign state cookie", func(t *testing.T) {
+		_, path := start(t, map[string]interface{}{"preferred_username": "alice"})
+		if w := callback(path, nil); w.Code != http.StatusBadRequest {
+			t.Errorf("without cookie: status %d", w.Code)
+		}
+		other, _ := start(t, map[string]interface{}{"preferred_username": "alice"})
+		if w := callback(path, other); w.Code != http.StatusBadRequest {
+			t.Errorf("with another login's cookie: status %d", w.Code)
+		}
+	})
+
+	t.Run("rejects identity provider errors", func(t *testing.T) {
+		cookie, _ := start(t, nil)
+		w := callback("/api/oidc/callback?error=access_denied&state="+cookie.Value, cookie)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("status %d", w.Code)
+		}
+	})
+
+	t.Run("requires MFA from the provider when the policy applies", func(t *testing.T) {
+		utils.SetSetting(utils.SettingMFARequiredForAdmins, "true")
+		defer utils.SetSetting(utils.SettingMFARequiredForAdmins, "false")
+
+		claims := map[string]interface{}{"sub": "u-1", "preferred_username": "alice", "groups": []string{"kube-admins"}}
+		cookie, path := start(t, claims)
+		if w := callback(path, cookie); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "MFA") {
+			t.Errorf("admin without amr: status %d: %s", w.Code, w.Body)
+		}
+
+		claims["amr"] = []string{"pwd", "mfa"}
+		cookie, path = start(t, claims)
+		if w := callback(path, cookie); w.Code != http.StatusFound {
+			t.Errorf("admin with amr mfa: status %d: %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("does not take over local accounts", func(t *testing.T) {
+		cookie, path := start(t, map[string]interface{}{"sub": "u-2", "preferred_username": "mallory", "groups": []string{"kube-admins"}})
+		if w := callback(path, cookie); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), "already exists") {
+			t.Errorf("status %d: %s", w.Code, w.Body)
+		}
+	})
+
+	var logins int64
+	database.DB.Model(&models.AuditLog{}).Where("action = ? AND detail LIKE ?", "Login", "%OIDC%").Count(&logins)
+	if logins != 4 {
+		t.Errorf("got %d OIDC login audit entries, want 4", logins)
+	}
+}
@@ -0,0 +1,108 @@
+package controllers
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SetClusterOwnersInput struct {
+	UserIDs  []uint `json:"user_ids"`
+	GroupIDs []uint `json:"group_ids"`
+}
+
+func GetClusterOwners(c *gin.Context) {
+	cluster, ok := findCluster(c)
+	if !ok {
+		return
+	}
+
+	var owners []models.ClusterOwner
+	database.DB.Where("cluster_id = ?", cluster.ID).Find(&owners)
+	userIDs := make([]uint, 0, len(owners))
+	groupIDs := make([]uint, 0, len(owners))
+	for _, owner := range owners {
+		if owner.UserID != nil {
+			userIDs = append(userIDs, *owner.UserID)
+		}
+		if owner.GroupID != nil {
+			groupIDs = append(groupIDs, *owner.GroupID)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"user_ids": userIDs, "group_ids": groupIDs})
+}
+
+// SetClusterOwners replaces the users and groups that own a cluster.
+func SetClusterOwners(c *gin.Context) {
+	var input SetClusterOwnersInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cluster, ok := findCluster(c)
+	if !ok {
+		return
+	}
+
+	userIDs, groupIDs := uniqueIDs(input.UserIDs), uniqueIDs(input.GroupIDs)
+	var users, groups int64
+	database.DB.Model(&models.User{}).Where("id IN ?", userIDs).Count(&users)
+	database.DB.Model(&models.Group{}).Where("id IN ?", groupIDs).Count(&groups)
+	if int(users) != len(userIDs) || int(groups) != len(groupIDs) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown user or group"})
+		return
+	}
+
+	owners := make([]models.ClusterOwner, 0, len(userIDs)+len(groupIDs))
+	for i := range userIDs {
+		owners = append(owners, models.ClusterOwner{ClusterID: cluster.ID, UserID: &userIDs[i]})
+	}
+	for i := range groupIDs {
+		owners = append(owners, models.ClusterOwner{ClusterID: cluster.ID, GroupID: &groupIDs[i]})
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Where("cluster_id = ?", cluster.ID).Delete(&models.ClusterOwner{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear owners"})
+		return
+	}
+	for _, owner := range owners {
+		if err := tx.Create(&owner).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add owner"})
+			return
+		}
+	}
+	tx.Commit()
+
+	utils.LogClusterAudit(c, cluster.ID, "SetClusterOwners",
+		fmt.Sprintf("Set owners of cluster %s to %d users and %d groups", cluster.Name, len(userIDs), len(groupIDs)))
+	c.JSON(http.StatusOK, gin.H{"message": "Owners updated"})
+}
+
+// GetClusterAuditLogs returns the audit trail of a single cluster.
+func GetClusterAuditLogs(c *gin.Context) {
+	cluster, ok := findCluster(c)
+	if !ok {
+		return
+	}
+
+	logs := []models.AuditLog{}
+	database.DB.Preload("User", utils.Unscoped).Where("cluster_id = ?", cluster.ID).Order("created_at desc").Find(&logs)
+	c.JSON(http.StatusOK, logs)
+}
+
+func findCluster(c *gin.Context) (models.Cluster, bool) {
+	var cluster models.Cluster
+	if err := database.DB.First(&cluster, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+		return cluster, false
+	}
+	return cluster, true
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/middleware"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"testing"
+)
+
+func TestClusterOwnerAccess(t *testing.T) {
+	setupTestDB(t)
+	owner := createUser(t, "owner", "user")
+	other := createUser(t, "other", "user")
+	owned := createCluster(t, "owned")
+	notOwned := createCluster(t, "not-owned")
+	database.DB.Create(&models.ClusterOwner{ClusterID: owned.ID, UserID: &owner.ID})
+
+	r := testRouter(owner)
+	r.GET("/clusters/:id/config", GetClusterConfig)
+	r.POST("/clusters/:id/permissions", middleware.RequireCapabilityOrOwner(utils.CapPermissionsManage), SetClusterPermissions)
+
+	// Ownership lists the cluster but grants no level, so it cannot be
+	// downloaded either
+	if got := visibleClusters(t, owner); len(got) != 1 || got["owned"] != "" {
+		t.Errorf("owner sees %v, want only the owned cluster without a level", got)
+	}
+	if w := doJSON(t, r, http.MethodGet, fmt.Sprintf("/clusters/%d/config", owned.ID), nil); w.Code != http.StatusForbidden {
+		t.Errorf("owner without a grant downloaded the kubeconfig: status %d", w.Code)
+	}
+
+	grants := map[string]interface{}{"grants": []map[string]interface{}{{"user_id": other.ID, "level": "view"}}}
+	if w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/clusters/%d/permissions", notOwned.ID), grants); w.Code != http.StatusForbidden {
+		t.Errorf("owner changed access to a cluster they do not own: status %d", w.Code)
+	}
+	if w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/clusters/%d/permissions", owned.ID), grants); w.Code != http.StatusOK {
+		t.Fatalf("grant other: status %d: %s", w.Code, w.Body)
+	}
+	var alerts int64
+	database.DB.Model(&models.AuditLog{}).Where("action = ?", "SelfGrant").Count(&alerts)
+	if alerts != 0 {
+		t.Errorf("granting someone else was flagged as a self-grant")
+	}
+
+	grants = map[string]interface{}{"grants": []map[string]interface{}{
+		{"user_id": other.ID, "level": "view"},
+		{"user_id": owner.ID, "level": "admin"},
+	}}
+	if w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/clusters/%d/permissions", owned.ID), grants); w.Code != http.StatusOK {
+		t.Fatalf("self-grant: status %d: %s", w.Code, w.Body)
+	}
+	var entry models.AuditLog
+	database.DB.Where("action = ?", "SetClusterPermissions").Order("id desc").First(&entry)
+	if want := "Changed access to cluster owned from other (view) to other (view), owner (admin)"; entry.Detail != want {
+		t.Errorf("audit detail %q, want %q", entry.Detail, want)
+	}
+	var alert models.AuditLog
+	if err := database.DB.Where("action = ?", "SelfGrant").First(&alert).Error; err != nil {
+		t.Fatal("self-grant was not flagged")
+	}
+	if alert.Severity != utils.SeverityHigh || alert.ClusterID == nil || *alert.ClusterID != owned.ID ||
+		alert.Detail != "owner changed their own access to cluster owned from (none) to owner (admin)" {
+		t.Errorf("self-grant alert: %+v", alert)
+	}
+
+	// With a grant, the owner has the same level in both places
+	if level := visibleClusters(t, owner)["owned"]; level != utils.LevelAdmin {
+		t.Errorf("listed level %q after self-grant, want admin", level)
+	}
+	if w := doJSON(t, r, http.MethodGet, fmt.Sprintf("/clusters/%d/config", owned.ID), nil); w.Code != http.StatusOK {
+		t.Errorf("download after self-grant: status %d: %s", w.Code, w.Body)
+	}
+}
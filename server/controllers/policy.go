@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/policy"
+	"kubeswitch/server/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PolicyInput struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	Action      string `json:"action" binding:"required,oneof=kubeconfig admin *"`
+	Condition   string `json:"condition" binding:"required"`
+	Message     string `json:"message"`
+	Disabled    bool   `json:"disabled"`
+}
+
+// EvaluatePolicyInput describes a hypothetical request for a dry run. If
+// Condition is set only it is evaluated, otherwise every enabled policy for
+// the action is.
+type EvaluatePolicyInput struct {
+	UserID     uint       `json:"user_id" binding:"required"`
+	ClusterID  uint       `json:"cluster_id"`
+	Action     string     `json:"action" binding:"required,oneof=kubeconfig admin"`
+	Level      string     `json:"level" binding:"omitempty,oneof=view edit admin"`
+	IP         string     `json:"ip"`
+	Method     string     `json:"method"`
+	Path       string     `json:"path"`
+	Time       *time.Time `json:"time"`
+	BreakGlass bool       `json:"break_glass"`
+	Condition  string     `json:"condition"`
+}
+
+func GetPolicies(c *gin.Context) {
+	var policies []models.Policy
+	database.DB.Order("id").Find(&policies)
+	c.JSON(http.StatusOK, policies)
+}
+
+func CreatePolicy(c *gin.Context) {
+	var input PolicyInput
+	if !bindPolicy(c, &input) {
+		return
+	}
+
+	p := models.Policy{
+		Name:        input.Name,
+		Description: input.Description,
+		Action:      input.Action,
+		Condition:   input.Condition,
+		Message:     input.Message,
+		Disabled:    input.Disabled,
+	}
+	if !checkLockout(c, p) {
+		return
+	}
+	if err := database.DB.Create(&p).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A policy with this name already exists"})
+		return
+	}
+
+	utils.LogAuditContext(c, "CreatePolicy", "Created policy "+p.Name+" for "+p.Action+": "+p.Condition)
+	c.JSON(http.StatusCreated, p)
+}
+
+func UpdatePolicy(c *gin.Context) {
+	var input PolicyInput
+	if !bindPolicy(c, &input) {
+		return
+	}
+
+	var p models.Policy
+	if err := database.DB.First(&p, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
+		return
+	}
+
+	p.Name = input.Name
+	p.Description = input.Description
+	p.Action = input.Action
+	p.Condition = input.Condition
+	p.Message = input.Message
+	p.Disabled = input.Disabled
+	if !checkLockout(c, p) {
+		return
+	}
+	if err := database.DB.Save(&p).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A policy with this name already exists"})
+		return
+	}
+
+	state := "enabled"
+	if p.Disabled {
+		state = "disabled"
+	}
+	utils.LogAuditContext(c, "UpdatePolicy", "Updated policy "+p.Name+" ("+state+") for "+p.Action+": "+p.Condition)
+	c.JSON(http.StatusOK, p)
+}
+
+func DeletePolicy(c *gin.Context) {
+	var p models.Policy
+	if err := database.DB.First(&p, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Policy not found"})
+		return
+	}
+	if err := database.DB.Delete(&p).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete policy"})
+		return
+	}
+
+	utils.LogAuditContext(c, "DeletePolicy", "Deleted policy "+p.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Policy deleted"})
+}
+
+// EvaluatePolicies is a dry run: it reports what the policies would decide
+// for a request without performing it.
+func EvaluatePolicies(c *gin.Context) {
+	var input EvaluatePolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, input.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	in := policy.UserInput(user)
+	in.Action = input.Action
+	in.Level = input.Level
+	in.IP = input.IP
+	in.Method = input.Method
+	in.Path = input.Path
+	if input.Time != nil {
+		in.Time = *input.Time
+	}
+	if input.Action == policy.ActionKubeconfig {
+		var cluster models.Cluster
+		if err := database.DB.First(&cluster, input.ClusterID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cluster not found"})
+			return
+		}
+		in.Cluster = &cluster
+		if in.Level == "" {
+			in.Level = utils.ClusterAccessLevel(user.ID, cluster.ID)
+		}
+		in.BreakGlass = input.BreakGlass || utils.HasBreakGlassAccess(user.ID, cluster.ID)
+		if in.Method == "" {
+			in.Method, in.Path = http.MethodGet, "/api/clusters/:id/config"
+		}
+	}
+
+	if input.Condition != "" {
+		if err := policy.Check(input.Condition); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid condition: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, policy.Evaluate([]models.Policy{{Name: "(dry run)", Action: input.Action, Condition: input.Condition}}, in))
+		return
+	}
+	c.JSON(http.StatusOK, policy.Enforce(in))
+}
+
+func bindPolicy(c *gin.Context, input *PolicyInput) bool {
+	if err := c.ShouldBindJSON(input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	if err := policy.Check(input.Condition); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid condition: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// checkLockout refuses admin policies that would deny the request saving
+// them, so that a typo cannot lock the caller out of fixing it.
+func checkLockout(c *gin.Context, p models.Policy) bool {
+	if p.Disabled || p.Action == policy.ActionKubeconfig {
+		return true
+	}
+	decision := policy.Evaluate([]models.Policy{p}, policy.RequestInput(c, policy.ActionAdmin, nil, ""))
+	if !decision.Allowed {
+		message := "Policy would deny this request and lock you out"
+		if err := decision.Results[0].Error; err != "" {
+			message += ": " + err
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": message})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package controllers
+
+import (
+	"kubeswitch/server/auth"
+	"kubeswitch/server/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProxyLogin gives the web UI a session for the identity asserted by a
+// trusted authenticating proxy, so users are not asked to log in twice.
+func ProxyLogin(c *gin.Context) {
+	proxy, err := auth.LoadProxyConfig()
+	if err != nil || !proxy.Asserted(c.Request) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "No identity from a trusted proxy"})
+		return
+	}
+
+	user, err := proxy.ProxyUser(c.Request)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := createTokens(c, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	utils.LogAudit(user.ID, "Login", "User logged in via auth proxy", c.ClientIP())
+	c.JSON(http.StatusOK, tokens)
+}
@@ -0,0 +1,216 @@
+package controllers
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleInput struct {
+	Name         string   `json:"name" binding:"required"`
+	Description  string   `json:"description"`
+	Capabilities []string `json:"capabilities"`
+}
+
+func GetRoles(c *gin.Context) {
+	var roles []models.Role
+	database.DB.Order("name").Find(&roles)
+
+	type userCount struct {
+		Role  string
+		Count int64
+	}
+	var counts []userCount
+	database.DB.Model(&models.User{}).Select("role, count(*) as count").Group("role").Scan(&counts)
+	byRole := make(map[string]int64, len(counts))
+	for _, uc := range counts {
+		byRole[uc.Role] = uc.Count
+	}
+	for i := range roles {
+		roles[i].UserCount = byRole[roles[i].Name]
+	}
+
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetCapabilities lists the capabilities a role can be given.
+func GetCapabilities(c *gin.Context) {
+	c.JSON(http.StatusOK, utils.Capabilities)
+}
+
+func CreateRole(c *gin.Context) {
+	var input RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	capabilities, ok := checkRoleCapabilities(c, input.Capabilities)
+	if !ok {
+		return
+	}
+
+	role := models.Role{Name: input.Name, Description: input.Description, Capabilities: capabilities}
+	if err := database.DB.Create(&role).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A role with this name already exists"})
+		return
+	}
+
+	utils.LogAuditContext(c, "CreateRole", "Created role "+role.Name+" with capabilities "+displayCapabilities(role.Capabilities))
+	c.JSON(http.StatusCreated, role)
+}
+
+// UpdateRole changes a role's description and capabilities. Roles are
+// referenced by name, so they cannot be renamed.
+func UpdateRole(c *gin.Context) {
+	var input RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	role, ok := findEditableRole(c)
+	if !ok {
+		return
+	}
+	if input.Name != role.Name {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Roles cannot be renamed"})
+		return
+	}
+	capabilities, ok := checkRoleCapabilities(c, input.Capabilities)
+	if !ok {
+		return
+	}
+
+	role.Description = input.Description
+	role.Capabilities = capabilities
+	if err := database.DB.Save(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	utils.LogAuditContext(c, "UpdateRole", "Set capabilities of role "+role.Name+" to "+displayCapabilities(role.Capabilities))
+	c.JSON(http.StatusOK, role)
+}
+
+func DeleteRole(c *gin.Context) {
+	role, ok := findEditableRole(c)
+	if !ok {
+		return
+	}
+
+	var users int64
+	database.DB.Model(&models.User{}).Where("role = ?", role.Name).Count(&users)
+	if users > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Role is still assigned to users"})
+		return
+	}
+
+	if err := database.DB.Delete(&role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+		return
+	}
+
+	utils.LogAuditContext(c, "DeleteRole", "Deleted role "+role.Name)
+	c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+}
+
+// findEditableRole loads the role in the URL unless it is built in or grants
+// capabilities the caller does not hold.
+func findEditableRole(c *gin.Context) (models.Role, bool) {
+	var role models.Role
+	if err := database.DB.First(&role, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return role, false
+	}
+	if role.BuiltIn {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Built-in roles cannot be changed"})
+		return role, false
+	}
+	if !utils.RoleCovers(c.GetString("role"), role.Name) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Role grants capabilities you do not have"})
+		return role, false
+	}
+	return role, true
+}
+
+// checkRoleCapabilities validates a capability list and returns it in stored
+// form. Callers can only hand out capabilities they hold themselves.
+func checkRoleCapabilities(c *gin.Context, capabilities []string) (string, bool) {
+	callerRole := c.GetString("role")
+	seen := make(map[string]bool, len(capabilities))
+	var list []string
+	for _, capability := range capabilities {
+		capability = strings.TrimSpace(capability)
+		if seen[capability] {
+			continue
+		}
+		if capability == utils.CapAll || !utils.IsValidCapability(capability) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid capability: " + capability})
+			return "", false
+		}
+		if !utils.HasCapability(callerRole, capability) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You cannot grant a capability you do not have: " + capability})
+			return "", false
+		}
+		seen[capability] = true
+		list = append(list, capability)
+	}
+	return strings.Join(list, ","), true
+}
+
+// findAssignableRole loads the named role if the caller may give it to a
+// user, i.e. it grants nothing the caller does not hold.
+func findAssignableRole(c *gin.Context, name string) (models.Role, bool) {
+	var role models.Role
+	if err := database.DB.Where("name = ?", name).First(&role).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + name})
+		return role, false
+	}
+	if !utils.RoleCovers(c.GetString("role"), role.Name) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You cannot assign a role with capabilities you do not have"})
+		return role, false
+	}
+	return role, true
+}
+
+// canManageUser stops callers from taking over accounts that are more
+// privileged than their own, e.g. by resetting their password.
+func canManageUser(c *gin.Context, user models.User) bool {
+	if !utils.RoleCovers(c.GetString("role"), user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "User has capabilities you do not have"})
+		return false
+	}
+	return true
+}
+
+// isLastRoleManager reports whether no one else could manage roles if the
+// user lost theirs.
+func isLastRoleManager(user models.User) bool {
+	managerRoles := utils.RolesWithCapability(utils.CapRolesManage)
+	if !contains(managerRoles, user.Role) {
+		return false
+	}
+	var others int64
+	database.DB.Model(&models.User{}).Where("role IN ? AND id <> ?", managerRoles, user.ID).Count(&others)
+	return others == 0
+}
+
+func displayCapabilities(capabilities string) string {
+	if capabilities == "" {
+		return "(none)"
+	}
+	return capabilities
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
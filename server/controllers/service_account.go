@@ -0,0 +1,273 @@
+package controllers
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Service accounts are users with auth_source "service". They have no
+// password, cannot log in interactively and authenticate only with API
+// tokens, which their owners or an admin manage. An account is owned by a
+// user, a group or both; every member of the owning group is an owner.
+
+type CreateServiceAccountInput struct {
+	Name         string `json:"name" binding:"required"`
+	Description  string `json:"description"`
+	OwnerID      uint   `json:"owner_id"`
+	OwnerGroupID uint   `json:"owner_group_id"`
+}
+
+type SetServiceAccountOwnerInput struct {
+	OwnerID      uint `json:"owner_id"`
+	OwnerGroupID uint `json:"owner_group_id"`
+}
+
+func GetServiceAccounts(c *gin.Context) {
+	var accounts []models.User
+	database.DB.Where("auth_source = ?", "service").Order("username").Find(&accounts)
+	c.JSON(http.StatusOK, accounts)
+}
+
+// GetMyServiceAccounts lists the service accounts the caller owns, directly
+// or through a group.
+func GetMyServiceAccounts(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	var accounts []models.User
+	database.DB.Where("auth_source = ?", "service").
+		Where("owner_id = ? OR owner_group_id IN (?)", userID,
+			database.DB.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Order("username").Find(&accounts)
+	c.JSON(http.StatusOK, accounts)
+}
+
+func CreateServiceAccount(c *gin.Context) {
+	adminUserID := c.MustGet("user_id").(uint)
+	var input CreateServiceAccountInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	owners, ok := findServiceAccountOwners(c, input.OwnerID, input.OwnerGroupID)
+	if !ok {
+		return
+	}
+
+	var count int64
+	database.DB.Model(&models.User{}).Where("username = ?", input.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A user with this name already exists"})
+		return
+	}
+
+	account := models.User{
+		Username:     input.Name,
+		Role:         utils.DefaultRole,
+		AuthSource:   "service",
+		OwnerID:      owners.userID,
+		OwnerGroupID: owners.groupID,
+		Description:  input.Description,
+	}
+	if err := database.DB.Create(&account).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create service account"})
+		return
+	}
+
+	utils.LogAudit(adminUserID, "CreateServiceAccount", "Admin created service account "+account.Username+" owned by "+owners.names, c.ClientIP())
+	c.JSON(http.StatusCreated, account)
+}
+
+func SetServiceAccountOwner(c *gin.Context) {
+	adminUserID := c.MustGet("user_id").(uint)
+	var input SetServiceAccountOwnerInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	account, ok := findServiceAccount(c)
+	if !ok {
+		return
+	}
+	owners, ok := findServiceAccountOwners(c, input.OwnerID, input.OwnerGroupID)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Model(&account).Updates(map[string]interface{}{
+		"owner_id":       owners.userID,
+		"owner_group_id": owners.groupID,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update owner"})
+		return
+	}
+
+	utils.LogAudit(adminUserID, "SetServiceAccountOwner", "Admin transferred service account "+account.Username+" to "+owners.names, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "Owner updated"})
+}
+
+func DeleteServiceAccount(c *gin.Context) {
+	adminUserID := c.MustGet("user_id").(uint)
+	account, ok := findServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	tx := database.DB.Begin()
+	if err := tx.Where("user_id = ?", account.ID).Delete(&models.APIToken{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete service account tokens"})
+		return
+	}
+	if err := tx.Where("user_id = ?", account.ID).Delete(&models.Permission{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete service account permissions"})
+		return
+	}
+	if err := tx.Where("user_id = ?", account.ID).Delete(&models.LabelPermission{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete service account permissions"})
+		return
+	}
+	if err := tx.Where("user_id = ?", account.ID).Delete(&models.ClusterOwner{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete service account cluster ownership"})
+		return
+	}
+	if err := tx.Where("user_id = ?", account.ID).Delete(&models.GroupMember{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete service account group memberships"})
+		return
+	}
+	if err := tx.Delete(&account).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete service account"})
+		return
+	}
+	tx.Commit()
+
+	utils.LogAudit(adminUserID, "DeleteServiceAccount", "Admin deleted service account "+account.Username, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "Service account deleted"})
+}
+
+func GetServiceAccountTokens(c *gin.Context) {
+	account, ok := findManagedServiceAccount(c)
+	if !ok {
+		return
+	}
+	var tokens []models.APIToken
+	database.DB.Where("user_id = ?", account.ID).Order("created_at desc").Find(&tokens)
+	c.JSON(http.StatusOK, tokens)
+}
+
+func CreateServiceAccountToken(c *gin.Context) {
+	account, ok := findManagedServiceAccount(c)
+	if !ok {
+		return
+	}
+	raw, token, ok := createAPIToken(c, account.ID)
+	if !ok {
+		return
+	}
+
+	utils.LogAuditContext(c, "CreateToken", "Created token "+token.Name+" for service account "+account.Username)
+
+	// The raw token is only ever returned here.
+	c.JSON(http.StatusCreated, gin.H{"token": raw, "api_token": token})
+}
+
+func DeleteServiceAccountToken(c *gin.Context) {
+	account, ok := findManagedServiceAccount(c)
+	if !ok {
+		return
+	}
+	token, ok := deleteAPIToken(c, account.ID, c.Param("token_id"))
+	if !ok {
+		return
+	}
+
+	utils.LogAuditContext(c, "RevokeToken", "Revoked token "+token.Name+" of service account "+account.Username)
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+func findServiceAccount(c *gin.Context) (models.User, bool) {
+	var account models.User
+	if err := database.DB.Where("id = ? AND auth_source = ?", c.Param("id"), "service").First(&account).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Service account not found"})
+		return account, false
+	}
+	return account, true
+}
+
+// findManagedServiceAccount loads the service account in the URL if the
+// caller is one of its owners or may manage all service accounts.
+func findManagedServiceAccount(c *gin.Context) (models.User, bool) {
+	account, ok := findServiceAccount(c)
+	if !ok {
+		return account, false
+	}
+
+	userID := c.MustGet("user_id").(uint)
+	if !utils.HasCapability(c.GetString("role"), utils.CapServiceAccountsManage) && !ownsServiceAccount(userID, account) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only the owner or a service account manager can manage this service account"})
+		return account, false
+	}
+	return account, true
+}
+
+func ownsServiceAccount(userID uint, account models.User) bool {
+	if account.OwnerID != nil && *account.OwnerID == userID {
+		return true
+	}
+	if account.OwnerGroupID == nil {
+		return false
+	}
+	var members int64
+	database.DB.Model(&models.GroupMember{}).Where("group_id = ? AND user_id = ?", *account.OwnerGroupID, userID).Count(&members)
+	return members > 0
+}
+
+// serviceAccountOwners are the owners to set on a service account, with
+// their names for the audit log.
+type serviceAccountOwners struct {
+	userID  *uint
+	groupID *uint
+	names   string
+}
+
+// findServiceAccountOwners checks that at least one owner is given, that the
+// user is a human and that the group exists. Zero IDs are left unset.
+func findServiceAccountOwners(c *gin.Context, ownerID, groupID uint) (serviceAccountOwners, bool) {
+	var owners serviceAccountOwners
+	if ownerID == 0 && groupID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Set owner_id, owner_group_id or both"})
+		return owners, false
+	}
+
+	var names []string
+	if ownerID != 0 {
+		var owner models.User
+		if err := database.DB.Where("id = ? AND auth_source <> ?", ownerID, "service").First(&owner).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Owner must be an existing user"})
+			return owners, false
+		}
+		owners.userID = &owner.ID
+		names = append(names, owner.Username)
+	}
+	if groupID != 0 {
+		var group models.Group
+		if err := database.DB.First(&group, groupID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Owner group must be an existing group"})
+			return owners, false
+		}
+		owners.groupID = &group.ID
+		names = append(names, "group "+group.Name)
+	}
+	owners.names = strings.Join(names, " and ")
+	return owners, true
+}
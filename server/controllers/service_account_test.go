@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"testing"
+)
+
+// TestGroupOwnedServiceAccount checks that every member of the owning group
+// can manage a service account's tokens, and that the account outlives its
+// human owner.
+func TestGroupOwnedServiceAccount(t *testing.T) {
+	setupTestDB(t)
+	admin := createUser(t, "admin", "admin")
+	alice := createUser(t, "alice", "user")
+	bob := createUser(t, "bob", "user")
+	carol := createUser(t, "carol", "user")
+	group := models.Group{Name: "platform"}
+	database.DB.Create(&group)
+	database.DB.Create(&models.GroupMember{GroupID: group.ID, UserID: bob.ID})
+
+	r := testRouter(admin)
+	r.POST("/service-accounts", CreateServiceAccount)
+	r.DELETE("/users/:id", DeleteUser)
+	r.DELETE("/groups/:id", DeleteGroup)
+	if w := doJSON(t, r, http.MethodPost, "/service-accounts", map[string]interface{}{"name": "deploy-bot"}); w.Code != http.StatusBadRequest {
+		t.Errorf("create without an owner: status %d", w.Code)
+	}
+	w := doJSON(t, r, http.MethodPost, "/service-accounts", map[string]interface{}{"name": "ci-bot", "owner_id": alice.ID, "owner_group_id": group.ID})
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: status %d: %s", w.Code, w.Body)
+	}
+	var account models.User
+	json.Unmarshal(w.Body.Bytes(), &account)
+
+	// The account stays with the group when its human owner leaves.
+	if w := doJSON(t, r, http.MethodDelete, fmt.Sprintf("/users/%d", alice.ID), nil); w.Code != http.StatusOK {
+		t.Fatalf("delete owner: status %d: %s", w.Code, w.Body)
+	}
+	if w := doJSON(t, r, http.MethodDelete, fmt.Sprintf("/groups/%d", group.ID), nil); w.Code != http.StatusBadRequest {
+		t.Errorf("delete the last owning group: status %d", w.Code)
+	}
+
+	tokens := fmt.Sprintf("/service-accounts/%d/tokens", account.ID)
+	for _, tt := range []struct {
+		user models.User
+		want int
+	}{{bob, http.StatusCreated}, {carol, http.StatusForbidden}} {
+		r := testRouter(tt.user)
+		r.GET("/my/service-accounts", GetMyServiceAccounts)
+		r.POST("/service-accounts/:id/tokens", CreateServiceAccountToken)
+		w := doJSON(t, r, http.MethodPost, tokens, map[string]interface{}{"name": "deploy", "scopes": []string{utils.ScopeClustersRead}})
+		if w.Code != tt.want {
+			t.Errorf("%s creates a token: status %d, want %d: %s", tt.user.Username, w.Code, tt.want, w.Body)
+		}
+
+		var mine []models.User
+		json.Unmarshal(doJSON(t, r, http.MethodGet, "/my/service-accounts", nil).Body.Bytes(), &mine)
+		if owns := len(mine) == 1; owns != (tt.want == http.StatusCreated) {
+			t.Errorf("%s lists %d service accounts", tt.user.Username, len(mine))
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+func GetMySessions(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	currentID := c.GetUint("session_id")
+
+	sessions := utils.ActiveSessions(userID)
+	for i := range sessions {
+		sessions[i].Current = sessions[i].ID == currentID
+	}
+	c.JSON(http.StatusOK, sessions)
+}
+
+// DeleteMySessions signs out every other device, keeping the caller's session.
+func DeleteMySessions(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+
+	count, err := utils.RevokeUserSessions(userID, c.GetUint("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	utils.LogAudit(userID, "RevokeSessions", fmt.Sprintf("Signed out %d other sessions", count), c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "count": count})
+}
+
+func DeleteMySession(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	revokeSession(c, userID, c.Param("id"))
+}
+
+func GetUserSessions(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+	c.JSON(http.StatusOK, utils.ActiveSessions(user.ID))
+}
+
+// DeleteUserSessions signs a user out everywhere, e.g. after a lost laptop.
+func DeleteUserSessions(c *gin.Context) {
+	adminUserID := c.MustGet("user_id").(uint)
+
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+
+	count, err := utils.RevokeUserSessions(user.ID, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke sessions"})
+		return
+	}
+
+	utils.LogAudit(adminUserID, "AdminRevokeSessions", fmt.Sprintf("Admin signed out %d sessions of user %s", count, user.Username), c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "Sessions revoked", "count": count})
+}
+
+func DeleteUserSession(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+	revokeSession(c, user.ID, c.Param("session_id"))
+}
+
+// revokeSession revokes one session, making sure it belongs to userID.
+func revokeSession(c *gin.Context, userID uint, sessionID string) {
+	var session models.Session
+	if err := database.DB.Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).First(&session).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	if err := utils.RevokeSession(session.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	utils.LogAuditContext(c, "RevokeSession", fmt.Sprintf("Revoked session %d (%s, %s) of user %d", session.ID, session.Device, session.IP, userID))
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
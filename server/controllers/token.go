@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateAPITokenInput struct {
+	Name          string   `json:"name" binding:"required"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
+func GetMyTokens(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	var tokens []models.APIToken
+	database.DB.Where("user_id = ?", userID).Order("created_at desc").Find(&tokens)
+	c.JSON(http.StatusOK, tokens)
+}
+
+func CreateMyToken(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	raw, token, ok := createAPIToken(c, userID)
+	if !ok {
+		return
+	}
+
+	utils.LogAudit(userID, "CreateToken", "Created personal access token "+token.Name, c.ClientIP())
+
+	// The raw token is only ever returned here.
+	c.JSON(http.StatusCreated, gin.H{"token": raw, "api_token": token})
+}
+
+func DeleteMyToken(c *gin.Context) {
+	userID := c.MustGet("user_id").(uint)
+	token, ok := deleteAPIToken(c, userID, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	utils.LogAudit(userID, "RevokeToken", "Revoked personal access token "+token.Name, c.ClientIP())
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+// createAPIToken binds CreateAPITokenInput and stores a new token for the
+// user. On failure it has already written the error response.
+func createAPIToken(c *gin.Context, userID uint) (string, models.APIToken, bool) {
+	var input CreateAPITokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", models.APIToken{}, false
+	}
+
+	for _, scope := range input.Scopes {
+		if !utils.IsValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope " + scope})
+			return "", models.APIToken{}, false
+		}
+	}
+	if input.ExpiresInDays == 0 {
+		input.ExpiresInDays = 30
+	}
+
+	var count int64
+	database.DB.Model(&models.APIToken{}).Where("user_id = ? AND name = ?", userID, input.Name).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A token with this name already exists"})
+		return "", models.APIToken{}, false
+	}
+
+	raw, hash, err := utils.GenerateAPIToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return "", models.APIToken{}, false
+	}
+
+	token := models.APIToken{
+		UserID:    userID,
+		Name:      input.Name,
+		TokenHash: hash,
+		Prefix:    raw[:len(utils.APITokenPrefix)+6],
+		Scopes:    strings.Join(input.Scopes, ","),
+		ExpiresAt: time.Now().AddDate(0, 0, input.ExpiresInDays),
+	}
+	if err := database.DB.Create(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return "", models.APIToken{}, false
+	}
+	return raw, token, true
+}
+
+func deleteAPIToken(c *gin.Context, userID uint, tokenID string) (models.APIToken, bool) {
+	var token models.APIToken
+	if err := database.DB.Where("id = ? AND user_id = ?", tokenID, userID).First(&token).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return token, false
+	}
+
+	if err := database.DB.Delete(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return token, false
+	}
+	return token, true
+}
@@ -1,10 +1,13 @@
 package controllers
 
 import (
+	"fmt"
 	"kubeswitch/server/database"
 	"kubeswitch/server/models"
 	"kubeswitch/server/utils"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -12,12 +15,12 @@ import (
 type CreateUserInput struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
-	Role     string `json:"role" binding:"required,oneof=admin user"`
+	Role     string `json:"role" binding:"required"`
 }
 
 func GetUsers(c *gin.Context) {
 	var users []models.User
-	database.DB.Find(&users)
+	database.DB.Where("auth_source <> ?", "service").Find(&users)
 	c.JSON(http.StatusOK, users)
 }
 
@@ -28,16 +31,27 @@ func CreateUser(c *gin.Context) {
 		return
 	}
 
+	if _, ok := findAssignableRole(c, input.Role); !ok {
+		return
+	}
+	if !checkPasswordPolicy(c, models.User{Username: input.Username}, input.Password) {
+		return
+	}
+
 	hashedPassword, err := utils.HashPassword(input.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
 
+	// The admin chose this password, so the user has to replace it.
+	now := time.Now()
 	user := models.User{
-		Username: input.Username,
-		Password: hashedPassword,
-		Role:     input.Role,
+		Username:           input.Username,
+		Password:           hashedPassword,
+		Role:               input.Role,
+		PasswordChangedAt:  &now,
+		MustChangePassword: true,
 	}
 
 	if err := database.DB.Create(&user).Error; err != nil {
@@ -48,8 +62,11 @@ func CreateUser(c *gin.Context) {
 	c.JSON(http.StatusCreated, user)
 }
 
+// SetPermissionsInput replaces a user's grants. Clusters in ClusterIDs are
+// granted without a time limit; Grants may carry a window.
 type SetPermissionsInput struct {
-	ClusterIDs []uint `json:"cluster_ids" binding:"required"`
+	ClusterIDs []uint              `json:"cluster_ids"`
+	Grants     []ClusterGrantInput `json:"grants" binding:"dive"`
 }
 
 type ChangePasswordInput struct {
@@ -62,7 +79,7 @@ type AdminChangePasswordInput struct {
 }
 
 type UpdateUserRoleInput struct {
-	Role string `json:"role" binding:"required,oneof=admin user"`
+	Role string `json:"role" binding:"required"`
 }
 
 func SetUserPermissions(c *gin.Context) {
@@ -72,30 +89,55 @@ func SetUserPermissions(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.ClusterIDs == nil && input.Grants == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "cluster_ids or grants is required"})
+		return
+	}
+	for _, grant := range input.Grants {
+		if err := grant.validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	var user models.User
 	if err := database.DB.First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
+	if !canManageUser(c, user) {
+		return
+	}
+
+	var previous []models.Permission
+	database.DB.Where("user_id = ? AND break_glass IS NOT ?", user.ID, true).Order("id").Find(&previous)
 
 	// Transaction to update permissions
 	tx := database.DB.Begin()
-	
-	// Remove existing permissions
-	if err := tx.Where("user_id = ?", user.ID).Delete(&models.Permission{}).Error; err != nil {
+
+	// Remove existing permissions, keeping break-glass grants until they expire
+	if err := tx.Where("user_id = ? AND break_glass IS NOT ?", user.ID, true).Delete(&models.Permission{}).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear permissions"})
 		return
 	}
 
 	// Add new permissions
+	perms := make([]models.Permission, 0, len(input.ClusterIDs)+len(input.Grants))
 	for _, clusterID := range input.ClusterIDs {
-		perm := models.Permission{
+		perms = append(perms, models.Permission{UserID: user.ID, ClusterID: clusterID})
+	}
+	for _, grant := range input.Grants {
+		perms = append(perms, models.Permission{
 			UserID:    user.ID,
-			ClusterID: clusterID,
-		}
-		if err := tx.Create(&perm).Error; err != nil {
+			ClusterID: grant.ClusterID,
+			Level:     grant.Level,
+			NotBefore: grant.NotBefore,
+			ExpiresAt: grant.ExpiresAt,
+		})
+	}
+	for i := range perms {
+		if err := tx.Create(&perms[i]).Error; err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add permission"})
 			return
@@ -103,6 +145,13 @@ func SetUserPermissions(c *gin.Context) {
 	}
 
 	tx.Commit()
+
+	detail := fmt.Sprintf("Changed access of user %s from %s to %s", user.Username, formatUserPermissions(previous), formatUserPermissions(perms))
+	if user.ID == c.GetUint("user_id") {
+		utils.LogAlert(c, "SelfGrant", detail)
+	} else {
+		utils.LogAuditContext(c, "SetUserPermissions", detail)
+	}
 	c.JSON(http.StatusOK, gin.H{"message": "Permissions updated"})
 }
 
@@ -113,13 +162,15 @@ func GetUserPermissions(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch permissions"})
 		return
 	}
-	
+
 	var clusterIDs []uint
+	grants := make([]map[string]interface{}, 0, len(perms))
 	for _, p := range perms {
 		clusterIDs = append(clusterIDs, p.ClusterID)
+		grants = append(grants, grantView(p))
 	}
-	
-	c.JSON(http.StatusOK, gin.H{"cluster_ids": clusterIDs})
+
+	c.JSON(http.StatusOK, gin.H{"cluster_ids": clusterIDs, "grants": grants})
 }
 
 func ChangePassword(c *gin.Context) {
@@ -142,6 +193,10 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
+	if !checkPasswordPolicy(c, user, input.NewPassword) {
+		return
+	}
+
 	// Hash new password
 	hashedPassword, err := utils.HashPassword(input.NewPassword)
 	if err != nil {
@@ -150,20 +205,30 @@ func ChangePassword(c *gin.Context) {
 	}
 
 	// Update password
-	user.Password = hashedPassword
-	if err := database.DB.Save(&user).Error; err != nil {
+	if err := utils.SetUserPassword(&user, hashedPassword, false); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
 
+	// Sign out every other device in case the old password was stolen.
+	utils.RevokeUserSessions(user.ID, c.GetUint("session_id"))
 	utils.LogAudit(userID, "ChangePassword", "User changed password", c.ClientIP())
-	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
+
+	// Replace the caller's token, which may be restricted to this endpoint
+	// because the old password had expired.
+	response := gin.H{"message": "Password updated successfully"}
+	if sessionID := c.GetUint("session_id"); sessionID != 0 {
+		if token, err := utils.GenerateToken(user, sessionID); err == nil {
+			response["token"] = token
+		}
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func AdminChangePassword(c *gin.Context) {
 	targetUserID := c.Param("id")
 	adminUserID := c.MustGet("user_id").(uint)
-	
+
 	var input AdminChangePasswordInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -175,6 +240,17 @@ func AdminChangePassword(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
+	if user.AuthSource == "service" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Service accounts cannot have a password"})
+		return
+	}
+	if !canManageUser(c, user) {
+		return
+	}
+
+	if !checkPasswordPolicy(c, user, input.NewPassword) {
+		return
+	}
 
 	// Hash new password
 	hashedPassword, err := utils.HashPassword(input.NewPassword)
@@ -183,13 +259,19 @@ func AdminChangePassword(c *gin.Context) {
 		return
 	}
 
-	// Update password
-	user.Password = hashedPassword
-	if err := database.DB.Save(&user).Error; err != nil {
+	// Update password; the user must pick their own at next login
+	if err := utils.SetUserPassword(&user, hashedPassword, true); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
 
+	// Sign the user out everywhere, keeping only the caller's own session
+	// when resetting their own password.
+	var keep uint
+	if user.ID == adminUserID {
+		keep = c.GetUint("session_id")
+	}
+	utils.RevokeUserSessions(user.ID, keep)
 	utils.LogAudit(adminUserID, "AdminChangePassword", "Admin changed password for user "+user.Username, c.ClientIP())
 	c.JSON(http.StatusOK, gin.H{"message": "Password updated successfully"})
 }
@@ -197,28 +279,59 @@ func AdminChangePassword(c *gin.Context) {
 func DeleteUser(c *gin.Context) {
 	userID := c.Param("id")
 	adminUserID := c.MustGet("user_id").(uint)
-	
+
 	var user models.User
 	if err := database.DB.First(&user, userID).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
 
-	// Don't allow deleting admin user
-	if user.Role == "admin" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete admin user"})
+	if !canManageUser(c, user) {
+		return
+	}
+	// Someone must be left who can manage roles
+	if isLastRoleManager(user) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete the last user who can manage roles"})
+		return
+	}
+
+	// Service accounts that a group also owns stay with the group
+	var owned int64
+	database.DB.Model(&models.User{}).Where("owner_id = ? AND owner_group_id IS NULL", user.ID).Count(&owned)
+	if owned > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "User owns service accounts; transfer or delete them first"})
 		return
 	}
 
 	// Transaction to delete user and related permissions
 	tx := database.DB.Begin()
-	
+
 	// Delete user permissions first
 	if err := tx.Where("user_id = ?", user.ID).Delete(&models.Permission{}).Error; err != nil {
 		tx.Rollback()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user permissions"})
 		return
 	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.LabelPermission{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete user permissions"})
+		return
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.ClusterOwner{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete cluster ownership"})
+		return
+	}
+	if err := tx.Where("user_id = ?", user.ID).Delete(&models.GroupMember{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete group memberships"})
+		return
+	}
+	if err := tx.Model(&models.User{}).Where("owner_id = ?", user.ID).Update("owner_id", nil).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update service account owners"})
+		return
+	}
 
 	// Delete user
 	if err := tx.Delete(&user).Error; err != nil {
@@ -228,6 +341,7 @@ func DeleteUser(c *gin.Context) {
 	}
 
 	tx.Commit()
+	utils.RevokeUserSessions(user.ID, 0)
 	utils.LogAudit(adminUserID, "DeleteUser", "Admin deleted user "+user.Username, c.ClientIP())
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
@@ -235,7 +349,7 @@ func DeleteUser(c *gin.Context) {
 func UpdateUserRole(c *gin.Context) {
 	userID := c.Param("id")
 	adminUserID := c.MustGet("user_id").(uint)
-	
+
 	var input UpdateUserRoleInput
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
@@ -247,6 +361,21 @@ func UpdateUserRole(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
 	}
+	if !canManageUser(c, user) {
+		return
+	}
+	role, ok := findAssignableRole(c, input.Role)
+	if !ok {
+		return
+	}
+	if user.AuthSource == "service" && role.Capabilities != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Service accounts cannot have roles with capabilities"})
+		return
+	}
+	if role.Name != user.Role && isLastRoleManager(user) && !utils.HasCapability(role.Name, utils.CapRolesManage) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot remove the last user who can manage roles"})
+		return
+	}
 
 	oldRole := user.Role
 	user.Role = input.Role
@@ -258,3 +387,43 @@ func UpdateUserRole(c *gin.Context) {
 	utils.LogAudit(adminUserID, "UpdateUserRole", "Admin changed role for user "+user.Username+" from "+oldRole+" to "+input.Role, c.ClientIP())
 	c.JSON(http.StatusOK, gin.H{"message": "User role updated successfully"})
 }
+
+// checkPasswordPolicy responds with 400 and the broken rules if the password
+// does not satisfy the current policy.
+func checkPasswordPolicy(c *gin.Context, user models.User, password string) bool {
+	policy := utils.LoadPasswordPolicy()
+	violations := policy.Validate(password, user.Username)
+	if user.ID != 0 && policy.IsPasswordReused(user, password) {
+		violations = append(violations, "was used recently")
+	}
+	if len(violations) == 0 {
+		return true
+	}
+
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "Password " + strings.Join(violations, ", "),
+		"errors": gin.H{"password": violations},
+	})
+	return false
+}
+
+func GetPasswordPolicy(c *gin.Context) {
+	c.JSON(http.StatusOK, utils.LoadPasswordPolicy())
+}
+
+func SetPasswordPolicy(c *gin.Context) {
+	adminUserID := c.MustGet("user_id").(uint)
+	var input utils.PasswordPolicy
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := utils.SavePasswordPolicy(input); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password policy"})
+		return
+	}
+
+	utils.LogAudit(adminUserID, "SetPasswordPolicy", "Admin updated the password policy", c.ClientIP())
+	c.JSON(http.StatusOK, input)
+}
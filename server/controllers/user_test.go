@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/middleware"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// createSessions starts n sessions for the user and returns their IDs.
+func createSessions(t *testing.T, userID uint, n int) []uint {
+	t.Helper()
+	var ids []uint
+	for i := 0; i < n; i++ {
+		session, _, err := utils.CreateSession(userID, "203.0.113.7", "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, session.ID)
+	}
+	return ids
+}
+
+func activeSessionIDs(userID uint) []uint {
+	var ids []uint
+	for _, s := range utils.ActiveSessions(userID) {
+		ids = append(ids, s.ID)
+	}
+	return ids
+}
+
+// withSession marks requests as made from the given session.
+func withSession(r *gin.Engine, sessionID uint) {
+	r.Use(func(c *gin.Context) {
+		c.Set("session_id", sessionID)
+		c.Next()
+	})
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	setupTestDB(t)
+	user := models.User{Username: "alice", Role: "user", Password: testutil.PasswordHash(t, "Secur3Pass!x")}
+	database.DB.Create(&user)
+	sessions := createSessions(t, user.ID, 3)
+
+	r := testRouter(user)
+	withSession(r, sessions[0])
+	r.POST("/my/password", ChangePassword)
+	w := doJSON(t, r, http.MethodPost, "/my/password", map[string]string{"old_password": "Secur3Pass!x", "new_password": "N3w-Secur3Pass!"})
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body)
+	}
+
+	if active := activeSessionIDs(user.ID); len(active) != 1 || active[0] != sessions[0] {
+		t.Errorf("active sessions %v, want only the caller's %d", active, sessions[0])
+	}
+}
+
+func TestAdminChangePasswordRevokesSessions(t *testing.T) {
+	setupTestDB(t)
+	admin := createUser(t, "admin", "admin")
+	alice := createUser(t, "alice", "user")
+	adminSessions := createSessions(t, admin.ID, 2)
+	createSessions(t, alice.ID, 2)
+
+	r := testRouter(admin)
+	withSession(r, adminSessions[0])
+	r.POST("/users/:id/password", AdminChangePassword)
+	for _, target := range []models.User{alice, admin} {
+		w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/users/%d/password", target.ID), map[string]string{"new_password": "N3w-Secur3Pass!"})
+		if w.Code != http.StatusOK {
+			t.Fatalf("reset %s: status %d: %s", target.Username, w.Code, w.Body)
+		}
+	}
+
+	if active := activeSessionIDs(alice.ID); len(active) != 0 {
+		t.Errorf("alice still has sessions %v", active)
+	}
+	if active := activeSessionIDs(admin.ID); len(active) != 1 || active[0] != adminSessions[0] {
+		t.Errorf("admin sessions %v, want only the caller's %d", active, adminSessions[0])
+	}
+}
+
+func TestDemotedUserLosesCapabilities(t *testing.T) {
+	setupTestDB(t)
+	loadTestSigningKey(t)
+	admin := createUser(t, "admin", "admin")
+	alice := createUser(t, "alice", "admin")
+	session, _, err := utils.CreateSession(alice.ID, "203.0.113.7", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := utils.GenerateToken(alice, session.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := gin.New()
+	api.GET("/api/users", middleware.AuthMiddleware(), middleware.RequireCapability(utils.CapUsersManage), GetUsers)
+	listUsers := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/users", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, req)
+		return w.Code
+	}
+	if code := listUsers(); code != http.StatusOK {
+		t.Fatalf("before demotion: status %d", code)
+	}
+
+	r := testRouter(admin)
+	r.PUT("/users/:id/role", UpdateUserRole)
+	if w := doJSON(t, r, http.MethodPut, fmt.Sprintf("/users/%d/role", alice.ID), map[string]string{"role": "user"}); w.Code != http.StatusOK {
+		t.Fatalf("demote: status %d: %s", w.Code, w.Body)
+	}
+
+	// The token still says admin, but the role is looked up per request.
+	if code := listUsers(); code != http.StatusForbidden {
+		t.Errorf("after demotion: status %d, want %d", code, http.StatusForbidden)
+	}
+}
+
+func TestSetUserPermissionsChecksTargetUser(t *testing.T) {
+	setupTestDB(t)
+	database.DB.Create(&models.Role{Name: "granter", Capabilities: utils.CapPermissionsManage})
+	granter := createUser(t, "granter", "granter")
+	root := createUser(t, "root", "admin")
+	alice := createUser(t, "alice", "user")
+	prod := createCluster(t, "prod")
+	staging := createCluster(t, "staging")
+	database.DB.Create(&models.Permission{UserID: alice.ID, ClusterID: prod.ID, Level: utils.LevelAdmin})
+
+	r := testRouter(granter)
+	r.POST("/users/:id/permissions", SetUserPermissions)
+	r.POST("/users/:id/label-permissions", SetUserLabelPermissions)
+	grants := map[string]interface{}{"grants": []map[string]interface{}{{"cluster_id": prod.ID, "level": "view"}}}
+
+	if w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/users/%d/permissions", root.ID), grants); w.Code != http.StatusForbidden {
+		t.Errorf("changed grants of a user with more capabilities: status %d", w.Code)
+	}
+	selectors := map[string]interface{}{"grants": []map[string]string{{"selector": "env=prod"}}}
+	if w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/users/%d/label-permissions", root.ID), selectors); w.Code != http.StatusForbidden {
+		t.Errorf("changed selector grants of a user with more capabilities: status %d", w.Code)
+	}
+
+	grants = map[string]interface{}{
+		"cluster_ids": []uint{staging.ID},
+		"grants":      []map[string]interface{}{{"cluster_id": prod.ID, "level": "view"}},
+	}
+	if w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/users/%d/permissions", alice.ID), grants); w.Code != http.StatusOK {
+		t.Fatalf("set grants: status %d: %s", w.Code, w.Body)
+	}
+	var entry models.AuditLog
+	if err := database.DB.Where("action = ?", "SetUserPermissions").First(&entry).Error; err != nil {
+		t.Fatal("grant change was not audited")
+	}
+	if want := "Changed access of user alice from prod (admin) to prod (view), staging (admin)"; entry.UserID != granter.ID || entry.Detail != want {
+		t.Errorf("audited by %d: %q, want %q", entry.UserID, entry.Detail, want)
+	}
+
+	if w := doJSON(t, r, http.MethodPost, fmt.Sprintf("/users/%d/permissions", granter.ID), grants); w.Code != http.StatusOK {
+		t.Fatalf("self-grant: status %d: %s", w.Code, w.Body)
+	}
+	var alert models.AuditLog
+	if err := database.DB.Where("action = ? AND user_id = ?", "SelfGrant", granter.ID).First(&alert).Error; err != nil || alert.Severity != utils.SeverityHigh {
+		t.Errorf("self-grant was not flagged: %+v", alert)
+	}
+}
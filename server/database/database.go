@@ -12,13 +12,28 @@ var DB *gorm.DB
 
 func Connect() {
 	var err error
-	DB, err = gorm.Open(sqlite.Open("kubeswitch.db"), &gorm.Config{})
+	DB, err = Open("kubeswitch.db")
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		log.Fatal("Failed to open database:", err)
+	}
+}
+
+// Open opens the SQLite database at dsn and migrates it to the current
+// schema. Tests use it with an in-memory DSN.
+func Open(dsn string) (*gorm.DB, error) {
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		return nil, err
 	}
 
-	err = DB.AutoMigrate(&models.User{}, &models.Cluster{}, &models.Permission{}, &models.AuditLog{})
+	err = db.AutoMigrate(&models.User{}, &models.Cluster{}, &models.Permission{}, &models.AuditLog{},
+		&models.Session{}, &models.RefreshToken{}, &models.RevokedToken{}, &models.APIToken{},
+		&models.RecoveryCode{}, &models.Setting{}, &models.LoginThrottle{},
+		&models.PasswordHistory{}, &models.DeviceCode{}, &models.Group{}, &models.GroupMember{},
+		&models.GroupPermission{}, &models.AccessRequest{}, &models.Role{},
+		&models.ClusterCredential{}, &models.LabelPermission{}, &models.Policy{}, &models.ClusterOwner{})
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		return nil, err
 	}
+	return db, nil
 }
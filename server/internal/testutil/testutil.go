@@ -0,0 +1,61 @@
+// Package testutil holds fixtures shared by the server's package tests.
+package testutil
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SetupDB points database.DB at a fresh in-memory database, named after the
+// test, and restores the previous handle when the test ends.
+func SetupDB(t testing.TB) {
+	t.Helper()
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	db, err := database.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", name))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = previous
+	})
+}
+
+// SetupFileDB is SetupDB with a database file instead, for tests that need
+// SQLite's locking between connections: in-memory databases fail concurrent
+// writes instead of waiting for each other.
+func SetupFileDB(t testing.TB) {
+	t.Helper()
+	db, err := database.Open(filepath.Join(t.TempDir(), "kubeswitch.db"))
+	if err != nil {
+		t.Fatalf("open database: %v", err)
+	}
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		database.DB = previous
+	})
+}
+
+// PasswordHash returns a bcrypt hash of password at the minimum cost, which
+// keeps fixtures fast; verifying it works the same as for a real hash.
+func PasswordHash(t testing.TB, password string) string {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(hash)
+}
@@ -0,0 +1,184 @@
+// Package kms encrypts stored kubeconfigs with envelope encryption: every
+// record gets its own AES-256-GCM data key, which is wrapped by a
+// key-encryption key held by a Provider (a local key or Vault transit).
+package kms
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// envelopePrefix marks an encrypted value. Values without it are legacy
+// plaintext and are returned unchanged by Open.
+const envelopePrefix = "ksenc:v1:"
+
+// Provider wraps and unwraps data keys with a key-encryption key that never
+// leaves it.
+type Provider interface {
+	Name() string
+	WrapKey(ctx context.Context, key []byte) ([]byte, error)
+	UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+var (
+	current   Provider            // Encrypts new values; nil leaves them in plaintext
+	providers map[string]Provider // Every configured provider, for decryption
+)
+
+// Configure sets up the providers from the environment. KMS_PROVIDER picks
+// the one that encrypts ("local" or "vault"); any other provider that is
+// configured is only used to decrypt, e.g. while moving from a local key to
+// Vault. A local passphrase keeps its salt in the database, so connect to it
+// first.
+func Configure() error {
+	configured := map[string]Provider{}
+
+	local, err := loadLocalProvider()
+	if err != nil {
+		return err
+	}
+	if local != nil {
+		configured[local.Name()] = local
+	}
+
+	vault, err := loadVaultProvider()
+	if err != nil {
+		return err
+	}
+	if vault != nil {
+		configured[vault.Name()] = vault
+	}
+
+	var selected Provider
+	if name := os.Getenv("KMS_PROVIDER"); name != "" {
+		var ok bool
+		if selected, ok = configured[name]; !ok {
+			return fmt.Errorf("KMS_PROVIDER %q is not configured", name)
+		}
+	}
+
+	current, providers = selected, configured
+	return nil
+}
+
+// Enabled reports whether new values are encrypted.
+func Enabled() bool {
+	return current != nil
+}
+
+// KubeconfigAAD identifies the kubeconfig a cluster serves at an access
+// level. Passed to Seal and Open, it binds the ciphertext to that record so
+// that it cannot be copied into another cluster or level.
+func KubeconfigAAD(clusterID uint, level string) []byte {
+	return []byte(fmt.Sprintf("kubeconfig:%d:%s", clusterID, level))
+}
+
+// Seal encrypts plaintext under a fresh data key, authenticating aad along
+// with it. Without a provider the value is stored as is.
+func Seal(ctx context.Context, plaintext string, aad []byte) (string, error) {
+	if current == nil {
+		return plaintext, nil
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	ciphertext, err := seal(key, []byte(plaintext), aad)
+	if err != nil {
+		return "", err
+	}
+	wrapped, err := current.WrapKey(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("%s: wrap data key: %w", current.Name(), err)
+	}
+
+	return envelopePrefix + current.Name() + ":" +
+		base64.StdEncoding.EncodeToString(wrapped) + ":" +
+		base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Open decrypts a value produced by Seal with the same aad. Plaintext values
+// are returned unchanged so that records written before encryption was
+// enabled keep working until they are re-encrypted.
+func Open(ctx context.Context, stored string, aad []byte) (string, error) {
+	if !IsSealed(stored) {
+		return stored, nil
+	}
+
+	parts := strings.Split(strings.TrimPrefix(stored, envelopePrefix), ":")
+	if len(parts) != 3 {
+		return "", errors.New("malformed envelope")
+	}
+	provider, ok := providers[parts[0]]
+	if !ok {
+		return "", fmt.Errorf("value was encrypted by KMS provider %q, which is not configured", parts[0])
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", errors.New("malformed envelope")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", errors.New("malformed envelope")
+	}
+
+	key, err := provider.UnwrapKey(ctx, wrapped)
+	if err != nil {
+		return "", fmt.Errorf("%s: unwrap data key: %w", provider.Name(), err)
+	}
+	plaintext, err := open(key, ciphertext, aad)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// IsSealed reports whether a stored value is encrypted.
+func IsSealed(stored string) bool {
+	return strings.HasPrefix(stored, envelopePrefix)
+}
+
+// seal encrypts with AES-256-GCM and prepends the nonce.
+func seal(key, plaintext, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+func open(key, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := ciphertext[:aead.NonceSize()], ciphertext[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, errors.New("decryption failed")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,227 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/models"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const kubeconfig = "apiVersion: v1\nkind: Config\nusers:\n- name: admin\n  user:\n    token: secret\n"
+
+// configure runs Configure with the given environment and resets the
+// providers when the test ends.
+func configure(t *testing.T, env map[string]string) {
+	t.Helper()
+	t.Cleanup(func() { current, providers = nil, nil })
+	for _, name := range []string{"KMS_PROVIDER", "KMS_LOCAL_KEY_FILE", "KMS_LOCAL_PASSPHRASE", "KMS_LOCAL_PREVIOUS_KEY_FILES",
+		"VAULT_ADDR", "VAULT_TRANSIT_KEY", "VAULT_TRANSIT_MOUNT", "VAULT_NAMESPACE", "VAULT_TOKEN", "VAULT_TOKEN_FILE"} {
+		t.Setenv(name, env[name])
+	}
+	if err := Configure(); err != nil {
+		t.Fatalf("Configure: %v", err)
+	}
+}
+
+func writeKeyFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "kek")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func randomKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key) + "\n"
+}
+
+func TestSealOpenRoundTrip(t *testing.T) {
+	configure(t, map[string]string{"KMS_PROVIDER": "local", "KMS_LOCAL_KEY_FILE": writeKeyFile(t, randomKey(t))})
+	ctx := context.Background()
+	aad := KubeconfigAAD(1, "admin")
+
+	sealed, err := Seal(ctx, kubeconfig, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(sealed) || !strings.HasPrefix(sealed, envelopePrefix+"local:") || strings.Contains(sealed, "secret") {
+		t.Fatalf("not an envelope: %q", sealed)
+	}
+	again, _ := Seal(ctx, kubeconfig, aad)
+	if again == sealed {
+		t.Error("sealing twice must use fresh data keys and nonces")
+	}
+
+	opened, err := Open(ctx, sealed, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opened != kubeconfig {
+		t.Errorf("round trip changed the value: %q", opened)
+	}
+
+	if plain, err := Open(ctx, kubeconfig, aad); err != nil || plain != kubeconfig {
+		t.Errorf("plaintext values must be returned unchanged, got %q, %v", plain, err)
+	}
+}
+
+func TestOpenRejectsOtherRecords(t *testing.T) {
+	configure(t, map[string]string{"KMS_PROVIDER": "local", "KMS_LOCAL_KEY_FILE": writeKeyFile(t, randomKey(t))})
+	ctx := context.Background()
+	sealed, err := Seal(ctx, kubeconfig, KubeconfigAAD(1, "view"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, aad := range [][]byte{KubeconfigAAD(2, "view"), KubeconfigAAD(1, "admin"), nil} {
+		if _, err := Open(ctx, sealed, aad); err == nil {
+			t.Errorf("opened with additional data %q", aad)
+		}
+	}
+
+	parts := strings.Split(sealed, ":")
+	ciphertext, _ := base64.StdEncoding.DecodeString(parts[len(parts)-1])
+	ciphertext[len(ciphertext)-1] ^= 1
+	parts[len(parts)-1] = base64.StdEncoding.EncodeToString(ciphertext)
+	if _, err := Open(ctx, strings.Join(parts, ":"), KubeconfigAAD(1, "view")); err == nil {
+		t.Error("opened a tampered ciphertext")
+	}
+}
+
+func TestSealWithoutProvider(t *testing.T) {
+	configure(t, nil)
+	if Enabled() {
+		t.Fatal("no provider configured")
+	}
+	if sealed, err := Seal(context.Background(), kubeconfig, nil); err != nil || sealed != kubeconfig {
+		t.Errorf("got %q, %v; want the plaintext", sealed, err)
+	}
+}
+
+func TestLocalKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	oldKey, newKey := writeKeyFile(t, randomKey(t)), writeKeyFile(t, randomKey(t))
+	aad := KubeconfigAAD(1, "admin")
+
+	configure(t, map[string]string{"KMS_PROVIDER": "local", "KMS_LOCAL_KEY_FILE": oldKey})
+	sealed, err := Seal(ctx, kubeconfig, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configure(t, map[string]string{"KMS_PROVIDER": "local", "KMS_LOCAL_KEY_FILE": newKey})
+	if _, err := Open(ctx, sealed, aad); err == nil {
+		t.Fatal("opened without the retired key")
+	}
+
+	configure(t, map[string]string{"KMS_PROVIDER": "local", "KMS_LOCAL_KEY_FILE": newKey, "KMS_LOCAL_PREVIOUS_KEY_FILES": oldKey})
+	if opened, err := Open(ctx, sealed, aad); err != nil || opened != kubeconfig {
+		t.Fatalf("retired key: got %q, %v", opened, err)
+	}
+	resealed, _ := Seal(ctx, kubeconfig, aad)
+	configure(t, map[string]string{"KMS_PROVIDER": "local", "KMS_LOCAL_KEY_FILE": newKey})
+	if _, err := Open(ctx, resealed, aad); err != nil {
+		t.Errorf("new values must use the current key: %v", err)
+	}
+}
+
+func TestPassphraseKeyDerivedOnce(t *testing.T) {
+	testutil.SetupDB(t)
+	ctx := context.Background()
+	aad := KubeconfigAAD(1, "admin")
+
+	configure(t, map[string]string{"KMS_PROVIDER": "local", "KMS_LOCAL_PASSPHRASE": "correct horse battery staple"})
+	local := current.(*localProvider)
+	var values []string
+	for i := 0; i < 3; i++ {
+		sealed, err := Seal(ctx, kubeconfig, aad)
+		if err != nil {
+			t.Fatal(err)
+		}
+		values = append(values, sealed)
+	}
+	derived := local.current.key
+	if derived == nil {
+		t.Fatal("key was not derived")
+	}
+	if _, err := Open(ctx, values[0], aad); err != nil || !bytes.Equal(local.current.key, derived) {
+		t.Fatalf("key was derived again or open failed: %v", err)
+	}
+
+	var salts []models.Setting
+	database.DB.Where("key LIKE ?", "kms_local_salt_%").Find(&salts)
+	if len(salts) != 1 {
+		t.Fatalf("got %d stored salts, want 1", len(salts))
+	}
+
+	// A restart derives the same key from the stored salt.
+	configure(t, map[string]string{"KMS_PROVIDER": "local", "KMS_LOCAL_PASSPHRASE": "correct horse battery staple"})
+	for _, sealed := range values {
+		if opened, err := Open(ctx, sealed, aad); err != nil || opened != kubeconfig {
+			t.Fatalf("after restart: got %q, %v", opened, err)
+		}
+	}
+
+	configure(t, map[string]string{"KMS_PROVIDER": "local", "KMS_LOCAL_PASSPHRASE": "wrong horse"})
+	if _, err := Open(ctx, values[0], aad); err == nil {
+		t.Error("opened with the wrong passphrase")
+	}
+}
+
+// TestVaultRoundTrip runs against a stand-in for the transit secrets engine.
+func TestVaultRoundTrip(t *testing.T) {
+	vault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != "s.test" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+			return
+		}
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/v1/transit/encrypt/kubeswitch":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"ciphertext": "vault:v1:" + body["plaintext"]}})
+		case "/v1/transit/decrypt/kubeswitch":
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]string{"plaintext": strings.TrimPrefix(body["ciphertext"], "vault:v1:")}})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"no handler"}})
+		}
+	}))
+	defer vault.Close()
+
+	ctx := context.Background()
+	aad := KubeconfigAAD(4, "edit")
+	configure(t, map[string]string{"KMS_PROVIDER": "vault", "VAULT_ADDR": vault.URL, "VAULT_TRANSIT_KEY": "kubeswitch", "VAULT_TOKEN": "s.test"})
+	sealed, err := Seal(ctx, kubeconfig, aad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(sealed, envelopePrefix+"vault:") {
+		t.Fatalf("not a vault envelope: %q", sealed)
+	}
+	if opened, err := Open(ctx, sealed, aad); err != nil || opened != kubeconfig {
+		t.Fatalf("got %q, %v", opened, err)
+	}
+
+	configure(t, map[string]string{"KMS_PROVIDER": "vault", "VAULT_ADDR": vault.URL, "VAULT_TRANSIT_KEY": "kubeswitch", "VAULT_TOKEN": "s.revoked"})
+	if _, err := Open(ctx, sealed, aad); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Errorf("revoked token: got %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	keyIDSize = 8
+	saltSize  = 16
+)
+
+// localKey is a key-encryption key kept on the server itself, either 32
+// random bytes or a passphrase that is stretched with scrypt.
+type localKey struct {
+	id         []byte // Identifies the key in wrapped data keys
+	passphrase []byte
+
+	mu  sync.Mutex
+	key []byte // Derived on first use for passphrase keys
+}
+
+// localProvider wraps data keys with a local key. Retired keys are kept to
+// unwrap data keys until everything has been re-encrypted.
+type localProvider struct {
+	current *localKey
+	keys    []*localKey
+}
+
+// loadLocalProvider reads KMS_LOCAL_KEY_FILE or KMS_LOCAL_PASSPHRASE, plus
+// retired keys from KMS_LOCAL_PREVIOUS_KEY_FILES (comma-separated).
+func loadLocalProvider() (*localProvider, error) {
+	path, passphrase := os.Getenv("KMS_LOCAL_KEY_FILE"), os.Getenv("KMS_LOCAL_PASSPHRASE")
+	if path != "" && passphrase != "" {
+		return nil, errors.New("set only one of KMS_LOCAL_KEY_FILE and KMS_LOCAL_PASSPHRASE")
+	}
+
+	p := &localProvider{}
+	switch {
+	case path != "":
+		key, err := loadLocalKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		p.current = key
+	case passphrase != "":
+		p.current = newPassphraseKey([]byte(passphrase))
+	default:
+		return nil, nil
+	}
+	p.keys = append(p.keys, p.current)
+
+	for _, path := range strings.Split(os.Getenv("KMS_LOCAL_PREVIOUS_KEY_FILES"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		key, err := loadLocalKeyFile(path)
+		if err != nil {
+			return nil, err
+		}
+		p.keys = append(p.keys, key)
+	}
+	if err := p.deriveKeys(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// deriveKeys stretches passphrase keys up front. Their salts live in the
+// database, and looking them up later, while a caller holds a write
+// transaction, would wait on that transaction's lock. A retired key without
+// a salt never wrapped a data key and is skipped.
+func (p *localProvider) deriveKeys() error {
+	if _, err := p.current.kek(true); err != nil {
+		return err
+	}
+	for _, k := range p.keys[1:] {
+		if _, err := k.kek(false); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadLocalKeyFile reads a base64-encoded 32-byte key, e.g. from
+// `openssl rand -base64 32`. Anything else in the file is used as a
+// passphrase.
+func loadLocalKeyFile(path string) (*localKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	content := bytes.TrimSpace(data)
+	if len(content) == 0 {
+		return nil, fmt.Errorf("%s: key file is empty", path)
+	}
+	if key, err := base64.StdEncoding.DecodeString(string(content)); err == nil && len(key) == 32 {
+		sum := sha256.Sum256(key)
+		return &localKey{id: sum[:keyIDSize], key: key}, nil
+	}
+	return newPassphraseKey(content), nil
+}
+
+func newPassphraseKey(passphrase []byte) *localKey {
+	sum := sha256.Sum256(append([]byte("kubeswitch-kms-passphrase:"), passphrase...))
+	return &localKey{id: sum[:keyIDSize], passphrase: passphrase}
+}
+
+func (p *localProvider) Name() string {
+	return "local"
+}
+
+// WrapKey returns the key ID followed by the encrypted data key.
+func (p *localProvider) WrapKey(_ context.Context, key []byte) ([]byte, error) {
+	kek, err := p.current.kek(true)
+	if err != nil {
+		return nil, err
+	}
+	ciphertext, err := seal(kek, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, p.current.id...), ciphertext...), nil
+}
+
+func (p *localProvider) UnwrapKey(_ context.Context, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < keyIDSize {
+		return nil, errors.New("wrapped key too short")
+	}
+	for _, k := range p.keys {
+		if !bytes.Equal(k.id, wrapped[:keyIDSize]) {
+			continue
+		}
+		kek, err := k.kek(false)
+		if err != nil {
+			return nil, err
+		}
+		return open(kek, wrapped[keyIDSize:], nil)
+	}
+	return nil, fmt.Errorf("no local key with ID %x is configured", wrapped[:keyIDSize])
+}
+
+// kek returns the key-encryption key. A passphrase is stretched with scrypt
+// once, with a salt that is generated for the key and kept in the settings
+// table. The salt is only created for the key that wraps new data keys.
+func (k *localKey) kek(create bool) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if k.key != nil {
+		return k.key, nil
+	}
+
+	salt, err := passphraseSalt(k.id, create)
+	if err != nil {
+		return nil, err
+	}
+	derived, err := scrypt.Key(k.passphrase, salt, 1<<15, 8, 1, 32)
+	if err != nil {
+		return nil, err
+	}
+	k.key = derived
+	return derived, nil
+}
+
+func passphraseSalt(id []byte, create bool) ([]byte, error) {
+	setting := models.Setting{Key: fmt.Sprintf("kms_local_salt_%x", id)}
+	query := database.DB.Where(&setting)
+	var err error
+	if create {
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		err = query.Attrs(models.Setting{Value: base64.StdEncoding.EncodeToString(salt)}).FirstOrCreate(&setting).Error
+	} else {
+		err = query.First(&setting).Error
+	}
+	if err != nil {
+		return nil, fmt.Errorf("salt of local key %x: %w", id, err)
+	}
+	return base64.StdEncoding.DecodeString(setting.Value)
+}
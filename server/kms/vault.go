@@ -0,0 +1,123 @@
+package kms
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// vaultProvider wraps data keys with a key in a Vault (or OpenBao) transit
+// secrets engine, so the key-encryption key never reaches this server.
+type vaultProvider struct {
+	addr      string
+	mount     string
+	key       string
+	namespace string
+	token     string
+	tokenFile string // Re-read on every call so agent-renewed tokens are picked up
+	client    *http.Client
+}
+
+// loadVaultProvider reads VAULT_ADDR, VAULT_TRANSIT_KEY, VAULT_TRANSIT_MOUNT
+// (default "transit"), VAULT_NAMESPACE and VAULT_TOKEN or VAULT_TOKEN_FILE.
+func loadVaultProvider() (*vaultProvider, error) {
+	addr, key := os.Getenv("VAULT_ADDR"), os.Getenv("VAULT_TRANSIT_KEY")
+	if addr == "" || key == "" {
+		return nil, nil
+	}
+
+	p := &vaultProvider{
+		addr:      strings.TrimRight(addr, "/"),
+		mount:     strings.Trim(os.Getenv("VAULT_TRANSIT_MOUNT"), "/"),
+		key:       key,
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		token:     os.Getenv("VAULT_TOKEN"),
+		tokenFile: os.Getenv("VAULT_TOKEN_FILE"),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+	if p.mount == "" {
+		p.mount = "transit"
+	}
+	if p.token == "" && p.tokenFile == "" {
+		return nil, errors.New("VAULT_TRANSIT_KEY requires VAULT_TOKEN or VAULT_TOKEN_FILE")
+	}
+	return p, nil
+}
+
+func (p *vaultProvider) Name() string {
+	return "vault"
+}
+
+// WrapKey returns Vault's ciphertext, e.g. "vault:v3:...", which records
+// the version of the transit key that was used.
+func (p *vaultProvider) WrapKey(ctx context.Context, key []byte) ([]byte, error) {
+	var result struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	err := p.call(ctx, "encrypt", map[string]string{"plaintext": base64.StdEncoding.EncodeToString(key)}, &result)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(result.Ciphertext), nil
+}
+
+func (p *vaultProvider) UnwrapKey(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var result struct {
+		Plaintext string `json:"plaintext"`
+	}
+	if err := p.call(ctx, "decrypt", map[string]string{"ciphertext": string(wrapped)}, &result); err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(result.Plaintext)
+}
+
+func (p *vaultProvider) call(ctx context.Context, operation string, body interface{}, result interface{}) error {
+	token := p.token
+	if p.tokenFile != "" {
+		data, err := os.ReadFile(p.tokenFile)
+		if err != nil {
+			return err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+
+	payload, _ := json.Marshal(body)
+	url := fmt.Sprintf("%s/v1/%s/%s/%s", p.addr, p.mount, operation, p.key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Vault-Token", token)
+	if p.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", p.namespace)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil && resp.StatusCode == http.StatusOK {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if len(response.Errors) > 0 {
+			return fmt.Errorf("transit %s: %s", operation, strings.Join(response.Errors, "; "))
+		}
+		return fmt.Errorf("transit %s: %s", operation, resp.Status)
+	}
+	return json.Unmarshal(response.Data, result)
+}
@@ -1,70 +1,240 @@
 package main
 
 import (
+	"kubeswitch/server/auth"
 	"kubeswitch/server/controllers"
 	"kubeswitch/server/database"
+	"kubeswitch/server/kms"
 	"kubeswitch/server/middleware"
 	"kubeswitch/server/models"
 	"kubeswitch/server/utils"
 	"log"
+	"net/http"
+	"os"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		runCommand(os.Args[1:])
+		return
+	}
+
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatal("Failed to load JWT signing key: ", err)
+	}
 	database.Connect()
+	if err := kms.Configure(); err != nil {
+		log.Fatal("Failed to configure KMS: ", err)
+	}
+	if !kms.Enabled() {
+		log.Println("KMS_PROVIDER is not set; kubeconfigs are stored unencrypted")
+	}
+	utils.SeedRoles()
 
 	// Seed Admin
 	var admin models.User
 	if err := database.DB.Where("username = ?", "admin").First(&admin).Error; err != nil {
 		hash, _ := utils.HashPassword("admin123")
-		admin = models.User{Username: "admin", Password: hash, Role: "admin"}
+		admin = models.User{Username: "admin", Password: hash, Role: "admin", MustChangePassword: true}
 		database.DB.Create(&admin)
 		log.Println("Created default admin user (admin/admin123)")
 	}
 
+	utils.StartJanitor(time.Hour, auth.PurgeLoginThrottles, auth.PurgeDeviceCodes, utils.PurgeExpiredPermissions)
+
 	r := gin.Default()
 
+	// Only honour X-Forwarded-For from known reverse proxies; otherwise
+	// clients could pick the IP that allowlists and audit logs see.
+	proxies, headers := auth.TrustedProxies()
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+	if len(headers) > 0 {
+		r.RemoteIPHeaders = headers
+	}
+
 	config := cors.DefaultConfig()
 	config.AllowAllOrigins = true
 	config.AllowHeaders = append(config.AllowHeaders, "Authorization")
 	r.Use(cors.New(config))
 
+	r.GET("/.well-known/jwks.json", controllers.GetJWKS)
+
 	api := r.Group("/api")
 	{
 		api.POST("/login", controllers.Login)
+		api.POST("/login/mfa", controllers.LoginMFA)
+		api.POST("/login/mfa/enroll", controllers.LoginMFAEnroll)
+		api.POST("/login/proxy", controllers.ProxyLogin)
+		api.POST("/refresh", controllers.Refresh)
+		api.POST("/device/code", controllers.RequestDeviceCode)
+		api.POST("/device/token", controllers.DeviceToken)
+		api.GET("/auth/config", controllers.GetAuthConfig)
+		api.GET("/password-policy", controllers.GetPasswordPolicy)
+		api.GET("/oidc/login", controllers.OIDCLogin)
+		api.GET("/oidc/callback", controllers.OIDCCallback)
 
 		authorized := api.Group("/")
-		authorized.Use(middleware.AuthMiddleware())
+		authorized.Use(middleware.AuthMiddleware(), middleware.RequireAllowedIP())
 		{
 			authorized.POST("/logout", controllers.Logout)
 			authorized.GET("/my/user", controllers.GetCurrentUser)
 			authorized.POST("/my/password", controllers.ChangePassword)
+			authorized.GET("/my/tokens", controllers.GetMyTokens)
+			authorized.POST("/my/tokens", controllers.CreateMyToken)
+			authorized.DELETE("/my/tokens/:id", controllers.DeleteMyToken)
+			authorized.GET("/my/sessions", controllers.GetMySessions)
+			authorized.DELETE("/my/sessions", controllers.DeleteMySessions)
+			authorized.DELETE("/my/sessions/:id", controllers.DeleteMySession)
+			authorized.GET("/my/service-accounts", controllers.GetMyServiceAccounts)
+			authorized.GET("/service-accounts/:id/tokens", controllers.GetServiceAccountTokens)
+			authorized.POST("/service-accounts/:id/tokens", controllers.CreateServiceAccountToken)
+			authorized.DELETE("/service-accounts/:id/tokens/:token_id", controllers.DeleteServiceAccountToken)
+			authorized.GET("/my/device/:code", controllers.GetDeviceCode)
+			authorized.POST("/my/device", controllers.ApproveDevice)
+			authorized.GET("/my/mfa", controllers.GetMyMFA)
+			authorized.POST("/my/mfa/enroll", controllers.EnrollMyMFA)
+			authorized.POST("/my/mfa/activate", controllers.ActivateMyMFA)
+			authorized.DELETE("/my/mfa", controllers.DisableMyMFA)
+			authorized.POST("/my/mfa/recovery-codes", controllers.RegenerateMyRecoveryCodes)
+			authorized.GET("/access-requests", controllers.GetAccessRequests)
+			authorized.POST("/access-requests", controllers.CreateAccessRequest)
+			authorized.POST("/access-requests/:id/approve", controllers.ApproveAccessRequest)
+			authorized.POST("/access-requests/:id/deny", controllers.DenyAccessRequest)
+			authorized.DELETE("/access-requests/:id", controllers.CancelAccessRequest)
 			authorized.GET("/clusters", controllers.GetClusters)
 			authorized.GET("/clusters/:id/config", controllers.GetClusterConfig)
+			authorized.POST("/clusters/:id/break-glass", middleware.RequireCapability(utils.CapBreakGlass), controllers.BreakGlass)
+
+			// Directory lookups shared by the views that assign users and
+			// clusters to each other.
+			directory := authorized.Group("/")
+			directory.Use(middleware.RequireCapability(utils.CapUsersManage, utils.CapPermissionsManage,
+				utils.CapGroupsManage, utils.CapRolesManage, utils.CapServiceAccountsManage, utils.CapPoliciesManage))
+			{
+				directory.GET("/roles", controllers.GetRoles)
+			}
+			authorized.GET("/users", middleware.RequireCapabilityOrOwner(utils.CapUsersManage, utils.CapPermissionsManage,
+				utils.CapGroupsManage, utils.CapRolesManage, utils.CapServiceAccountsManage, utils.CapPoliciesManage),
+				controllers.GetUsers)
+
+			users := authorized.Group("/")
+			users.Use(middleware.RequireCapability(utils.CapUsersManage))
+			{
+				users.POST("/users", controllers.CreateUser)
+				users.DELETE("/users/:id", controllers.DeleteUser)
+				users.POST("/users/:id/password", controllers.AdminChangePassword)
+				users.DELETE("/users/:id/mfa", controllers.AdminResetMFA)
+				users.POST("/users/:id/mfa/enrollment-token", controllers.AdminCreateMFAEnrollmentToken)
+				users.POST("/users/:id/unlock", controllers.UnlockUser)
+				users.POST("/users/:id/allowlist", controllers.SetUserAllowlist)
+				users.GET("/users/:id/sessions", controllers.GetUserSessions)
+				users.DELETE("/users/:id/sessions", controllers.DeleteUserSessions)
+				users.DELETE("/users/:id/sessions/:session_id", controllers.DeleteUserSession)
+
+				users.GET("/lockouts", controllers.GetLockouts)
+				users.DELETE("/lockouts/:id", controllers.DeleteLockout)
+			}
+
+			roles := authorized.Group("/")
+			roles.Use(middleware.RequireCapability(utils.CapRolesManage))
+			{
+				roles.GET("/capabilities", controllers.GetCapabilities)
+				roles.POST("/roles", controllers.CreateRole)
+				roles.POST("/roles/:id", controllers.UpdateRole)
+				roles.DELETE("/roles/:id", controllers.DeleteRole)
+				roles.POST("/users/:id/role", controllers.UpdateUserRole)
+			}
 
-			admin := authorized.Group("/")
-			admin.Use(middleware.AdminMiddleware())
+			permissions := authorized.Group("/")
+			permissions.Use(middleware.RequireCapability(utils.CapPermissionsManage))
 			{
-				admin.GET("/users", controllers.GetUsers)
-				admin.POST("/users", controllers.CreateUser)
-				admin.DELETE("/users/:id", controllers.DeleteUser)
-				admin.POST("/users/:id/password", controllers.AdminChangePassword)
-				admin.POST("/users/:id/role", controllers.UpdateUserRole)
-				admin.GET("/users/:id/permissions", controllers.GetUserPermissions)
-				admin.POST("/users/:id/permissions", controllers.SetUserPermissions)
-
-				admin.POST("/clusters", controllers.CreateCluster)
-				admin.DELETE("/clusters/:id", controllers.DeleteCluster)
-				admin.GET("/clusters/:id/permissions", controllers.GetClusterPermissions)
-				admin.POST("/clusters/:id/permissions", controllers.SetClusterPermissions)
-				admin.POST("/clusters/:id/import", controllers.ImportKubeconfig)
-
-				admin.GET("/audit", controllers.GetAuditLogs)
+				permissions.GET("/users/:id/permissions", controllers.GetUserPermissions)
+				permissions.POST("/users/:id/permissions", controllers.SetUserPermissions)
+				permissions.GET("/clusters/:id/owners", controllers.GetClusterOwners)
+				permissions.POST("/clusters/:id/owners", controllers.SetClusterOwners)
+				permissions.GET("/users/:id/label-permissions", controllers.GetUserLabelPermissions)
+				permissions.POST("/users/:id/label-permissions", controllers.SetUserLabelPermissions)
+			}
+
+			// Groups can own clusters and service accounts, so whoever assigns owners
+			// lists them too
+			authorized.GET("/groups", middleware.RequireCapability(utils.CapGroupsManage, utils.CapPermissionsManage, utils.CapServiceAccountsManage), controllers.GetGroups)
+
+			groups := authorized.Group("/")
+			groups.Use(middleware.RequireCapability(utils.CapGroupsManage))
+			{
+				groups.POST("/groups", controllers.CreateGroup)
+				groups.POST("/groups/:id", controllers.UpdateGroup)
+				groups.DELETE("/groups/:id", controllers.DeleteGroup)
+				groups.GET("/groups/:id/members", controllers.GetGroupMembers)
+				groups.POST("/groups/:id/members", controllers.SetGroupMembers)
+				groups.GET("/groups/:id/permissions", controllers.GetGroupPermissions)
+				groups.POST("/groups/:id/permissions", controllers.SetGroupPermissions)
+				groups.GET("/groups/:id/label-permissions", controllers.GetGroupLabelPermissions)
+				groups.POST("/groups/:id/label-permissions", controllers.SetGroupLabelPermissions)
+				groups.POST("/groups/:id/allowlist", controllers.SetGroupAllowlist)
+			}
+
+			serviceAccounts := authorized.Group("/")
+			serviceAccounts.Use(middleware.RequireCapability(utils.CapServiceAccountsManage))
+			{
+				serviceAccounts.GET("/service-accounts", controllers.GetServiceAccounts)
+				serviceAccounts.POST("/service-accounts", controllers.CreateServiceAccount)
+				serviceAccounts.POST("/service-accounts/:id/owner", controllers.SetServiceAccountOwner)
+				serviceAccounts.DELETE("/service-accounts/:id", controllers.DeleteServiceAccount)
+			}
+
+			authorized.POST("/clusters", middleware.RequireCapability(utils.CapClustersCreate), controllers.CreateCluster)
+			authorized.POST("/clusters/:id/labels", middleware.RequireCapability(utils.CapPermissionsManage), controllers.SetClusterLabels)
+			authorized.POST("/clusters/:id/allowlist", middleware.RequireCapability(utils.CapClustersCreate), controllers.SetClusterAllowlist)
+			authorized.DELETE("/clusters/:id", middleware.RequireCapability(utils.CapClustersDelete), controllers.DeleteCluster)
+
+			// Cluster owners manage these for their own clusters
+			authorized.GET("/clusters/:id/permissions", middleware.RequireCapabilityOrOwner(utils.CapPermissionsManage), controllers.GetClusterPermissions)
+			authorized.POST("/clusters/:id/permissions", middleware.RequireCapabilityOrOwner(utils.CapPermissionsManage), controllers.SetClusterPermissions)
+			authorized.POST("/clusters/:id/import", middleware.RequireCapabilityOrOwner(utils.CapKubeconfigImport), controllers.ImportKubeconfig)
+			authorized.DELETE("/clusters/:id/credentials/:level", middleware.RequireCapabilityOrOwner(utils.CapKubeconfigImport), controllers.DeleteClusterCredential)
+			authorized.GET("/clusters/:id/audit", middleware.RequireCapabilityOrOwner(utils.CapAuditRead), controllers.GetClusterAuditLogs)
+
+			policies := authorized.Group("/")
+			policies.Use(middleware.RequireCapability(utils.CapPoliciesManage))
+			{
+				policies.GET("/policies", controllers.GetPolicies)
+				policies.POST("/policies", controllers.CreatePolicy)
+				policies.POST("/policies/evaluate", controllers.EvaluatePolicies)
+				policies.POST("/policies/:id", controllers.UpdatePolicy)
+				policies.DELETE("/policies/:id", controllers.DeletePolicy)
+			}
+
+			authorized.GET("/audit", middleware.RequireCapability(utils.CapAuditRead), controllers.GetAuditLogs)
+
+			settings := authorized.Group("/")
+			settings.Use(middleware.RequireCapability(utils.CapSettingsManage))
+			{
+				settings.POST("/password-policy", controllers.SetPasswordPolicy)
+				settings.GET("/mfa/policy", controllers.GetMFAPolicy)
+				settings.POST("/mfa/policy", controllers.SetMFAPolicy)
 			}
 		}
 	}
 
-	r.Run(":8080")
+	tlsConfig := auth.LoadTLSConfig()
+	if !tlsConfig.Enabled() {
+		r.Run(":8080")
+		return
+	}
+
+	serverTLS, err := tlsConfig.ServerTLSConfig()
+	if err != nil {
+		log.Fatal("Failed to configure TLS: ", err)
+	}
+	server := &http.Server{Addr: ":8443", Handler: r, TLSConfig: serverTLS}
+	log.Println("Listening with TLS on :8443")
+	log.Fatal(server.ListenAndServeTLS("", ""))
 }
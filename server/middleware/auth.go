@@ -1,16 +1,53 @@
 package middleware
 
 import (
+	"crypto/x509"
+	"kubeswitch/server/auth"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/policy"
 	"kubeswitch/server/utils"
+	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// apiTokenRoutes lists the routes personal access tokens may call and the
+// scope each one requires. Every other route rejects them.
+var apiTokenRoutes = map[string]string{
+	"GET /api/clusters":            utils.ScopeClustersRead,
+	"GET /api/clusters/:id/config": utils.ScopeClustersConfig,
+}
+
+// passwordChangeRoutes are the only routes a user with an expired password
+// may call.
+var passwordChangeRoutes = map[string]bool{
+	"GET /api/my/user":         true,
+	"POST /api/my/password":    true,
+	"POST /api/logout":         true,
+	"GET /api/password-policy": true,
+}
+
 func AuthMiddleware() gin.HandlerFunc {
+	proxy, err := auth.LoadProxyConfig()
+	if err != nil {
+		log.Fatal("Invalid auth proxy configuration: ", err)
+	}
+
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" && proxy.Asserted(c.Request) {
+			authenticateProxy(c, proxy)
+			return
+		}
+		if authHeader == "" && c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+			authenticateClientCert(c, c.Request.TLS.PeerCertificates[0])
+			return
+		}
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
 			c.Abort()
@@ -24,6 +61,11 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		if strings.HasPrefix(parts[1], utils.APITokenPrefix) {
+			authenticateAPIToken(c, parts[1])
+			return
+		}
+
 		claims, err := utils.ValidateToken(parts[1])
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -31,22 +73,185 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		c.Set("user_id", uint(claims["user_id"].(float64)))
-		c.Set("username", claims["username"])
-		c.Set("role", claims["role"])
+		jti, _ := claims["jti"].(string)
+		sessionID, _ := claims["session_id"].(float64)
+		if jti == "" || utils.IsTokenRevoked(jti) || !utils.TouchSession(uint(sessionID), c.ClientIP()) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+			c.Abort()
+			return
+		}
+		if pwdChange, _ := claims["pwd_change"].(bool); pwdChange && blockedByPasswordChange(c) {
+			return
+		}
+		exp, _ := claims["exp"].(float64)
+
+		// The role is read from the database rather than the token, so a
+		// role change takes effect on the user's next request.
+		var user models.User
+		if err := database.DB.First(&user, uint(claims["user_id"].(float64))).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		c.Set("user_id", user.ID)
+		c.Set("username", user.Username)
+		c.Set("role", user.Role)
+		c.Set("jti", jti)
+		c.Set("session_id", uint(sessionID))
+		c.Set("token_exp", time.Unix(int64(exp), 0))
 
 		c.Next()
 	}
 }
 
-func AdminMiddleware() gin.HandlerFunc {
+func authenticateAPIToken(c *gin.Context, raw string) {
+	var token models.APIToken
+	if err := database.DB.Where("token_hash = ?", utils.HashToken(raw)).First(&token).Error; err != nil ||
+		time.Now().After(token.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return
+	}
+
+	scope, allowed := apiTokenRoutes[c.Request.Method+" "+c.FullPath()]
+	if !allowed || !utils.HasScope(token.Scopes, scope) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Token scope does not allow this request"})
+		c.Abort()
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, token.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		c.Abort()
+		return
+	}
+
+	database.DB.Model(&token).Update("last_used_at", time.Now())
+
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("actor", "token:"+token.Name)
+
+	c.Next()
+}
+
+// authenticateClientCert accepts a client certificate that the TLS listener
+// has already verified against TLS_CLIENT_CA_FILE. A certificate is a single
+// factor, so users the MFA policy applies to must log in with a token.
+func authenticateClientCert(c *gin.Context, cert *x509.Certificate) {
+	user, err := auth.CertificateUser(cert)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Client certificate does not match a user"})
+		c.Abort()
+		return
+	}
+	if utils.MFARequired(user.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "MFA is required for this account; log in with a password and verification code"})
+		c.Abort()
+		return
+	}
+	if utils.PasswordExpired(user) && blockedByPasswordChange(c) {
+		return
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("actor", "cert:"+cert.Subject.CommonName)
+
+	c.Next()
+}
+
+// authenticateProxy accepts the identity asserted by a trusted
+// authenticating proxy in front of the server.
+func authenticateProxy(c *gin.Context, proxy auth.ProxyConfig) {
+	user, err := proxy.ProxyUser(c.Request)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		c.Abort()
+		return
+	}
+	if utils.PasswordExpired(user) && blockedByPasswordChange(c) {
+		return
+	}
+
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("actor", "proxy")
+
+	c.Next()
+}
+
+// blockedByPasswordChange rejects the request unless it is one of the
+// passwordChangeRoutes. It applies however the user authenticated: a client
+// certificate or proxy login must not get around an expired or reset
+// password either.
+func blockedByPasswordChange(c *gin.Context) bool {
+	if passwordChangeRoutes[c.Request.Method+" "+c.FullPath()] {
+		return false
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Password change required", "password_change_required": true})
+	c.Abort()
+	return true
+}
+
+// RequireAllowedIP rejects authenticated requests whose client IP is outside
+// the caller's allowlists. It runs after AuthMiddleware so that every way of
+// authenticating is covered.
+func RequireAllowedIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ip := c.ClientIP()
+		if allowed, by := utils.SourceIPAllowed(c.GetUint("user_id"), ip); !allowed {
+			utils.LogAuditContext(c, "IPDenied", "Request to "+c.Request.Method+" "+c.Request.URL.Path+" from "+ip+" rejected by "+by)
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access from " + ip + " is not allowed"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireCapability lets the request through if the caller's role grants
+// any of the capabilities and no admin policy denies it.
+func RequireCapability(capabilities ...string) gin.HandlerFunc {
+	return requireAccess(capabilities, false)
+}
+
+// RequireCapabilityOrOwner additionally lets in owners of the cluster in the
+// :id route parameter, or of any cluster on routes without one (e.g. to look
+// up users to grant access to).
+func RequireCapabilityOrOwner(capabilities ...string) gin.HandlerFunc {
+	return requireAccess(capabilities, true)
+}
+
+func requireAccess(capabilities []string, owners bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		role, exists := c.Get("role")
-		if !exists || role != "admin" {
-			c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		if !utils.HasCapability(c.GetString("role"), capabilities...) && !(owners && isOwner(c)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
 			c.Abort()
 			return
 		}
+		if !policy.Allow(c, policy.RequestInput(c, policy.ActionAdmin, nil, "")) {
+			return
+		}
 		c.Next()
 	}
 }
+
+func isOwner(c *gin.Context) bool {
+	owned := utils.OwnedClusterIDs(c.GetUint("user_id"))
+	id := c.Param("id")
+	if id == "" {
+		return len(owned) > 0
+	}
+	for _, clusterID := range owned {
+		if strconv.FormatUint(uint64(clusterID), 10) == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func createAPIToken(t *testing.T, userID uint, scopes string, expiresAt time.Time) string {
+	t.Helper()
+	raw, hash, err := utils.GenerateAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := models.APIToken{UserID: userID, Name: "ci", TokenHash: hash, Scopes: scopes, ExpiresAt: expiresAt}
+	if err := database.DB.Create(&token).Error; err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestAPITokenRouteScoping(t *testing.T) {
+	testutil.SetupDB(t)
+	user := models.User{Username: "deploy", Role: "admin"}
+	database.DB.Create(&user)
+
+	r := gin.New()
+	api := r.Group("/api", AuthMiddleware())
+	ok := func(c *gin.Context) { c.String(http.StatusOK, c.GetString("actor")) }
+	api.GET("/clusters", ok)
+	api.POST("/clusters", ok)
+	api.GET("/clusters/:id/config", ok)
+	api.GET("/users", ok)
+
+	readOnly := createAPIToken(t, user.ID, utils.ScopeClustersRead, time.Now().Add(time.Hour))
+	full := createAPIToken(t, user.ID, utils.ScopeClustersRead+","+utils.ScopeClustersConfig, time.Now().Add(time.Hour))
+	expired := createAPIToken(t, user.ID, utils.ScopeClustersRead, time.Now().Add(-time.Minute))
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		want   int
+	}{
+		{"read scope lists clusters", readOnly, http.MethodGet, "/api/clusters", http.StatusOK},
+		{"read scope cannot download", readOnly, http.MethodGet, "/api/clusters/1/config", http.StatusForbidden},
+		{"config scope downloads", full, http.MethodGet, "/api/clusters/7/config", http.StatusOK},
+		{"no write routes", full, http.MethodPost, "/api/clusters", http.StatusForbidden},
+		{"no admin routes even for admins", full, http.MethodGet, "/api/users", http.StatusForbidden},
+		{"expired token", expired, http.MethodGet, "/api/clusters", http.StatusUnauthorized},
+		{"unknown token", utils.APITokenPrefix + "unknown", http.MethodGet, "/api/clusters", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Fatalf("status %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			if tt.want == http.StatusOK && !strings.HasPrefix(w.Body.String(), "token:") {
+				t.Errorf("actor = %q, want the token", w.Body)
+			}
+		})
+	}
+}
+
+func TestRequireAllowedIPBehindTrustedProxy(t *testing.T) {
+	testutil.SetupDB(t)
+	user := models.User{Username: "alice", Role: "user", AllowedCIDRs: []string{"203.0.113.0/24"}}
+	database.DB.Create(&user)
+	group := models.Group{Name: "contractors", AllowedCIDRs: []string{"203.0.113.0/25", "198.51.100.0/24"}}
+	database.DB.Create(&group)
+
+	newRouter := func(headers ...string) *gin.Engine {
+		r := gin.New()
+		// As configured by main from TRUSTED_PROXIES and TRUSTED_PROXY_HEADERS.
+		if err := r.SetTrustedProxies([]string{"10.0.0.0/8"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(headers) > 0 {
+			r.RemoteIPHeaders = headers
+		}
+		r.GET("/api/clusters", func(c *gin.Context) { c.Set("user_id", user.ID) }, RequireAllowedIP(),
+			func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+		return r
+	}
+	r := newRouter()
+
+	tests := []struct {
+		name   string
+		peer   string
+		header string
+		value  string
+		want   int
+	}{
+		{"direct connection inside allowlist", "203.0.113.7", "", "", http.StatusOK},
+		{"direct connection outside allowlist", "192.0.2.1", "", "", http.StatusForbidden},
+		{"forwarded by trusted proxy", "10.0.0.5", "X-Forwarded-For", "203.0.113.7", http.StatusOK},
+		{"forwarded through two trusted proxies", "10.0.0.5", "X-Forwarded-For", "203.0.113.7, 10.2.0.1", http.StatusOK},
+		{"forwarded client outside allowlist", "10.0.0.5", "X-Forwarded-For", "192.0.2.1", http.StatusForbidden},
+		{"spoofed header from untrusted peer", "192.0.2.1", "X-Forwarded-For", "203.0.113.7", http.StatusForbidden},
+		{"spoofed entry before untrusted hop", "10.0.0.5", "X-Forwarded-For", "203.0.113.7, 192.0.2.1", http.StatusForbidden},
+		{"proxy address itself is not allowed", "10.0.0.5", "", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := requestFrom(r, tt.peer, tt.header, tt.value); code != tt.want {
+				t.Fatalf("status %d, want %d", code, tt.want)
+			}
+		})
+	}
+
+	t.Run("group allowlist also applies", func(t *testing.T) {
+		database.DB.Create(&models.GroupMember{GroupID: group.ID, UserID: user.ID})
+		t.Cleanup(func() { database.DB.Where("user_id = ?", user.ID).Delete(&models.GroupMember{}) })
+		if code := requestFrom(r, "10.0.0.5", "X-Forwarded-For", "203.0.113.7"); code != http.StatusOK {
+			t.Errorf("address in both lists: status %d", code)
+		}
+		if code := requestFrom(r, "10.0.0.5", "X-Forwarded-For", "203.0.113.200"); code != http.StatusForbidden {
+			t.Errorf("address outside the group list: status %d", code)
+		}
+		if code := requestFrom(r, "10.0.0.5", "X-Forwarded-For", "198.51.100.1"); code != http.StatusForbidden {
+			t.Errorf("group list must not widen the user list: status %d", code)
+		}
+	})
+
+	t.Run("custom header", func(t *testing.T) {
+		r := newRouter("X-Real-IP")
+		if code := requestFrom(r, "10.0.0.5", "X-Real-IP", "203.0.113.7"); code != http.StatusOK {
+			t.Errorf("X-Real-IP from trusted proxy: status %d", code)
+		}
+		if code := requestFrom(r, "10.0.0.5", "X-Forwarded-For", "203.0.113.7"); code != http.StatusForbidden {
+			t.Errorf("X-Forwarded-For must be ignored when not configured: status %d", code)
+		}
+	})
+
+	var denied int64
+	database.DB.Model(&models.AuditLog{}).Where("user_id = ? AND action = ?", user.ID, "IPDenied").Count(&denied)
+	if denied == 0 {
+		t.Error("denied requests were not audited")
+	}
+}
+
+func requestFrom(h http.Handler, peer, header, value string) int {
+	req := httptest.NewRequest(http.MethodGet, "/api/clusters", nil)
+	req.RemoteAddr = peer + ":40000"
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w.Code
+}
+
+// TestMFAPolicyCoversCertAndProxyLogins checks that logins without a
+// password cannot be used to get around mfa_required_for_admins.
+func TestMFAPolicyCoversCertAndProxyLogins(t *testing.T) {
+	testutil.SetupDB(t)
+	utils.SeedRoles()
+	database.DB.Create(&models.User{Username: "root", Role: "admin"})
+	database.DB.Create(&models.User{Username: "alice", Role: "user"})
+	t.Setenv("AUTH_PROXY_TRUSTED_CIDRS", "192.0.2.0/24")
+	t.Setenv("AUTH_PROXY_ADMIN_GROUPS", "kube-admins")
+
+	serve := func(configure func(*http.Request)) int {
+		r := gin.New()
+		r.GET("/api/clusters", AuthMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+		req := httptest.NewRequest(http.MethodGet, "/api/clusters", nil)
+		configure(req)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	withCert := func(username string) func(*http.Request) {
+		return func(req *http.Request) {
+			req.RemoteAddr = "198.51.100.7:1234"
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: username}}
+			req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+	}
+	viaProxy := func(username, groups string) func(*http.Request) {
+		return func(req *http.Request) {
+			req.Header.Set("X-Forwarded-User", username)
+			req.Header.Set("X-Forwarded-Groups", groups)
+		}
+	}
+
+	if code := serve(withCert("root")); code != http.StatusOK {
+		t.Fatalf("admin certificate without the policy: status %d", code)
+	}
+
+	utils.SetSetting(utils.SettingMFARequiredForAdmins, "true")
+	tests := []struct {
+		name      string
+		configure func(*http.Request)
+		want      int
+	}{
+		{"admin certificate", withCert("root"), http.StatusForbidden},
+		{"user certificate", withCert("alice"), http.StatusOK},
+		{"admin via proxy", viaProxy("carol", "kube-admins"), http.StatusForbidden},
+		{"user via proxy", viaProxy("dave", "developers"), http.StatusOK},
+	}
+	for _, tt := range tests {
+		if code := serve(tt.configure); code != tt.want {
+			t.Errorf("%s: status %d, want %d", tt.name, code, tt.want)
+		}
+	}
+
+	t.Setenv("AUTH_PROXY_MFA", "true")
+	if code := serve(viaProxy("carol", "kube-admins")); code != http.StatusOK {
+		t.Errorf("admin via a proxy that enforces MFA: status %d", code)
+	}
+}
+
+func TestClientCertRespectsPasswordChange(t *testing.T) {
+	testutil.SetupDB(t)
+	database.DB.Create(&models.User{Username: "alice", Role: "user", MustChangePassword: true})
+
+	r := gin.New()
+	api := r.Group("/api", AuthMiddleware())
+	api.GET("/clusters", func(c *gin.Context) { c.Status(http.StatusOK) })
+	api.GET("/my/user", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}
+	for path, want := range map[string]int{"/api/clusters": http.StatusForbidden, "/api/my/user": http.StatusOK} {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Errorf("%s: status %d, want %d: %s", path, w.Code, want, w.Body)
+		}
+	}
+}
@@ -7,35 +7,187 @@ import (
 )
 
 type User struct {
-	ID        uint           `gorm:"primaryKey" json:"id"`
-	Username  string         `gorm:"uniqueIndex" json:"username"`
-	Password  string         `json:"-"` // Hash
-	Role      string         `json:"role"` // "admin" or "user"
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	ID                 uint           `gorm:"primaryKey" json:"id"`
+	Username           string         `gorm:"uniqueIndex" json:"username"`
+	Password           string         `json:"-"`                                // Hash
+	Role               string         `json:"role"`                             // Name of a Role
+	AuthSource         string         `gorm:"default:local" json:"auth_source"` // "local", "oidc", "ldap" or "service"
+	ExternalID         string         `gorm:"index" json:"-"`                   // Subject at the external provider
+	MFAEnabled         bool           `json:"mfa_enabled"`
+	MFASecret          string         `json:"-"` // Base32 TOTP secret, set during enrolment
+	MFALastStep        int64          `json:"-"` // Last accepted TOTP step, to prevent replay
+	MFAEnrollHash      string         `json:"-"` // Admin-issued token that allows enrolling during login
+	MFAEnrollExpiresAt *time.Time     `json:"-"`
+	PasswordChangedAt  *time.Time     `json:"password_changed_at,omitempty"`
+	MustChangePassword bool           `json:"must_change_password"`
+	OwnerID            *uint          `gorm:"index" json:"owner_id,omitempty"`       // Human responsible for a service account
+	OwnerGroupID       *uint          `gorm:"index" json:"owner_group_id,omitempty"` // Team whose members also manage a service account
+	Description        string         `json:"description,omitempty"`
+	AllowedCIDRs       []string       `gorm:"column:allowed_cidrs;serializer:json" json:"allowed_cidrs"` // Source networks the user may connect from; empty allows all
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	DeletedAt          gorm.DeletedAt `gorm:"index" json:"-"`
 
 	Permissions []Permission `json:"permissions,omitempty"`
 }
 
+// Role is a named set of capabilities assigned to users. The built-in
+// "admin" and "user" roles cannot be changed or deleted.
+type Role struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Name         string    `gorm:"uniqueIndex" json:"name"`
+	Description  string    `json:"description"`
+	Capabilities string    `json:"capabilities"` // Comma separated, "*" for all
+	BuiltIn      bool      `json:"built_in"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	UserCount int64 `gorm:"-" json:"user_count"`
+}
+
 type Cluster struct {
-	ID          uint           `gorm:"primaryKey" json:"id"`
-	Name        string         `gorm:"uniqueIndex" json:"name"`
-	Kubeconfig  string         `json:"-"` // Store content, don't return by default
-	Description string         `json:"description"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `gorm:"index" json:"-"`
+	ID             uint              `gorm:"primaryKey" json:"id"`
+	Name           string            `gorm:"uniqueIndex" json:"name"`
+	Kubeconfig     string            `json:"-"` // Admin-level credential; don't return by default
+	KubeconfigInfo *KubeconfigInfo   `gorm:"serializer:json" json:"kubeconfig_info,omitempty"`
+	Description    string            `json:"description"`
+	Labels         map[string]string `gorm:"serializer:json" json:"labels"`                             // Matched by LabelPermission selectors
+	AllowedCIDRs   []string          `gorm:"column:allowed_cidrs;serializer:json" json:"allowed_cidrs"` // Networks the kubeconfig may be downloaded from
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt    `gorm:"index" json:"-"`
+
+	Levels      []string `gorm:"-" json:"levels,omitempty"`       // Access levels with a kubeconfig
+	AccessLevel string   `gorm:"-" json:"access_level,omitempty"` // Level granted to the caller
+	Owned       bool     `gorm:"-" json:"owned,omitempty"`        // Whether the caller owns the cluster
+}
+
+// ClusterCredential is a kubeconfig variant for a lower access level than
+// the cluster's own kubeconfig, e.g. one bound to the "view" ClusterRole.
+type ClusterCredential struct {
+	ID             uint            `gorm:"primaryKey" json:"id"`
+	ClusterID      uint            `gorm:"uniqueIndex:idx_cluster_level" json:"cluster_id"`
+	Level          string          `gorm:"uniqueIndex:idx_cluster_level" json:"level"` // "view" or "edit"
+	Kubeconfig     string          `json:"-"`
+	KubeconfigInfo *KubeconfigInfo `gorm:"serializer:json" json:"kubeconfig_info,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	UpdatedAt      time.Time       `json:"updated_at"`
+}
+
+// KubeconfigInfo is extracted from a kubeconfig when it is validated on
+// create or import. Server and AuthType describe the current context.
+type KubeconfigInfo struct {
+	Server         string   `json:"server"`
+	CurrentContext string   `json:"current_context"`
+	Contexts       []string `json:"contexts"`
+	AuthType       string   `json:"auth_type"` // "token", "client-certificate", "exec", "auth-provider", "basic" or "none"
 }
 
+// Permission grants a user access to a cluster at an access level,
+// optionally only within a time window. Expired grants are removed by the
+// janitor.
 type Permission struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index" json:"user_id"`
+	ClusterID  uint       `gorm:"index" json:"cluster_id"`
+	Level      string     `gorm:"default:admin" json:"level"` // "view", "edit" or "admin"
+	NotBefore  *time.Time `json:"not_before,omitempty"`
+	ExpiresAt  *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	BreakGlass bool       `json:"break_glass,omitempty"` // Self-granted in an emergency
+	CreatedAt  time.Time  `json:"created_at"`
+
+	User    User    `json:"-"`
+	Cluster Cluster `json:"cluster,omitempty"`
+}
+
+// ClusterOwner delegates managing a cluster's access, kubeconfigs and audit
+// trail to a user or to every member of a group. Exactly one of UserID and
+// GroupID is set.
+type ClusterOwner struct {
 	ID        uint      `gorm:"primaryKey" json:"id"`
-	UserID    uint      `gorm:"index" json:"user_id"`
 	ClusterID uint      `gorm:"index" json:"cluster_id"`
+	UserID    *uint     `gorm:"index" json:"user_id,omitempty"`
+	GroupID   *uint     `gorm:"index" json:"group_id,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
+}
 
-	User    User    `json:"-"`
-	Cluster Cluster `json:"cluster,omitempty"`
+// LabelPermission grants a user or a group access to every cluster whose
+// labels match Selector, including clusters added later. Exactly one of
+// UserID and GroupID is set.
+type LabelPermission struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    *uint      `gorm:"index" json:"user_id,omitempty"`
+	GroupID   *uint      `gorm:"index" json:"group_id,omitempty"`
+	Selector  string     `json:"selector"` // Kubernetes label selector, e.g. "env!=prod,team=payments"
+	Level     string     `gorm:"default:admin" json:"level"`
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Policy is a deny rule written as a CEL expression. Requests covered by
+// Action are refused when Condition evaluates to true.
+type Policy struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"uniqueIndex" json:"name"`
+	Description string    `json:"description"`
+	Action      string    `json:"action"`    // "kubeconfig", "admin" or "*"
+	Condition   string    `json:"condition"` // e.g. !inCIDR(request.ip, "10.0.0.0/8")
+	Message     string    `json:"message"`   // Shown to the caller when denied
+	Disabled    bool      `json:"disabled"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Group is a team of users that is granted cluster access as a whole.
+type Group struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	Name         string    `gorm:"uniqueIndex" json:"name"`
+	Description  string    `json:"description"`
+	AllowedCIDRs []string  `gorm:"column:allowed_cidrs;serializer:json" json:"allowed_cidrs"` // Applies to every member, in addition to their own
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	MemberCount int64 `gorm:"-" json:"member_count"`
+}
+
+type GroupMember struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	GroupID   uint      `gorm:"uniqueIndex:idx_group_member" json:"group_id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_group_member;index" json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GroupPermission grants every member of a group access to a cluster.
+type GroupPermission struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	GroupID   uint       `gorm:"index" json:"group_id"`
+	ClusterID uint       `gorm:"index" json:"cluster_id"`
+	Level     string     `gorm:"default:admin" json:"level"`
+	NotBefore *time.Time `json:"not_before,omitempty"`
+	ExpiresAt *time.Time `gorm:"index" json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// AccessRequest is a user's request for temporary access to a cluster.
+// Approval creates a Permission that expires after DurationMinutes.
+type AccessRequest struct {
+	ID              uint       `gorm:"primaryKey" json:"id"`
+	UserID          uint       `gorm:"index" json:"user_id"`
+	ClusterID       uint       `gorm:"index" json:"cluster_id"`
+	Level           string     `gorm:"default:admin" json:"level"` // Access level to grant
+	Reason          string     `json:"reason"`
+	DurationMinutes int        `json:"duration_minutes"`
+	Status          string     `gorm:"index" json:"status"` // "pending", "approved", "denied" or "cancelled"
+	ReviewerID      *uint      `json:"reviewer_id,omitempty"`
+	ReviewNote      string     `json:"review_note,omitempty"`
+	ReviewedAt      *time.Time `json:"reviewed_at,omitempty"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+
+	User     User    `json:"user"`
+	Cluster  Cluster `json:"cluster"`
+	Reviewer *User   `json:"reviewer,omitempty"`
 }
 
 type AuditLog struct {
@@ -43,8 +195,106 @@ type AuditLog struct {
 	UserID    uint      `gorm:"index" json:"user_id"`
 	Action    string    `json:"action"` // Login, Logout, GetConfig
 	Detail    string    `json:"detail"`
+	Actor     string    `json:"actor,omitempty"`                   // Credential used, e.g. "token:ci-deploy"
+	ClusterID *uint     `gorm:"index" json:"cluster_id,omitempty"` // Cluster the entry is about, if any
+	Severity  string    `gorm:"index" json:"severity,omitempty"`   // "high" for events that need review
 	IPAddress string    `json:"ip_address"`
 	CreatedAt time.Time `json:"created_at"`
 
 	User User `json:"user,omitempty"`
 }
+
+// Session groups the refresh tokens issued from a single login.
+type Session struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index" json:"user_id"`
+	Device     string     `json:"device"` // Short label derived from the user agent
+	IP         string     `json:"ip"`     // Last address the session was used from
+	UserAgent  string     `json:"user_agent"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	Current    bool       `gorm:"-" json:"current"` // Set when listing the caller's own sessions
+}
+
+type RefreshToken struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	SessionID uint       `gorm:"index" json:"session_id"`
+	TokenHash string     `gorm:"uniqueIndex" json:"-"` // SHA-256 of the opaque token
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"` // Set once rotated
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RevokedToken is the access token revocation list, keyed by JWT ID.
+type RevokedToken struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	JTI       string    `gorm:"uniqueIndex" json:"jti"`
+	ExpiresAt time.Time `gorm:"index" json:"expires_at"` // Entry can be purged after this
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// APIToken is a personal access token. Only the hash is stored; the raw
+// token is shown once at creation.
+type APIToken struct {
+	ID         uint       `gorm:"primaryKey" json:"id"`
+	UserID     uint       `gorm:"index" json:"user_id"`
+	Name       string     `json:"name"`
+	TokenHash  string     `gorm:"uniqueIndex" json:"-"`
+	Prefix     string     `json:"prefix"` // First characters, to recognise the token
+	Scopes     string     `json:"scopes"` // Comma separated
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// RecoveryCode is a single-use MFA backup code. Only the hash is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	UserID    uint       `gorm:"index" json:"user_id"`
+	CodeHash  string     `json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Setting holds server-wide options that admins can change at runtime.
+type Setting struct {
+	Key       string    `gorm:"primaryKey" json:"key"`
+	Value     string    `json:"value"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// LoginThrottle counts recent failed logins for a username ("user:<name>")
+// or client IP ("ip:<addr>").
+type LoginThrottle struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	Key           string     `gorm:"uniqueIndex" json:"key"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+// PasswordHistory keeps previous password hashes to prevent reuse.
+type PasswordHistory struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index" json:"user_id"`
+	Hash      string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DeviceCode is a pending device authorization. The CLI polls with the
+// device code while a logged-in user approves the short user code.
+type DeviceCode struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	DeviceCodeHash string     `gorm:"uniqueIndex" json:"-"`
+	UserCode       string     `gorm:"uniqueIndex" json:"user_code"`
+	ClientIP       string     `json:"client_ip"`
+	UserID         uint       `json:"user_id,omitempty"` // Set on approval
+	ApprovedAt     *time.Time `json:"approved_at,omitempty"`
+	DeniedAt       *time.Time `json:"denied_at,omitempty"`
+	LastPolledAt   *time.Time `json:"-"`
+	ExpiresAt      time.Time  `json:"expires_at"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
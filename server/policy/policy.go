@@ -0,0 +1,206 @@
+// Package policy evaluates administrator-defined deny rules written in CEL
+// (https://github.com/google/cel-spec) against who is making a request, for
+// which cluster, from where and when.
+package policy
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"net"
+	"sync"
+	"time"
+	_ "time/tzdata" // Conditions may use named time zones, e.g. now.getHours("Europe/Berlin")
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+)
+
+// Actions a policy can apply to.
+const (
+	ActionKubeconfig = "kubeconfig" // Downloading a cluster's kubeconfig
+	ActionAdmin      = "admin"      // Any request that needs a capability
+	ActionAll        = "*"
+)
+
+func IsValidAction(action string) bool {
+	return action == ActionKubeconfig || action == ActionAdmin || action == ActionAll
+}
+
+// Input describes the request a policy is evaluated against.
+type Input struct {
+	User         models.User
+	Groups       []string
+	Capabilities []string
+	Cluster      *models.Cluster // Nil for admin requests
+	Level        string          // Access level of a kubeconfig download
+	BreakGlass   bool            // Whether the user holds break-glass access to the cluster
+	Action       string
+	IP           string
+	Method       string
+	Path         string
+	Time         time.Time
+}
+
+// Result is the outcome of a single policy. A condition that fails to
+// evaluate denies the request, so a broken policy cannot be bypassed.
+type Result struct {
+	Policy models.Policy `json:"policy"`
+	Denied bool          `json:"denied"`
+	Error  string        `json:"error,omitempty"`
+}
+
+type Decision struct {
+	Allowed  bool           `json:"allowed"`
+	DeniedBy *models.Policy `json:"denied_by,omitempty"`
+	Message  string         `json:"message,omitempty"`
+	Results  []Result       `json:"results"`
+}
+
+var (
+	env      *cel.Env
+	programs sync.Map // condition -> cel.Program
+)
+
+func init() {
+	var err error
+	env, err = cel.NewEnv(
+		cel.Variable("user", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("cluster", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("request", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("now", cel.TimestampType),
+		cel.Function("inCIDR",
+			cel.Overload("inCIDR_string_string", []*cel.Type{cel.StringType, cel.StringType}, cel.BoolType,
+				cel.BinaryBinding(inCIDR))),
+	)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// inCIDR reports whether an IP address lies inside a CIDR block.
+func inCIDR(ip, cidr ref.Val) ref.Val {
+	_, network, err := net.ParseCIDR(fmt.Sprint(cidr.Value()))
+	if err != nil {
+		return types.NewErr("invalid CIDR %q", cidr.Value())
+	}
+	addr := net.ParseIP(fmt.Sprint(ip.Value()))
+	return types.Bool(addr != nil && network.Contains(addr))
+}
+
+// Check compiles a condition and makes sure it evaluates to a boolean.
+func Check(condition string) error {
+	_, err := program(condition)
+	return err
+}
+
+func program(condition string) (cel.Program, error) {
+	if prg, ok := programs.Load(condition); ok {
+		return prg.(cel.Program), nil
+	}
+	ast, issues := env.Compile(condition)
+	if issues != nil && issues.Err() != nil {
+		return nil, issues.Err()
+	}
+	if ast.OutputType() != cel.BoolType {
+		return nil, fmt.Errorf("condition must evaluate to a bool, not %s", ast.OutputType())
+	}
+	prg, err := env.Program(ast)
+	if err != nil {
+		return nil, err
+	}
+	programs.Store(condition, prg)
+	return prg, nil
+}
+
+// Enforce evaluates every enabled policy that covers the input's action.
+func Enforce(in Input) Decision {
+	var policies []models.Policy
+	database.DB.Where("disabled = ? AND action IN ?", false, []string{in.Action, ActionAll}).Order("id").Find(&policies)
+	return Evaluate(policies, in)
+}
+
+// Evaluate runs the policies in order. The request is denied by the first
+// policy whose condition is true, but all of them are evaluated so a dry run
+// can show every result.
+func Evaluate(policies []models.Policy, in Input) Decision {
+	vars := in.variables()
+	decision := Decision{Allowed: true, Results: make([]Result, 0, len(policies))}
+	for i, p := range policies {
+		result := Result{Policy: p}
+		denied, err := evaluate(p.Condition, vars)
+		if err != nil {
+			result.Denied, result.Error = true, err.Error()
+		} else {
+			result.Denied = denied
+		}
+		if result.Denied && decision.Allowed {
+			decision.Allowed = false
+			decision.DeniedBy = &policies[i]
+			decision.Message = p.Message
+			if decision.Message == "" {
+				decision.Message = "Denied by policy " + p.Name
+			}
+		}
+		decision.Results = append(decision.Results, result)
+	}
+	return decision
+}
+
+func evaluate(condition string, vars map[string]interface{}) (bool, error) {
+	prg, err := program(condition)
+	if err != nil {
+		return false, err
+	}
+	out, _, err := prg.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+	denied, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("condition returned %v instead of a bool", out.Value())
+	}
+	return denied, nil
+}
+
+// variables exposes the input to CEL. Every key is always present, so
+// conditions only need has() for cluster labels.
+func (in Input) variables() map[string]interface{} {
+	groups := in.Groups
+	if groups == nil {
+		groups = []string{}
+	}
+	capabilities := in.Capabilities
+	if capabilities == nil {
+		capabilities = []string{}
+	}
+	cluster := map[string]interface{}{"id": 0, "name": "", "labels": map[string]string{}}
+	if in.Cluster != nil {
+		labels := in.Cluster.Labels
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		cluster = map[string]interface{}{"id": in.Cluster.ID, "name": in.Cluster.Name, "labels": labels}
+	}
+	return map[string]interface{}{
+		"user": map[string]interface{}{
+			"id":           in.User.ID,
+			"username":     in.User.Username,
+			"role":         in.User.Role,
+			"auth_source":  in.User.AuthSource,
+			"groups":       groups,
+			"capabilities": capabilities,
+		},
+		"cluster": cluster,
+		"request": map[string]interface{}{
+			"action":      in.Action,
+			"ip":          in.IP,
+			"method":      in.Method,
+			"path":        in.Path,
+			"level":       in.Level,
+			"break_glass": in.BreakGlass,
+		},
+		"now": in.Time,
+	}
+}
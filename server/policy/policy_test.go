@@ -0,0 +1,141 @@
+package policy
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testInput() Input {
+	return Input{
+		User:         models.User{ID: 3, Username: "alice", Role: "user", AuthSource: "oidc"},
+		Groups:       []string{"payments"},
+		Capabilities: []string{},
+		Cluster:      &models.Cluster{ID: 7, Name: "prod-east", Labels: map[string]string{"env": "prod"}},
+		Level:        "admin",
+		Action:       ActionKubeconfig,
+		IP:           "10.1.2.3",
+		Method:       "GET",
+		Path:         "/api/clusters/:id/config",
+		// A Monday, 20:30 in Berlin
+		Time: time.Date(2024, 3, 4, 19, 30, 0, 0, time.UTC),
+	}
+}
+
+func TestEvaluateConditions(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition string
+		change    func(*Input)
+		denied    bool
+	}{
+		{"outside office network", `!inCIDR(request.ip, "10.0.0.0/8")`, nil, false},
+		{"outside office network from home", `!inCIDR(request.ip, "10.0.0.0/8")`, func(in *Input) { in.IP = "203.0.113.9" }, true},
+		{"after hours in named zone", `cluster.labels["env"] == "prod" && now.getHours("Europe/Berlin") >= 19`, nil, true},
+		{"after hours in UTC", `now.getHours() >= 20`, nil, false},
+		{"missing label with has()", `has(cluster.labels.team) && cluster.labels.team == "data"`, nil, false},
+		{"group membership", `cluster.labels["env"] == "prod" && !("oncall" in user.groups)`, nil, true},
+		{"group member allowed", `cluster.labels["env"] == "prod" && !("oncall" in user.groups)`,
+			func(in *Input) { in.Groups = append(in.Groups, "oncall") }, false},
+		{"break-glass exemption", `request.level == "admin" && !request.break_glass`,
+			func(in *Input) { in.BreakGlass = true }, false},
+		{"admin request has an empty cluster", `cluster.name == "" && request.action == "admin"`,
+			func(in *Input) { in.Cluster, in.Action = nil, ActionAdmin }, true},
+		{"user attributes", `user.auth_source == "oidc" && user.username.startsWith("ali")`, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			in := testInput()
+			if tt.change != nil {
+				tt.change(&in)
+			}
+			decision := Evaluate([]models.Policy{{Name: "p", Condition: tt.condition}}, in)
+			if err := decision.Results[0].Error; err != "" {
+				t.Fatalf("evaluation error: %s", err)
+			}
+			if decision.Allowed == tt.denied {
+				t.Errorf("allowed = %v, want %v", decision.Allowed, !tt.denied)
+			}
+		})
+	}
+}
+
+func TestEvaluateFailsClosed(t *testing.T) {
+	// Indexing a label that is not set is an error at evaluation time.
+	decision := Evaluate([]models.Policy{{Name: "team", Condition: `cluster.labels["team"] == "data"`}}, testInput())
+	if decision.Allowed {
+		t.Fatal("a condition that fails to evaluate must deny")
+	}
+	if decision.Results[0].Error == "" {
+		t.Error("the evaluation error is not reported")
+	}
+
+	decision = Evaluate([]models.Policy{{Name: "cidr", Condition: `inCIDR(request.ip, "not-a-cidr")`}}, testInput())
+	if decision.Allowed {
+		t.Error("an invalid CIDR must deny")
+	}
+}
+
+func TestEvaluateReportsFirstDenial(t *testing.T) {
+	policies := []models.Policy{
+		{Name: "never", Condition: `false`},
+		{Name: "prod", Condition: `cluster.labels["env"] == "prod"`, Message: "Production is frozen"},
+		{Name: "everything", Condition: `true`},
+	}
+	decision := Evaluate(policies, testInput())
+	if decision.Allowed || decision.DeniedBy == nil || decision.DeniedBy.Name != "prod" {
+		t.Fatalf("denied by %+v, want prod", decision.DeniedBy)
+	}
+	if decision.Message != "Production is frozen" {
+		t.Errorf("message = %q", decision.Message)
+	}
+	if len(decision.Results) != 3 || !decision.Results[2].Denied {
+		t.Errorf("a dry run must show every result: %+v", decision.Results)
+	}
+
+	decision = Evaluate(policies[2:], testInput())
+	if decision.Message != "Denied by policy everything" {
+		t.Errorf("default message = %q", decision.Message)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if err := Check(`request.ip == "10.0.0.1"`); err != nil {
+		t.Errorf("valid condition rejected: %v", err)
+	}
+	if err := Check(`request.ip`); err == nil || !strings.Contains(err.Error(), "bool") {
+		t.Errorf("non-bool condition: got %v", err)
+	}
+	if err := Check(`request.ip ==`); err == nil {
+		t.Error("syntax error not reported")
+	}
+	if err := Check(`unknown.field`); err == nil {
+		t.Error("undeclared variable not reported")
+	}
+}
+
+func TestEnforceSelectsPolicies(t *testing.T) {
+	testutil.SetupDB(t)
+	database.DB.Create(&[]models.Policy{
+		{Name: "admin-only", Action: ActionAdmin, Condition: `true`},
+		{Name: "disabled", Action: ActionKubeconfig, Condition: `true`},
+		{Name: "office", Action: ActionAll, Condition: `!inCIDR(request.ip, "10.0.0.0/8")`},
+	})
+	database.DB.Model(&models.Policy{}).Where("name = ?", "disabled").Update("disabled", true)
+
+	in := testInput()
+	if decision := Enforce(in); !decision.Allowed || len(decision.Results) != 1 {
+		t.Fatalf("kubeconfig download from the office: %+v", decision)
+	}
+	in.IP = "203.0.113.9"
+	if decision := Enforce(in); decision.Allowed || decision.DeniedBy.Name != "office" {
+		t.Fatalf("kubeconfig download from home: %+v", decision)
+	}
+	in.Action = ActionAdmin
+	if decision := Enforce(in); decision.Allowed || decision.DeniedBy.Name != "admin-only" {
+		t.Fatalf("admin request: %+v", decision)
+	}
+}
@@ -0,0 +1,61 @@
+package policy
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"kubeswitch/server/utils"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UserInput fills in who a request is made by.
+func UserInput(user models.User) Input {
+	var groups []string
+	database.DB.Model(&models.Group{}).
+		Where("id IN (?)", database.DB.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", user.ID)).
+		Order("name").Pluck("name", &groups)
+
+	return Input{
+		User:         user,
+		Groups:       groups,
+		Capabilities: utils.EffectiveCapabilities(user.Role),
+		Time:         time.Now(),
+	}
+}
+
+// RequestInput describes the authenticated request in c.
+func RequestInput(c *gin.Context, action string, cluster *models.Cluster, level string) Input {
+	var user models.User
+	if database.DB.First(&user, c.GetUint("user_id")).Error != nil {
+		user = models.User{Username: c.GetString("username"), Role: c.GetString("role")}
+	}
+
+	in := UserInput(user)
+	in.Cluster = cluster
+	in.Level = level
+	in.Action = action
+	in.IP = c.ClientIP()
+	in.Method = c.Request.Method
+	in.Path = c.FullPath()
+	return in
+}
+
+// Allow reports whether the policies let the request continue. Otherwise it
+// aborts the request with 403 and records the denial.
+func Allow(c *gin.Context, in Input) bool {
+	decision := Enforce(in)
+	if decision.Allowed {
+		return true
+	}
+	detail := "Policy " + decision.DeniedBy.Name + " denied " + in.Method + " " + in.Path
+	if in.Cluster != nil {
+		utils.LogClusterAudit(c, in.Cluster.ID, "PolicyDenied", detail+" for cluster "+in.Cluster.Name)
+	} else {
+		utils.LogAuditContext(c, "PolicyDenied", detail)
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": decision.Message, "policy": decision.DeniedBy.Name})
+	c.Abort()
+	return false
+}
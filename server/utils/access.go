@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Access levels in ascending order. A cluster's own kubeconfig serves the
+// admin level; lower levels come from ClusterCredential variants.
+const (
+	LevelView  = "view"
+	LevelEdit  = "edit"
+	LevelAdmin = "admin"
+)
+
+var AccessLevels = []string{LevelView, LevelEdit, LevelAdmin}
+
+func IsValidAccessLevel(level string) bool {
+	return levelRank(level) >= 0
+}
+
+// LevelAtLeast reports whether level grants at least as much as min.
+func LevelAtLeast(level, min string) bool {
+	return levelRank(level) >= levelRank(min) && levelRank(min) >= 0
+}
+
+func levelRank(level string) int {
+	for i, l := range AccessLevels {
+		if l == level {
+			return i
+		}
+	}
+	return -1
+}
+
+// ClusterAccessLevels returns the highest level a user has been granted on
+// each cluster, either directly, through membership of a group or through a
+// label selector grant.
+func ClusterAccessLevels(userID uint) map[uint]string {
+	type grant struct {
+		ClusterID uint
+		Level     string
+	}
+	var grants, groupGrants []grant
+	database.DB.Model(&models.Permission{}).Scopes(activePermissions(time.Now())).
+		Where("user_id = ?", userID).Select("cluster_id, level").Scan(&grants)
+	database.DB.Model(&models.GroupPermission{}).Scopes(activePermissions(time.Now())).
+		Where("group_id IN (?)", database.DB.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Select("cluster_id, level").Scan(&groupGrants)
+
+	levels := make(map[uint]string)
+	for _, g := range append(grants, groupGrants...) {
+		if current, ok := levels[g.ClusterID]; !ok || levelRank(g.Level) > levelRank(current) {
+			levels[g.ClusterID] = g.Level
+		}
+	}
+	labelAccessLevels(userID, levels)
+	return levels
+}
+
+// HasBreakGlassAccess reports whether the user currently holds break-glass
+// access to the cluster.
+func HasBreakGlassAccess(userID, clusterID uint) bool {
+	var count int64
+	database.DB.Model(&models.Permission{}).Scopes(activePermissions(time.Now())).
+		Where("user_id = ? AND cluster_id = ? AND break_glass = ?", userID, clusterID, true).Count(&count)
+	return count > 0
+}
+
+// AccessibleClusterIDs returns the clusters a user has been granted at any
+// level.
+func AccessibleClusterIDs(userID uint) []uint {
+	levels := ClusterAccessLevels(userID)
+	ids := make([]uint, 0, len(levels))
+	for id := range levels {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// ClusterAccessLevel returns the user's level on the cluster, or "" if they
+// have no access.
+func ClusterAccessLevel(userID, clusterID uint) string {
+	return ClusterAccessLevels(userID)[clusterID]
+}
+
+func CanAccessCluster(userID, clusterID uint) bool {
+	return ClusterAccessLevel(userID, clusterID) != ""
+}
+
+// ClusterKubeconfig returns the most privileged kubeconfig variant of the
+// cluster that does not exceed level, and the level it was issued for.
+func ClusterKubeconfig(cluster models.Cluster, level string) (string, string, bool) {
+	for i := levelRank(level); i >= 0; i-- {
+		if AccessLevels[i] == LevelAdmin {
+			if cluster.Kubeconfig != "" {
+				return cluster.Kubeconfig, LevelAdmin, true
+			}
+			continue
+		}
+		var credential models.ClusterCredential
+		if database.DB.Where("cluster_id = ? AND level = ?", cluster.ID, AccessLevels[i]).First(&credential).Error == nil {
+			return credential.Kubeconfig, credential.Level, true
+		}
+	}
+	return "", "", false
+}
+
+// ClusterLevels returns the access levels each cluster has a kubeconfig for.
+func ClusterLevels(clusters []models.Cluster) map[uint][]string {
+	ids := make([]uint, 0, len(clusters))
+	for _, cluster := range clusters {
+		ids = append(ids, cluster.ID)
+	}
+	var credentials []models.ClusterCredential
+	database.DB.Select("cluster_id, level").Where("cluster_id IN ?", ids).Find(&credentials)
+
+	levels := make(map[uint][]string, len(clusters))
+	for _, level := range AccessLevels {
+		for _, credential := range credentials {
+			if credential.Level == level {
+				levels[credential.ClusterID] = append(levels[credential.ClusterID], level)
+			}
+		}
+	}
+	for _, cluster := range clusters {
+		if cluster.Kubeconfig != "" {
+			levels[cluster.ID] = append(levels[cluster.ID], LevelAdmin)
+		}
+	}
+	return levels
+}
+
+// activePermissions limits a permission query to grants inside their time
+// window.
+func activePermissions(now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(not_before IS NULL OR not_before <= ?) AND (expires_at IS NULL OR expires_at > ?)", now, now)
+	}
+}
+
+// Unscoped is a preload scope that includes soft-deleted rows, for records
+// that outlive the users and clusters they refer to.
+func Unscoped(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// PurgeExpiredPermissions deletes time-bound grants whose window has passed
+// and records each removal in the audit log. The removal is made by the
+// system, so the entries have no user; the grantee is named in the detail.
+func PurgeExpiredPermissions() error {
+	now := time.Now()
+
+	var expired []models.Permission
+	if err := database.DB.Preload("User", Unscoped).Preload("Cluster", Unscoped).
+		Where("expires_at <= ?", now).Find(&expired).Error; err != nil {
+		return err
+	}
+	for _, perm := range expired {
+		if err := database.DB.Delete(&perm).Error; err != nil {
+			return err
+		}
+		logExpiry(&perm.ClusterID, fmt.Sprintf("Access of user %s to cluster %s expired at %s",
+			perm.User.Username, perm.Cluster.Name, perm.ExpiresAt.Format(time.RFC3339)))
+	}
+
+	var expiredGroup []models.GroupPermission
+	if err := database.DB.Where("expires_at <= ?", now).Find(&expiredGroup).Error; err != nil {
+		return err
+	}
+	for _, perm := range expiredGroup {
+		if err := database.DB.Delete(&perm).Error; err != nil {
+			return err
+		}
+		logExpiry(&perm.ClusterID, fmt.Sprintf("Access of group %s to cluster %s expired at %s",
+			groupName(perm.GroupID), clusterName(perm.ClusterID), perm.ExpiresAt.Format(time.RFC3339)))
+	}
+
+	var expiredLabel []models.LabelPermission
+	if err := database.DB.Where("expires_at <= ?", now).Find(&expiredLabel).Error; err != nil {
+		return err
+	}
+	for _, perm := range expiredLabel {
+		if err := database.DB.Delete(&perm).Error; err != nil {
+			return err
+		}
+		var grantee string
+		if perm.UserID != nil {
+			grantee = "user " + userName(*perm.UserID)
+		} else if perm.GroupID != nil {
+			grantee = "group " + groupName(*perm.GroupID)
+		}
+		logExpiry(nil, fmt.Sprintf("Access of %s to clusters matching %q expired at %s",
+			grantee, perm.Selector, perm.ExpiresAt.Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// SystemActor marks audit entries made by the server itself rather than by
+// a user.
+const SystemActor = "system"
+
+func logExpiry(clusterID *uint, detail string) {
+	database.DB.Create(&models.AuditLog{
+		Action:    "PermissionExpired",
+		Detail:    detail,
+		Actor:     SystemActor,
+		ClusterID: clusterID,
+	})
+}
+
+func userName(id uint) string {
+	var user models.User
+	database.DB.Unscoped().Select("username").First(&user, id)
+	return user.Username
+}
+
+func groupName(id uint) string {
+	var group models.Group
+	database.DB.Select("name").First(&group, id)
+	return group.Name
+}
+
+func clusterName(id uint) string {
+	var cluster models.Cluster
+	database.DB.Unscoped().Select("name").First(&cluster, id)
+	return cluster.Name
+}
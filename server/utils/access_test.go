@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExpiredGrantsLoseAccessAndArePurged(t *testing.T) {
+	testutil.SetupDB(t)
+	user := models.User{Username: "contractor", Role: "user"}
+	database.DB.Create(&user)
+	group := models.Group{Name: "contractors"}
+	database.DB.Create(&group)
+	database.DB.Create(&models.GroupMember{GroupID: group.ID, UserID: user.ID})
+	direct := models.Cluster{Name: "direct"}
+	viaGroup := models.Cluster{Name: "via-group"}
+	viaLabel := models.Cluster{Name: "via-label", Labels: map[string]string{"env": "dev"}}
+	later := models.Cluster{Name: "later"}
+	for _, cluster := range []*models.Cluster{&direct, &viaGroup, &viaLabel, &later} {
+		database.DB.Create(cluster)
+	}
+
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+	database.DB.Create(&models.Permission{UserID: user.ID, ClusterID: direct.ID, Level: LevelAdmin, ExpiresAt: &past})
+	database.DB.Create(&models.GroupPermission{GroupID: group.ID, ClusterID: viaGroup.ID, Level: LevelView, ExpiresAt: &past})
+	database.DB.Create(&models.LabelPermission{UserID: &user.ID, Selector: "env=dev", Level: LevelEdit, ExpiresAt: &past})
+	database.DB.Create(&models.GroupPermission{GroupID: group.ID, ClusterID: later.ID, Level: LevelView, NotBefore: &future})
+
+	if levels := ClusterAccessLevels(user.ID); len(levels) != 0 {
+		t.Fatalf("grants outside their window give access: %v", levels)
+	}
+
+	if err := PurgeExpiredPermissions(); err != nil {
+		t.Fatal(err)
+	}
+	var remaining int64
+	database.DB.Model(&models.Permission{}).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("%d expired user grants left", remaining)
+	}
+	database.DB.Model(&models.LabelPermission{}).Count(&remaining)
+	if remaining != 0 {
+		t.Errorf("%d expired selector grants left", remaining)
+	}
+	var groupPerms []models.GroupPermission
+	database.DB.Find(&groupPerms)
+	if len(groupPerms) != 1 || groupPerms[0].ClusterID != later.ID {
+		t.Errorf("group grants after purge: %+v, want only the one not yet started", groupPerms)
+	}
+
+	var logs []models.AuditLog
+	database.DB.Where("action = ?", "PermissionExpired").Order("id").Find(&logs)
+	if len(logs) != 3 {
+		t.Fatalf("%d expiries audited, want 3", len(logs))
+	}
+	for _, entry := range logs {
+		if entry.UserID != 0 || entry.Actor != SystemActor {
+			t.Errorf("expiry audited as user %d, actor %q; want the system", entry.UserID, entry.Actor)
+		}
+	}
+	for i, want := range []string{"user contractor to cluster direct", "group contractors to cluster via-group", `user contractor to clusters matching "env=dev"`} {
+		if !strings.Contains(logs[i].Detail, want) {
+			t.Errorf("detail %q does not name %q", logs[i].Detail, want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package utils
+
+import "strings"
+
+// APITokenPrefix marks personal access tokens so AuthMiddleware can tell
+// them apart from JWTs.
+const APITokenPrefix = "ksp_"
+
+const (
+	ScopeClustersRead   = "clusters:read"
+	ScopeClustersConfig = "clusters:config"
+)
+
+var APITokenScopes = []string{ScopeClustersRead, ScopeClustersConfig}
+
+func IsValidScope(scope string) bool {
+	for _, s := range APITokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// GenerateAPIToken returns a new raw personal access token and its hash.
+func GenerateAPIToken() (string, string, error) {
+	random, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	raw := APITokenPrefix + random
+	return raw, HashToken(raw), nil
+}
+
+func HasScope(scopes, scope string) bool {
+	for _, s := range strings.Split(scopes, ",") {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,8 @@ package utils
 import (
 	"kubeswitch/server/database"
 	"kubeswitch/server/models"
+
+	"github.com/gin-gonic/gin"
 )
 
 func LogAudit(userID uint, action, detail, ip string) {
@@ -14,3 +16,57 @@ func LogAudit(userID uint, action, detail, ip string) {
 	}
 	database.DB.Create(&log)
 }
+
+// LogAuditContext records an audit entry for the authenticated caller,
+// including which credential (e.g. a personal access token) was used.
+func LogAuditContext(c *gin.Context, action, detail string) {
+	log := models.AuditLog{
+		UserID:    c.GetUint("user_id"),
+		Action:    action,
+		Detail:    detail,
+		Actor:     c.GetString("actor"),
+		IPAddress: c.ClientIP(),
+	}
+	database.DB.Create(&log)
+}
+
+// SeverityHigh flags audit entries that someone should review, such as
+// break-glass access.
+const SeverityHigh = "high"
+
+// LogAlert records a high-severity audit entry for the authenticated caller.
+func LogAlert(c *gin.Context, action, detail string) {
+	log := models.AuditLog{
+		UserID:    c.GetUint("user_id"),
+		Action:    action,
+		Detail:    detail,
+		Actor:     c.GetString("actor"),
+		Severity:  SeverityHigh,
+		IPAddress: c.ClientIP(),
+	}
+	database.DB.Create(&log)
+}
+
+// LogClusterAudit records an audit entry about a cluster, which its owners
+// can read.
+func LogClusterAudit(c *gin.Context, clusterID uint, action, detail string) {
+	logClusterAudit(c, clusterID, action, detail, "")
+}
+
+// LogClusterAlert records a high-severity audit entry about a cluster.
+func LogClusterAlert(c *gin.Context, clusterID uint, action, detail string) {
+	logClusterAudit(c, clusterID, action, detail, SeverityHigh)
+}
+
+func logClusterAudit(c *gin.Context, clusterID uint, action, detail, severity string) {
+	log := models.AuditLog{
+		UserID:    c.GetUint("user_id"),
+		Action:    action,
+		Detail:    detail,
+		Actor:     c.GetString("actor"),
+		ClusterID: &clusterID,
+		Severity:  severity,
+		IPAddress: c.ClientIP(),
+	}
+	database.DB.Create(&log)
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/kms"
+	"kubeswitch/server/models"
+)
+
+// ReencryptKubeconfigs encrypts every stored kubeconfig again under a fresh
+// data key wrapped by the current KMS provider. This encrypts records left
+// in plaintext and moves the rest off retired keys or providers. Deleted
+// clusters are included since their rows still hold credentials.
+func ReencryptKubeconfigs(ctx context.Context) (int, error) {
+	if !kms.Enabled() {
+		return 0, errors.New("KMS_PROVIDER is not set")
+	}
+
+	count := 0
+	var clusters []models.Cluster
+	if err := database.DB.Unscoped().Select("id, name, kubeconfig").Where("kubeconfig <> ''").Find(&clusters).Error; err != nil {
+		return count, err
+	}
+	for _, cluster := range clusters {
+		sealed, err := reencrypt(ctx, cluster.Kubeconfig, kms.KubeconfigAAD(cluster.ID, LevelAdmin))
+		if err != nil {
+			return count, fmt.Errorf("cluster %s: %w", cluster.Name, err)
+		}
+		if err := database.DB.Unscoped().Model(&cluster).UpdateColumn("kubeconfig", sealed).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	var credentials []models.ClusterCredential
+	if err := database.DB.Select("id, cluster_id, level, kubeconfig").Find(&credentials).Error; err != nil {
+		return count, err
+	}
+	for _, credential := range credentials {
+		sealed, err := reencrypt(ctx, credential.Kubeconfig, kms.KubeconfigAAD(credential.ClusterID, credential.Level))
+		if err != nil {
+			return count, fmt.Errorf("%s kubeconfig of cluster %d: %w", credential.Level, credential.ClusterID, err)
+		}
+		if err := database.DB.Model(&credential).UpdateColumn("kubeconfig", sealed).Error; err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+func reencrypt(ctx context.Context, stored string, aad []byte) (string, error) {
+	plaintext, err := kms.Open(ctx, stored, aad)
+	if err != nil {
+		return "", err
+	}
+	return kms.Seal(ctx, plaintext, aad)
+}
@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/kms"
+	"kubeswitch/server/models"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReencryptKubeconfigs(t *testing.T) {
+	testutil.SetupDB(t)
+	t.Cleanup(func() { kms.Configure() })
+	key := make([]byte, 32)
+	rand.Read(key)
+	path := filepath.Join(t.TempDir(), "kek")
+	os.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(key)), 0600)
+	t.Setenv("KMS_PROVIDER", "local")
+	t.Setenv("KMS_LOCAL_KEY_FILE", path)
+	if err := kms.Configure(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Rows written before encryption was enabled, one of them deleted
+	live := models.Cluster{Name: "prod", Kubeconfig: "admin-config"}
+	deleted := models.Cluster{Name: "old", Kubeconfig: "old-config"}
+	database.DB.Create(&live)
+	database.DB.Create(&deleted)
+	database.DB.Delete(&deleted)
+	credential := models.ClusterCredential{ClusterID: live.ID, Level: LevelView, Kubeconfig: "view-config"}
+	database.DB.Create(&credential)
+
+	ctx := context.Background()
+	for round := 1; round <= 2; round++ {
+		count, err := ReencryptKubeconfigs(ctx)
+		if err != nil || count != 3 {
+			t.Fatalf("round %d: re-encrypted %d (%v), want 3", round, count, err)
+		}
+	}
+
+	database.DB.Unscoped().First(&live, live.ID)
+	database.DB.Unscoped().First(&deleted, deleted.ID)
+	database.DB.First(&credential, credential.ID)
+	for _, record := range []struct {
+		stored, want string
+		aad          []byte
+	}{
+		{live.Kubeconfig, "admin-config", kms.KubeconfigAAD(live.ID, LevelAdmin)},
+		{deleted.Kubeconfig, "old-config", kms.KubeconfigAAD(deleted.ID, LevelAdmin)},
+		{credential.Kubeconfig, "view-config", kms.KubeconfigAAD(live.ID, LevelView)},
+	} {
+		if !kms.IsSealed(record.stored) {
+			t.Errorf("%s was not encrypted", record.want)
+			continue
+		}
+		if got, err := kms.Open(ctx, record.stored, record.aad); err != nil || got != record.want {
+			t.Errorf("got %q, %v; want %q", got, err, record.want)
+		}
+	}
+}
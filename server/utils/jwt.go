@@ -1,36 +1,42 @@
 package utils
 
 import (
-	"os"
+	"errors"
+	"kubeswitch/server/models"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
-var SecretKey = []byte(os.Getenv("JWT_SECRET"))
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+)
 
-func init() {
-	if len(SecretKey) == 0 {
-		SecretKey = []byte("supersecretkey")
+func GenerateToken(user models.User, sessionID uint) (string, error) {
+	jti, err := GenerateRandomToken(16)
+	if err != nil {
+		return "", err
 	}
-}
 
-func GenerateToken(userID uint, username, role string) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id":  userID,
-		"username": username,
-		"role":     role,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
+		"user_id":    user.ID,
+		"username":   user.Username,
+		"role":       user.Role,
+		"session_id": sessionID,
+		"jti":        jti,
+		"exp":        time.Now().Add(AccessTokenTTL).Unix(),
+	}
+	// Restricts the token to changing the password, see AuthMiddleware.
+	if PasswordExpired(user) {
+		claims["pwd_change"] = true
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(SecretKey)
+	return SignToken(claims)
 }
 
 func ValidateToken(tokenString string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		return SecretKey, nil
-	})
+	token, err := jwt.Parse(tokenString, verificationKey)
 
 	if err != nil {
 		return nil, err
@@ -42,3 +48,29 @@ func ValidateToken(tokenString string) (jwt.MapClaims, error) {
 
 	return nil, err
 }
+
+const MFATokenTTL = 5 * time.Minute
+
+// GenerateMFAToken issues the short-lived token that links the password step
+// of a login to the second factor. It is not accepted by AuthMiddleware.
+func GenerateMFAToken(userID uint) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"purpose": "mfa",
+		"exp":     time.Now().Add(MFATokenTTL).Unix(),
+	}
+
+	return SignToken(claims)
+}
+
+func ValidateMFAToken(tokenString string) (uint, error) {
+	claims, err := ValidateToken(tokenString)
+	if err != nil {
+		return 0, err
+	}
+	if claims["purpose"] != "mfa" {
+		return 0, errors.New("not an MFA token")
+	}
+	userID, _ := claims["user_id"].(float64)
+	return uint(userID), nil
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// signingKey is one entry of the key set. Retired keys only have a public
+// half and are kept so tokens they signed stay valid until they expire.
+type signingKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+var (
+	currentKey       *signingKey
+	verificationKeys = map[string]*signingKey{}
+)
+
+// LoadSigningKeys reads the signing key from JWT_SIGNING_KEY_FILE and any
+// retired keys from JWT_VERIFICATION_KEY_FILES (comma-separated). There is no
+// default: the server must not start with a guessable key.
+func LoadSigningKeys() error {
+	path := os.Getenv("JWT_SIGNING_KEY_FILE")
+	if path == "" {
+		return errors.New("JWT_SIGNING_KEY_FILE is not set; generate a key with " +
+			"`openssl genpkey -algorithm EC -pkeyopt ec_paramgen_curve:P-256 -out jwt.pem`")
+	}
+
+	key, err := loadKeyFile(path)
+	if err != nil {
+		return err
+	}
+	if key.Private == nil {
+		return fmt.Errorf("%s: signing key must be a private key", path)
+	}
+
+	keys := map[string]*signingKey{key.ID: key}
+	for _, p := range strings.Split(os.Getenv("JWT_VERIFICATION_KEY_FILES"), ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+		k, err := loadKeyFile(p)
+		if err != nil {
+			return err
+		}
+		keys[k.ID] = k
+	}
+
+	currentKey = key
+	verificationKeys = keys
+	return nil
+}
+
+// SignToken signs claims with the current key and records its ID in the kid
+// header.
+func SignToken(claims jwt.Claims) (string, error) {
+	if currentKey == nil {
+		return "", errors.New("signing key not loaded")
+	}
+	token := jwt.NewWithClaims(currentKey.Method, claims)
+	token.Header["kid"] = currentKey.ID
+	return token.SignedString(currentKey.Private)
+}
+
+// verificationKey selects the key named by the token's kid header and checks
+// the algorithm matches it, so a token cannot pick its own algorithm.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := verificationKeys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.Public, nil
+}
+
+// JWKS returns the public verification keys as a JSON Web Key Set.
+func JWKS() map[string]interface{} {
+	keys := make([]map[string]string, 0, len(verificationKeys))
+	for _, k := range verificationKeys {
+		jwk := publicJWK(k.Public)
+		jwk["kid"] = k.ID
+		jwk["alg"] = k.Method.Alg()
+		jwk["use"] = "sig"
+		keys = append(keys, jwk)
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+func loadKeyFile(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%s: unsupported PEM block %q", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	key := &signingKey{}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.Private = signer
+		key.Public = signer.Public()
+	} else {
+		key.Public = parsed
+	}
+
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("%s: RSA keys must be at least 2048 bits", path)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			key.Method = jwt.SigningMethodES256
+		case elliptic.P384():
+			key.Method = jwt.SigningMethodES384
+		default:
+			return nil, fmt.Errorf("%s: only P-256 and P-384 EC keys are supported", path)
+		}
+	default:
+		return nil, fmt.Errorf("%s: only RSA and EC keys are supported", path)
+	}
+
+	key.ID = thumbprint(key.Public)
+	return key, nil
+}
+
+func publicJWK(pub crypto.PublicKey) map[string]string {
+	enc := base64.RawURLEncoding
+	switch pub := pub.(type) {
+	case *rsa.PublicKey:
+		return map[string]string{
+			"kty": "RSA",
+			"n":   enc.EncodeToString(pub.N.Bytes()),
+			"e":   enc.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		return map[string]string{
+			"kty": "EC",
+			"crv": pub.Curve.Params().Name,
+			"x":   enc.EncodeToString(pub.X.FillBytes(make([]byte, size))),
+			"y":   enc.EncodeToString(pub.Y.FillBytes(make([]byte, size))),
+		}
+	}
+	return map[string]string{}
+}
+
+// thumbprint is the RFC 7638 JWK thumbprint, used as the key ID so it stays
+// the same across restarts without being configured.
+func thumbprint(pub crypto.PublicKey) string {
+	// json.Marshal sorts map keys, which is the member order RFC 7638 needs.
+	raw, _ := json.Marshal(publicJWK(pub))
+	sum := sha256.Sum256(raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// writeKey writes key as PKCS#8, or its public half as PKIX, to a PEM file.
+func writeKey(t *testing.T, key crypto.Signer, public bool) string {
+	t.Helper()
+	block := &pem.Block{Type: "PRIVATE KEY"}
+	var err error
+	if public {
+		block.Type = "PUBLIC KEY"
+		block.Bytes, err = x509.MarshalPKIXPublicKey(key.Public())
+	} else {
+		block.Bytes, err = x509.MarshalPKCS8PrivateKey(key)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// useSigningKeys loads the keys for the test and restores the previous set
+// afterwards.
+func useSigningKeys(t *testing.T, signing string, retired ...string) error {
+	t.Helper()
+	current, verification := currentKey, verificationKeys
+	t.Cleanup(func() { currentKey, verificationKeys = current, verification })
+	t.Setenv("JWT_SIGNING_KEY_FILE", signing)
+	t.Setenv("JWT_VERIFICATION_KEY_FILES", strings.Join(retired, ","))
+	return LoadSigningKeys()
+}
+
+func TestLoadKeyFileRejectsWeakKeys(t *testing.T) {
+	rsa1024, _ := rsa.GenerateKey(rand.Reader, 1024)
+	p224, _ := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	p521, _ := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	_, ed, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name string
+		key  crypto.Signer
+		want string
+	}{
+		{"RSA 1024", rsa1024, "at least 2048 bits"},
+		{"P-224", p224, "only P-256 and P-384"},
+		{"P-521", p521, "only P-256 and P-384"},
+		{"Ed25519", ed, "only RSA and EC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := loadKeyFile(writeKey(t, tt.key, false)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want %q", err, tt.want)
+			}
+		})
+	}
+
+	for name, key := range map[string]func() (crypto.Signer, error){
+		"RSA 2048": func() (crypto.Signer, error) { return rsa.GenerateKey(rand.Reader, 2048) },
+		"P-256":    func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P256(), rand.Reader) },
+		"P-384":    func() (crypto.Signer, error) { return ecdsa.GenerateKey(elliptic.P384(), rand.Reader) },
+	} {
+		k, _ := key()
+		if _, err := loadKeyFile(writeKey(t, k, false)); err != nil {
+			t.Errorf("%s rejected: %v", name, err)
+		}
+	}
+}
+
+func TestLoadSigningKeysNeedsPrivateKey(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err := useSigningKeys(t, writeKey(t, key, true)); err == nil || !strings.Contains(err.Error(), "must be a private key") {
+		t.Errorf("got %v", err)
+	}
+	if err := useSigningKeys(t, ""); err == nil {
+		t.Error("started without a signing key")
+	}
+}
+
+// TestThumbprintRFC7638 checks the key ID against the example in RFC 7638
+// section 3.1.
+func TestThumbprintRFC7638(t *testing.T) {
+	n, _ := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537}
+	if got, want := thumbprint(pub), "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("thumbprint = %s, want %s", got, want)
+	}
+}
+
+func TestVerificationKey(t *testing.T) {
+	current, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	retired, _ := rsa.GenerateKey(rand.Reader, 2048)
+	other, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err := useSigningKeys(t, writeKey(t, current, false), writeKey(t, retired, true)); err != nil {
+		t.Fatal(err)
+	}
+	currentID, retiredID := thumbprint(current.Public()), thumbprint(retired.Public())
+	claims := jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Minute).Unix()}
+
+	sign := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	retiredDER, _ := x509.MarshalPKIXPublicKey(retired.Public())
+
+	signed, err := SignToken(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ValidateToken(signed); err != nil {
+		t.Errorf("current key: %v", err)
+	}
+	if _, err := ValidateToken(sign(jwt.SigningMethodRS256, retiredID, retired)); err != nil {
+		t.Errorf("retired key: %v", err)
+	}
+
+	rejected := map[string]string{
+		"no kid":                              sign(jwt.SigningMethodES256, "", current),
+		"unknown kid":                         sign(jwt.SigningMethodES256, thumbprint(other.Public()), other),
+		"wrong key for kid":                   sign(jwt.SigningMethodES256, currentID, other),
+		"HS256 with the public key as secret": sign(jwt.SigningMethodHS256, retiredID, retiredDER),
+		"RS256 under an ES256 kid":            sign(jwt.SigningMethodRS256, currentID, retired),
+		"none":                                sign(jwt.SigningMethodNone, currentID, jwt.UnsafeAllowNoneSignatureType),
+	}
+	for name, token := range rejected {
+		if _, err := ValidateToken(token); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	current, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	retired, _ := rsa.GenerateKey(rand.Reader, 2048)
+	if err := useSigningKeys(t, writeKey(t, current, false), writeKey(t, retired, true)); err != nil {
+		t.Fatal(err)
+	}
+
+	keys := JWKS()["keys"].([]map[string]string)
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys, want 2", len(keys))
+	}
+	byID := map[string]map[string]string{}
+	for _, k := range keys {
+		if k["d"] != "" || k["p"] != "" {
+			t.Errorf("private key material published: %v", k)
+		}
+		byID[k["kid"]] = k
+	}
+
+	ec := byID[thumbprint(current.Public())]
+	x, _ := base64.RawURLEncoding.DecodeString(ec["x"])
+	if ec["kty"] != "EC" || ec["crv"] != "P-384" || ec["alg"] != "ES384" || ec["use"] != "sig" ||
+		len(x) != 48 || new(big.Int).SetBytes(x).Cmp(current.X) != 0 {
+		t.Errorf("EC key: %v", ec)
+	}
+	rsaKey := byID[thumbprint(retired.Public())]
+	if rsaKey["kty"] != "RSA" || rsaKey["alg"] != "RS256" || rsaKey["e"] != "AQAB" ||
+		rsaKey["n"] != base64.RawURLEncoding.EncodeToString(retired.N.Bytes()) {
+		t.Errorf("RSA key: %v", rsaKey)
+	}
+}
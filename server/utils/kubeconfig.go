@@ -0,0 +1,119 @@
+package utils
+
+import (
+	"fmt"
+	"kubeswitch/server/models"
+	"net/url"
+	"sort"
+
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+// KubeconfigErrors maps a field path such as "contexts[prod].cluster" to
+// what is wrong with it.
+type KubeconfigErrors map[string]string
+
+// ParseKubeconfig validates a kubeconfig and returns it re-serialised in
+// canonical form together with its metadata. Every context must resolve to
+// a cluster and user, and the current context must exist, so that the file
+// works as downloaded. Credentials have to be embedded because file paths
+// refer to the uploader's machine.
+func ParseKubeconfig(raw string) (string, models.KubeconfigInfo, KubeconfigErrors) {
+	var info models.KubeconfigInfo
+
+	config, err := clientcmd.Load([]byte(raw))
+	if err != nil {
+		return "", info, KubeconfigErrors{"kubeconfig": err.Error()}
+	}
+
+	errs := KubeconfigErrors{}
+	if len(config.Clusters) == 0 {
+		errs["clusters"] = "no clusters defined"
+	}
+	if len(config.AuthInfos) == 0 {
+		errs["users"] = "no users defined"
+	}
+	if len(config.Contexts) == 0 {
+		errs["contexts"] = "no contexts defined"
+	}
+
+	for name, cluster := range config.Clusters {
+		field := fmt.Sprintf("clusters[%s]", name)
+		if cluster.Server == "" {
+			errs[field+".server"] = "server is required"
+		} else if u, err := url.Parse(cluster.Server); err != nil || u.Scheme == "" || u.Host == "" {
+			errs[field+".server"] = fmt.Sprintf("invalid server URL %q", cluster.Server)
+		}
+		if cluster.CertificateAuthority != "" {
+			errs[field+".certificate-authority"] = "file references are not supported, use certificate-authority-data"
+		}
+	}
+
+	for name, user := range config.AuthInfos {
+		field := fmt.Sprintf("users[%s]", name)
+		if user.ClientCertificate != "" {
+			errs[field+".client-certificate"] = "file references are not supported, use client-certificate-data"
+		}
+		if user.ClientKey != "" {
+			errs[field+".client-key"] = "file references are not supported, use client-key-data"
+		}
+		if user.TokenFile != "" {
+			errs[field+".tokenFile"] = "file references are not supported, use token"
+		}
+	}
+
+	for name, context := range config.Contexts {
+		field := fmt.Sprintf("contexts[%s]", name)
+		if _, ok := config.Clusters[context.Cluster]; !ok {
+			errs[field+".cluster"] = fmt.Sprintf("refers to undefined cluster %q", context.Cluster)
+		}
+		if _, ok := config.AuthInfos[context.AuthInfo]; !ok {
+			errs[field+".user"] = fmt.Sprintf("refers to undefined user %q", context.AuthInfo)
+		}
+	}
+
+	current, ok := config.Contexts[config.CurrentContext]
+	if config.CurrentContext == "" {
+		errs["current-context"] = "current-context is required"
+	} else if !ok {
+		errs["current-context"] = fmt.Sprintf("refers to undefined context %q", config.CurrentContext)
+	}
+
+	if len(errs) > 0 {
+		return "", info, errs
+	}
+
+	normalized, err := clientcmd.Write(*config)
+	if err != nil {
+		return "", info, KubeconfigErrors{"kubeconfig": err.Error()}
+	}
+
+	info.Server = config.Clusters[current.Cluster].Server
+	info.CurrentContext = config.CurrentContext
+	info.AuthType = authType(config.AuthInfos[current.AuthInfo])
+	for name := range config.Contexts {
+		info.Contexts = append(info.Contexts, name)
+	}
+	sort.Strings(info.Contexts)
+
+	return string(normalized), info, nil
+}
+
+// authType names how the user authenticates, for display.
+func authType(user *clientcmdapi.AuthInfo) string {
+	switch {
+	case user.Exec != nil:
+		return "exec"
+	case user.AuthProvider != nil:
+		return "auth-provider"
+	case len(user.ClientCertificateData) > 0:
+		return "client-certificate"
+	case user.Token != "":
+		return "token"
+	case user.Username != "":
+		return "basic"
+	default:
+		return "none"
+	}
+}
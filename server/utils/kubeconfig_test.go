@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"kubeswitch/server/models"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const validKubeconfig = `# Comments are dropped
+apiVersion: v1
+kind: Config
+current-context: prod
+contexts:
+- name: staging
+  context:
+    cluster: staging
+    user: deployer
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+clusters:
+- name: staging
+  cluster:
+    server: https://staging.example.com:6443
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+    certificate-authority-data: Y2EK
+users:
+- name: admin
+  user:
+    client-certificate-data: Y2VydAo=
+    client-key-data: a2V5Cg==
+- name: deployer
+  user:
+    token: secret
+`
+
+func TestParseKubeconfig(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		// Field paths that must be reported, or none for a valid file
+		errs []string
+	}{
+		{name: "invalid YAML", raw: "clusters: [", errs: []string{"kubeconfig"}},
+		{name: "empty", raw: "apiVersion: v1\nkind: Config\n", errs: []string{"clusters", "users", "contexts", "current-context"}},
+		{
+			name: "missing current-context",
+			raw:  strings.Replace(validKubeconfig, "current-context: prod\n", "", 1),
+			errs: []string{"current-context"},
+		},
+		{
+			name: "undefined current-context",
+			raw:  strings.Replace(validKubeconfig, "current-context: prod", "current-context: dev", 1),
+			errs: []string{"current-context"},
+		},
+		{
+			name: "context with unknown cluster",
+			raw:  strings.Replace(validKubeconfig, "cluster: staging\n", "cluster: qa\n", 1),
+			errs: []string{"contexts[staging].cluster"},
+		},
+		{
+			name: "context with unknown user",
+			raw:  strings.Replace(validKubeconfig, "user: deployer\n", "user: nobody\n", 1),
+			errs: []string{"contexts[staging].user"},
+		},
+		{
+			name: "server without scheme",
+			raw:  strings.Replace(validKubeconfig, "https://staging.example.com:6443", "staging.example.com", 1),
+			errs: []string{"clusters[staging].server"},
+		},
+		{
+			name: "file references",
+			raw: strings.Replace(strings.Replace(validKubeconfig,
+				"certificate-authority-data: Y2EK", "certificate-authority: /home/me/ca.crt", 1),
+				"token: secret", "tokenFile: /home/me/token", 1),
+			errs: []string{"clusters[prod].certificate-authority", "users[deployer].tokenFile"},
+		},
+		{name: "valid", raw: validKubeconfig},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, _, errs := ParseKubeconfig(tt.raw)
+			got := make([]string, 0, len(errs))
+			for field := range errs {
+				got = append(got, field)
+			}
+			want := append([]string{}, tt.errs...)
+			sort.Strings(got)
+			sort.Strings(want)
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("errors %v, want fields %v", errs, want)
+			}
+			if (normalized == "") != (len(tt.errs) > 0) {
+				t.Errorf("normalized kubeconfig %q with errors %v", normalized, errs)
+			}
+		})
+	}
+}
+
+func TestKubeconfigInfoAndNormalization(t *testing.T) {
+	normalized, info, errs := ParseKubeconfig(validKubeconfig)
+	if errs != nil {
+		t.Fatal(errs)
+	}
+
+	want := models.KubeconfigInfo{
+		Server:         "https://prod.example.com:6443",
+		CurrentContext: "prod",
+		Contexts:       []string{"prod", "staging"},
+		AuthType:       "client-certificate",
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("info = %+v, want %+v", info, want)
+	}
+
+	if strings.Contains(normalized, "Comments") {
+		t.Error("comment survived normalization")
+	}
+	// The canonical form parses to the same thing and is stable
+	again, againInfo, errs := ParseKubeconfig(normalized)
+	if errs != nil {
+		t.Fatalf("normalized kubeconfig is invalid: %v", errs)
+	}
+	if again != normalized || !reflect.DeepEqual(againInfo, info) {
+		t.Errorf("normalizing twice changed the result:\n%s\n---\n%s", normalized, again)
+	}
+	if strings.Index(normalized, "name: prod") > strings.Index(normalized, "name: staging") {
+		t.Errorf("entries are not sorted by name:\n%s", normalized)
+	}
+
+	const adminUser = "  user:\n    client-certificate-data: Y2VydAo=\n    client-key-data: a2V5Cg=="
+	for auth, user := range map[string]string{
+		"token": "  user:\n    token: secret",
+		"basic": "  user:\n    username: admin\n    password: secret",
+		"exec":  "  user:\n    exec:\n      apiVersion: client.authentication.k8s.io/v1\n      command: kubelogin",
+		"none":  "  user: {}",
+	} {
+		raw := strings.Replace(validKubeconfig, adminUser, user, 1)
+		if _, info, errs := ParseKubeconfig(raw); errs != nil || info.AuthType != auth {
+			t.Errorf("%s: got auth type %q, %v", auth, info.AuthType, errs)
+		}
+	}
+}
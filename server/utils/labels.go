@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"time"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ValidateClusterLabels checks label keys and values against the Kubernetes
+// label syntax, so that selectors behave the same way as in kubectl.
+func ValidateClusterLabels(clusterLabels map[string]string) error {
+	for key, value := range clusterLabels {
+		if errs := validation.IsQualifiedName(key); len(errs) > 0 {
+			return fmt.Errorf("invalid label key %q: %s", key, errs[0])
+		}
+		if errs := validation.IsValidLabelValue(value); len(errs) > 0 {
+			return fmt.Errorf("invalid value for label %q: %s", key, errs[0])
+		}
+	}
+	return nil
+}
+
+// ParseLabelSelector parses a selector such as "env!=prod,team=payments".
+// The empty selector is rejected because it would match every cluster.
+func ParseLabelSelector(selector string) (labels.Selector, error) {
+	parsed, err := labels.Parse(selector)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Empty() {
+		return nil, fmt.Errorf("selector must not be empty")
+	}
+	return parsed, nil
+}
+
+// MatchesLabels reports whether cluster labels satisfy a parsed selector.
+func MatchesLabels(selector labels.Selector, clusterLabels map[string]string) bool {
+	return selector.Matches(labels.Set(clusterLabels))
+}
+
+// labelAccessLevels evaluates the user's selector grants, direct and through
+// groups, against the current labels of every cluster.
+func labelAccessLevels(userID uint, levels map[uint]string) {
+	var grants []models.LabelPermission
+	database.DB.Scopes(activePermissions(time.Now())).
+		Where("user_id = ? OR group_id IN (?)", userID,
+			database.DB.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Find(&grants)
+	if len(grants) == 0 {
+		return
+	}
+
+	var clusters []models.Cluster
+	database.DB.Select("id, labels").Find(&clusters)
+	for _, grant := range grants {
+		selector, err := ParseLabelSelector(grant.Selector)
+		if err != nil {
+			continue
+		}
+		for _, cluster := range clusters {
+			if !MatchesLabels(selector, cluster.Labels) {
+				continue
+			}
+			if current, ok := levels[cluster.ID]; !ok || levelRank(grant.Level) > levelRank(current) {
+				levels[cluster.ID] = grant.Level
+			}
+		}
+	}
+}
+
+// FormatLabels renders labels as a sorted "key=value,..." string, or
+// "(none)" for a cluster without labels.
+func FormatLabels(clusterLabels map[string]string) string {
+	if len(clusterLabels) == 0 {
+		return "(none)"
+	}
+	return labels.Set(clusterLabels).String()
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"time"
+)
+
+// MFAEnrollmentTokenTTL is how long an admin-issued enrolment token stays
+// valid.
+const MFAEnrollmentTokenTTL = 24 * time.Hour
+
+// IssueMFAEnrollmentToken lets the user enrol in MFA during login, which the
+// password alone does not allow, and replaces any token issued before. The
+// raw token is only returned here.
+func IssueMFAEnrollmentToken(user *models.User) (string, time.Time, error) {
+	raw, err := GenerateRandomToken(24)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	expiresAt := time.Now().Add(MFAEnrollmentTokenTTL)
+	err = database.DB.Model(user).Updates(map[string]interface{}{
+		"mfa_enroll_hash":       HashToken(raw),
+		"mfa_enroll_expires_at": expiresAt,
+	}).Error
+	return raw, expiresAt, err
+}
+
+// ValidMFAEnrollmentToken reports whether raw is the user's unexpired
+// enrolment token. Activating MFA clears the token.
+func ValidMFAEnrollmentToken(user models.User, raw string) bool {
+	if user.MFAEnrollHash == "" || user.MFAEnrollExpiresAt == nil || time.Now().After(*user.MFAEnrollExpiresAt) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(user.MFAEnrollHash), []byte(HashToken(raw))) == 1
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"net"
+	"strings"
+)
+
+// ParseCIDRs parses CIDR blocks. A bare address is treated as a single host,
+// so "10.0.0.1" means "10.0.0.1/32".
+func ParseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		original := strings.TrimSpace(cidr)
+		if original == "" {
+			continue
+		}
+		cidr = original
+		if !strings.Contains(cidr, "/") {
+			if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR %q", original)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// NormalizeCIDRs validates an allowlist and returns it in canonical form
+// without duplicates, e.g. "10.1.2.3/8" becomes "10.0.0.0/8".
+func NormalizeCIDRs(cidrs []string) ([]string, error) {
+	networks, err := ParseCIDRs(cidrs)
+	if err != nil {
+		return nil, err
+	}
+	normalized := []string{}
+	seen := map[string]bool{}
+	for _, network := range networks {
+		if s := network.String(); !seen[s] {
+			seen[s] = true
+			normalized = append(normalized, s)
+		}
+	}
+	return normalized, nil
+}
+
+// IPInCIDRs reports whether ip lies inside any of the blocks. An empty
+// allowlist does not restrict anything.
+func IPInCIDRs(ip string, cidrs []string) bool {
+	if len(cidrs) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	networks, _ := ParseCIDRs(cidrs)
+	for _, network := range networks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceIPAllowed checks ip against the allowlists of the user and of every
+// group they are in. Each list that is set must contain the address, so a
+// group allowlist cannot be widened by membership in another group. Lookup
+// errors deny access. When access is denied it also returns the reason.
+func SourceIPAllowed(userID uint, ip string) (bool, string) {
+	var user models.User
+	if err := database.DB.Select("id, allowed_cidrs").First(&user, userID).Error; err != nil {
+		return false, "failed user lookup"
+	}
+	if !IPInCIDRs(ip, user.AllowedCIDRs) {
+		return false, "user allowlist"
+	}
+
+	var groups []models.Group
+	if err := database.DB.Select("id, name, allowed_cidrs").
+		Where("id IN (?)", database.DB.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Find(&groups).Error; err != nil {
+		return false, "failed group lookup"
+	}
+	for _, group := range groups {
+		if !IPInCIDRs(ip, group.AllowedCIDRs) {
+			return false, "allowlist of group " + group.Name
+		}
+	}
+	return true, ""
+}
@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+var notifyClient = &http.Client{Timeout: 10 * time.Second}
+
+// Notify posts an event to NOTIFY_WEBHOOK_URL in the background. The "text"
+// field makes the payload usable with Slack-compatible incoming webhooks;
+// data carries the structured details. Without a URL it does nothing.
+func Notify(event, text string, data interface{}) {
+	url := os.Getenv("NOTIFY_WEBHOOK_URL")
+	if url == "" {
+		return
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"event": event,
+		"text":  text,
+		"data":  data,
+	})
+	if err != nil {
+		log.Println("Failed to encode notification:", err)
+		return
+	}
+
+	go func() {
+		resp, err := notifyClient.Post(url, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Println("Failed to send notification:", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Println("Notification webhook returned", resp.Status)
+		}
+	}()
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+)
+
+// OwnedClusterIDs returns the clusters a user owns, directly or through
+// membership of an owning group.
+func OwnedClusterIDs(userID uint) []uint {
+	var ids []uint
+	database.DB.Model(&models.ClusterOwner{}).Distinct().
+		Where("user_id = ? OR group_id IN (?)", userID,
+			database.DB.Model(&models.GroupMember{}).Select("group_id").Where("user_id = ?", userID)).
+		Pluck("cluster_id", &ids)
+	return ids
+}
+
+func IsClusterOwner(userID, clusterID uint) bool {
+	for _, id := range OwnedClusterIDs(userID) {
+		if id == clusterID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,181 @@
+package utils
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	SettingPasswordPolicy = "password_policy"
+	maxPasswordHistory    = 24
+)
+
+// PasswordPolicy is stored as JSON in the settings table so admins can change
+// it at runtime.
+type PasswordPolicy struct {
+	MinLength        int  `json:"min_length" binding:"min=1,max=128"`
+	RequireUppercase bool `json:"require_uppercase"`
+	RequireLowercase bool `json:"require_lowercase"`
+	RequireDigit     bool `json:"require_digit"`
+	RequireSymbol    bool `json:"require_symbol"`
+	HistorySize      int  `json:"history_size" binding:"min=0,max=24"` // Previous passwords that cannot be reused
+	MaxAgeDays       int  `json:"max_age_days" binding:"min=0"`        // 0 disables expiry
+	DenyCommon       bool `json:"deny_common"`
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:        8,
+	RequireUppercase: true,
+	RequireLowercase: true,
+	RequireDigit:     true,
+	HistorySize:      5,
+	DenyCommon:       true,
+}
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]bool {
+	m := make(map[string]bool)
+	for _, p := range strings.Split(commonPasswordList, "\n") {
+		if p = strings.TrimSpace(p); p != "" {
+			m[p] = true
+		}
+	}
+	return m
+}()
+
+func LoadPasswordPolicy() PasswordPolicy {
+	policy := DefaultPasswordPolicy
+	if raw := GetSetting(SettingPasswordPolicy, ""); raw != "" {
+		json.Unmarshal([]byte(raw), &policy)
+	}
+	return policy
+}
+
+func SavePasswordPolicy(policy PasswordPolicy) error {
+	raw, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+	return SetSetting(SettingPasswordPolicy, string(raw))
+}
+
+// Validate returns the rules the password breaks. It does not check reuse
+// history, which needs the user's stored hashes.
+func (p PasswordPolicy) Validate(password, username string) []string {
+	var violations []string
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("must be at least %d characters", p.MinLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	if p.RequireUppercase && !upper {
+		violations = append(violations, "must contain an uppercase letter")
+	}
+	if p.RequireLowercase && !lower {
+		violations = append(violations, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "must contain a symbol")
+	}
+
+	if p.DenyCommon {
+		lowered := strings.ToLower(password)
+		if commonPasswords[lowered] || (len(username) >= 3 && strings.Contains(lowered, strings.ToLower(username))) {
+			violations = append(violations, "is too common or contains the username")
+		}
+	}
+	return violations
+}
+
+// IsPasswordReused reports whether the password matches the user's current
+// password or one of the last HistorySize passwords.
+func (p PasswordPolicy) IsPasswordReused(user models.User, password string) bool {
+	if p.HistorySize <= 0 {
+		return false
+	}
+	if user.Password != "" && CheckPasswordHash(password, user.Password) {
+		return true
+	}
+
+	var history []models.PasswordHistory
+	database.DB.Where("user_id = ?", user.ID).Order("created_at desc").Limit(p.HistorySize - 1).Find(&history)
+	for _, h := range history {
+		if CheckPasswordHash(password, h.Hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// PasswordExpired reports whether a local user has to change their password
+// before doing anything else.
+func PasswordExpired(user models.User) bool {
+	if user.AuthSource != "local" {
+		return false
+	}
+	if user.MustChangePassword {
+		return true
+	}
+
+	maxAge := LoadPasswordPolicy().MaxAgeDays
+	if maxAge <= 0 {
+		return false
+	}
+	changedAt := user.CreatedAt
+	if user.PasswordChangedAt != nil {
+		changedAt = *user.PasswordChangedAt
+	}
+	return time.Since(changedAt) > time.Duration(maxAge)*24*time.Hour
+}
+
+// SetUserPassword stores a new hash, keeping the previous one in the reuse
+// history. mustChange forces another change at next login, e.g. after an
+// admin reset.
+func SetUserPassword(user *models.User, hash string, mustChange bool) error {
+	now := time.Now()
+	if user.Password != "" {
+		if err := database.DB.Create(&models.PasswordHistory{UserID: user.ID, Hash: user.Password}).Error; err != nil {
+			return err
+		}
+	}
+
+	user.Password = hash
+	user.PasswordChangedAt = &now
+	user.MustChangePassword = mustChange
+	if err := database.DB.Save(user).Error; err != nil {
+		return err
+	}
+
+	// Only keep as much history as the largest policy allows.
+	var ids []uint
+	database.DB.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).
+		Order("created_at desc").Pluck("id", &ids)
+	if len(ids) > maxPasswordHistory {
+		database.DB.Delete(&models.PasswordHistory{}, ids[maxPasswordHistory:])
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"log"
+	"strings"
+)
+
+const (
+	CapClustersCreate        = "clusters:create"
+	CapClustersDelete        = "clusters:delete"
+	CapClustersList          = "clusters:list"     // See every cluster, without its kubeconfig
+	CapKubeconfigRead        = "kubeconfig:read"   // Download any cluster's kubeconfig
+	CapKubeconfigImport      = "kubeconfig:import" // Replace a cluster's kubeconfig
+	CapPermissionsManage     = "permissions:manage"
+	CapGroupsManage          = "groups:manage"
+	CapUsersManage           = "users:manage"
+	CapRolesManage           = "roles:manage"
+	CapServiceAccountsManage = "service-accounts:manage"
+	CapAuditRead             = "audit:read"
+	CapSettingsManage        = "settings:manage"
+	CapAccessRequestsReview  = "access-requests:review"
+	CapPoliciesManage        = "policies:manage"
+	CapBreakGlass            = "clusters:break-glass" // Grant oneself emergency access to any cluster
+)
+
+// CapAll grants every capability, including ones added later.
+const CapAll = "*"
+
+var Capabilities = []string{
+	CapClustersCreate, CapClustersDelete, CapClustersList, CapKubeconfigRead, CapKubeconfigImport,
+	CapPermissionsManage, CapGroupsManage, CapUsersManage, CapRolesManage, CapServiceAccountsManage,
+	CapAuditRead, CapSettingsManage, CapAccessRequestsReview, CapPoliciesManage, CapBreakGlass,
+}
+
+// DefaultRole is given to new users when no role is specified.
+const DefaultRole = "user"
+
+// IsBuiltInRole reports whether name is one of the roles SeedRoles creates.
+func IsBuiltInRole(name string) bool {
+	return name == "admin" || name == DefaultRole
+}
+
+func IsValidCapability(capability string) bool {
+	if capability == CapAll {
+		return true
+	}
+	for _, c := range Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// SeedRoles creates the built-in roles if they are missing.
+func SeedRoles() {
+	builtIn := []models.Role{
+		{Name: "admin", Description: "Full access", Capabilities: CapAll, BuiltIn: true},
+		{Name: DefaultRole, Description: "Access to granted clusters only", BuiltIn: true},
+	}
+	for _, role := range builtIn {
+		if err := database.DB.Where(models.Role{Name: role.Name}).FirstOrCreate(&role).Error; err != nil {
+			log.Println("Failed to seed role", role.Name, ":", err)
+		}
+	}
+}
+
+// RoleCapabilities returns the capabilities of the named role. Unknown roles
+// have none.
+func RoleCapabilities(roleName string) []string {
+	var role models.Role
+	if err := database.DB.Where("name = ?", roleName).First(&role).Error; err != nil {
+		return nil
+	}
+	return SplitCapabilities(role.Capabilities)
+}
+
+// EffectiveCapabilities expands "*" to the full capability list.
+func EffectiveCapabilities(roleName string) []string {
+	capabilities := RoleCapabilities(roleName)
+	for _, c := range capabilities {
+		if c == CapAll {
+			return Capabilities
+		}
+	}
+	if capabilities == nil {
+		return []string{}
+	}
+	return capabilities
+}
+
+// HasCapability reports whether the named role grants any of the
+// capabilities.
+func HasCapability(roleName string, capabilities ...string) bool {
+	for _, held := range RoleCapabilities(roleName) {
+		if held == CapAll {
+			return true
+		}
+		for _, c := range capabilities {
+			if held == c {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// RoleCovers reports whether holder has every capability of the role named
+// other, so that managing a user with that role cannot escalate privilege.
+func RoleCovers(holder, other string) bool {
+	if HasCapability(holder, CapAll) {
+		return true
+	}
+	for _, c := range RoleCapabilities(other) {
+		if c == CapAll || !HasCapability(holder, c) {
+			return false
+		}
+	}
+	return true
+}
+
+// RolesWithCapability returns the names of roles that grant the capability.
+func RolesWithCapability(capability string) []string {
+	var roles []models.Role
+	database.DB.Find(&roles)
+	var names []string
+	for _, role := range roles {
+		for _, c := range SplitCapabilities(role.Capabilities) {
+			if c == CapAll || c == capability {
+				names = append(names, role.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+func SplitCapabilities(capabilities string) []string {
+	var list []string
+	for _, c := range strings.Split(capabilities, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			list = append(list, c)
+		}
+	}
+	return list
+}
@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// GenerateRandomToken returns n random bytes encoded as URL-safe base64.
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex SHA-256 of an opaque token for storage.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// sessionTouchInterval limits how often request handling writes last-seen
+// times back to the session table.
+const sessionTouchInterval = time.Minute
+
+// CreateSession starts a new session for the user and returns it together
+// with the first raw refresh token.
+func CreateSession(userID uint, ip, userAgent string) (models.Session, string, error) {
+	now := time.Now()
+	session := models.Session{
+		UserID:     userID,
+		Device:     DeviceLabel(userAgent),
+		IP:         ip,
+		UserAgent:  userAgent,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	}
+
+	var raw string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+		var err error
+		raw, err = issueRefreshToken(tx, session.ID)
+		return err
+	})
+	return session, raw, err
+}
+
+func issueRefreshToken(tx *gorm.DB, sessionID uint) (string, error) {
+	raw, err := GenerateRandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	rt := models.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: HashToken(raw),
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	if err := tx.Create(&rt).Error; err != nil {
+		return "", err
+	}
+	return raw, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one. Presenting a
+// token that was already rotated revokes the whole session, since it means
+// the token was copied.
+func RotateRefreshToken(raw, ip string) (models.Session, string, error) {
+	var session models.Session
+	var next string
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var rt models.RefreshToken
+		if err := tx.Where("token_hash = ?", HashToken(raw)).First(&rt).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+		if err := tx.First(&session, rt.SessionID).Error; err != nil {
+			return ErrInvalidRefreshToken
+		}
+
+		now := time.Now()
+		if session.RevokedAt != nil || now.After(session.ExpiresAt) || now.After(rt.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+		if rt.UsedAt != nil {
+			return ErrRefreshTokenReused
+		}
+
+		res := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", rt.ID).
+			Update("used_at", now)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		var err error
+		next, err = issueRefreshToken(tx, session.ID)
+		return err
+	})
+
+	// Revoke outside the transaction, which has been rolled back by now.
+	if errors.Is(err, ErrRefreshTokenReused) {
+		RevokeSession(session.ID)
+	}
+	if err == nil {
+		touchSession(session, ip)
+	}
+	return session, next, err
+}
+
+// RevokeSession marks a session revoked so its refresh tokens and access
+// tokens stop working.
+func RevokeSession(sessionID uint) error {
+	return database.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserSessions revokes all of a user's sessions except the one given,
+// which may be 0, and returns how many were revoked.
+func RevokeUserSessions(userID, exceptID uint) (int64, error) {
+	res := database.DB.Model(&models.Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, exceptID).
+		Update("revoked_at", time.Now())
+	return res.RowsAffected, res.Error
+}
+
+// ActiveSessions lists the user's sessions that can still be used, most
+// recently seen first.
+func ActiveSessions(userID uint) []models.Session {
+	var sessions []models.Session
+	database.DB.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").Find(&sessions)
+	return sessions
+}
+
+// TouchSession reports whether the session exists, is not revoked and has
+// not expired, and records that it was just used from ip.
+func TouchSession(sessionID uint, ip string) bool {
+	var session models.Session
+	if err := database.DB.First(&session, sessionID).Error; err != nil {
+		return false
+	}
+	if session.RevokedAt != nil || !time.Now().Before(session.ExpiresAt) {
+		return false
+	}
+	touchSession(session, ip)
+	return true
+}
+
+func touchSession(session models.Session, ip string) {
+	if session.IP == ip && time.Since(session.LastSeenAt) < sessionTouchInterval {
+		return
+	}
+	database.DB.Model(&session).UpdateColumns(map[string]interface{}{
+		"ip":           ip,
+		"last_seen_at": time.Now(),
+	})
+}
+
+// DeviceLabel turns a user agent into a short description such as
+// "Chrome on macOS" for session listings.
+func DeviceLabel(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return "Unknown"
+	}
+	if strings.HasPrefix(ua, "go-http-client") || strings.HasPrefix(ua, "ks/") {
+		return "ks CLI"
+	}
+
+	browser := "Browser"
+	for _, b := range []struct{ token, name string }{
+		{"edg/", "Edge"}, {"firefox/", "Firefox"}, {"chrome/", "Chrome"}, {"safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	for _, o := range []struct{ token, name string }{
+		{"android", "Android"}, {"iphone", "iOS"}, {"ipad", "iOS"}, {"mac os", "macOS"},
+		{"windows", "Windows"}, {"linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			return browser + " on " + o.name
+		}
+	}
+	return browser
+}
+
+// RevokeToken adds an access token's JWT ID to the revocation list.
+func RevokeToken(jti string, expiresAt time.Time) error {
+	if jti == "" {
+		return nil
+	}
+	return database.DB.Create(&models.RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+}
+
+func IsTokenRevoked(jti string) bool {
+	var count int64
+	database.DB.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count)
+	return count > 0
+}
+
+// StartJanitor periodically purges revocation entries and refresh tokens
+// that have expired on their own, then runs any extra cleanup tasks.
+func StartJanitor(interval time.Duration, tasks ...func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			now := time.Now()
+			if err := database.DB.Where("expires_at < ?", now).Delete(&models.RevokedToken{}).Error; err != nil {
+				log.Println("Failed to purge revoked tokens:", err)
+			}
+			if err := database.DB.Where("expires_at < ?", now).Delete(&models.RefreshToken{}).Error; err != nil {
+				log.Println("Failed to purge refresh tokens:", err)
+			}
+			for _, task := range tasks {
+				if err := task(); err != nil {
+					log.Println("Cleanup task failed:", err)
+				}
+			}
+		}
+	}()
+}
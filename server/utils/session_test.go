@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"errors"
+	"kubeswitch/server/database"
+	"kubeswitch/server/internal/testutil"
+	"kubeswitch/server/models"
+	"testing"
+	"time"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	testutil.SetupDB(t)
+	session, token, err := CreateSession(1, "10.0.0.1", "ks/1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		rotated, next, err := RotateRefreshToken(token, "10.0.0.1")
+		if err != nil {
+			t.Fatalf("rotation %d: %v", i+1, err)
+		}
+		if rotated.ID != session.ID || next == "" || next == token {
+			t.Fatalf("rotation %d returned session %d, token %q", i+1, rotated.ID, next)
+		}
+		token = next
+	}
+	if _, _, err := RotateRefreshToken("not-a-token", "10.0.0.1"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown token: got %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRefreshTokenReuseRevokesSession(t *testing.T) {
+	testutil.SetupDB(t)
+	session, stolen, err := CreateSession(1, "10.0.0.1", "ks/1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, current, err := RotateRefreshToken(stolen, "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Whoever copied the first token presents it after the owner rotated it.
+	reused, _, err := RotateRefreshToken(stolen, "203.0.113.9")
+	if !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reused token: got %v, want ErrRefreshTokenReused", err)
+	}
+	if reused.ID != session.ID {
+		t.Errorf("reuse reported session %d, want %d", reused.ID, session.ID)
+	}
+
+	var stored models.Session
+	database.DB.First(&stored, session.ID)
+	if stored.RevokedAt == nil {
+		t.Fatal("session was not revoked after reuse")
+	}
+	if TouchSession(session.ID, "10.0.0.1") {
+		t.Error("access tokens of the revoked session are still accepted")
+	}
+	if _, _, err := RotateRefreshToken(current, "10.0.0.1"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("latest token after reuse: got %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	testutil.SetupDB(t)
+	var ids []uint
+	for i := 0; i < 3; i++ {
+		session, _, err := CreateSession(1, "10.0.0.1", "ks/1.0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, session.ID)
+	}
+	other, otherToken, _ := CreateSession(2, "10.0.0.2", "ks/1.0")
+
+	if err := RevokeSession(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := RevokeUserSessions(1, ids[1])
+	if err != nil || revoked != 1 {
+		t.Fatalf("revoked %d sessions, %v; want only the one not yet revoked", revoked, err)
+	}
+	active := ActiveSessions(1)
+	if len(active) != 1 || active[0].ID != ids[1] {
+		t.Errorf("active sessions %v, want only the kept one", active)
+	}
+	for _, id := range []uint{ids[0], ids[2]} {
+		if TouchSession(id, "10.0.0.1") {
+			t.Errorf("revoked session %d is still accepted", id)
+		}
+	}
+
+	if !TouchSession(other.ID, "10.0.0.2") || len(ActiveSessions(2)) != 1 {
+		t.Error("another user's session was revoked")
+	}
+	if _, _, err := RotateRefreshToken(otherToken, "10.0.0.2"); err != nil {
+		t.Errorf("another user's refresh token: %v", err)
+	}
+}
+
+func TestTouchSession(t *testing.T) {
+	testutil.SetupDB(t)
+	session, _, err := CreateSession(1, "10.0.0.1", "ks/1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastSeen := func() models.Session {
+		var stored models.Session
+		database.DB.First(&stored, session.ID)
+		return stored
+	}
+
+	// Within the touch interval from the same address nothing is written
+	earlier := time.Now().Add(-sessionTouchInterval / 2).Truncate(time.Second)
+	database.DB.Model(&session).UpdateColumn("last_seen_at", earlier)
+	if !TouchSession(session.ID, "10.0.0.1") {
+		t.Fatal("active session rejected")
+	}
+	if stored := lastSeen(); !stored.LastSeenAt.Equal(earlier) {
+		t.Errorf("last_seen_at moved to %v within the touch interval", stored.LastSeenAt)
+	}
+
+	// A new address is recorded straight away
+	if !TouchSession(session.ID, "10.0.0.9") {
+		t.Fatal("active session rejected")
+	}
+	if stored := lastSeen(); stored.IP != "10.0.0.9" || !stored.LastSeenAt.After(earlier) {
+		t.Errorf("session after touch from a new address: ip %s, last seen %v", stored.IP, stored.LastSeenAt)
+	}
+
+	database.DB.Model(&session).UpdateColumn("expires_at", time.Now().Add(-time.Second))
+	if TouchSession(session.ID, "10.0.0.9") {
+		t.Error("expired session is still accepted")
+	}
+	if TouchSession(session.ID+1, "10.0.0.9") {
+		t.Error("unknown session is accepted")
+	}
+}
+
+func TestRotateExpiredRefreshToken(t *testing.T) {
+	testutil.SetupDB(t)
+	session, token, err := CreateSession(1, "10.0.0.1", "ks/1.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	database.DB.Model(&models.RefreshToken{}).Where("session_id = ?", session.ID).
+		UpdateColumn("expires_at", time.Now().Add(-time.Second))
+	if _, _, err := RotateRefreshToken(token, "10.0.0.1"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("expired token: got %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestDeviceLabel(t *testing.T) {
+	for userAgent, want := range map[string]string{
+		"":                       "Unknown",
+		"ks/1.4.0 (linux/amd64)": "ks CLI",
+		"Go-http-client/1.1":     "ks CLI",
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0 Safari/537.36": "Chrome on macOS",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36 Edg/120.0":              "Edge on Windows",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Version/17.0 Mobile Safari/604.1":   "Safari on iOS",
+		"curl/8.4.0": "curl",
+	} {
+		if got := DeviceLabel(userAgent); got != want {
+			t.Errorf("DeviceLabel(%q) = %q, want %q", userAgent, got, want)
+		}
+	}
+}
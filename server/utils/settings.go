@@ -0,0 +1,35 @@
+package utils
+
+import (
+	"kubeswitch/server/database"
+	"kubeswitch/server/models"
+	"strconv"
+)
+
+const SettingMFARequiredForAdmins = "mfa_required_for_admins"
+
+// MFARequired reports whether the MFA policy applies to users with the named
+// role. The policy covers every role that grants any capability.
+func MFARequired(role string) bool {
+	return len(RoleCapabilities(role)) > 0 && GetBoolSetting(SettingMFARequiredForAdmins, false)
+}
+
+func GetSetting(key, defaultValue string) string {
+	var setting models.Setting
+	if err := database.DB.First(&setting, "key = ?", key).Error; err != nil {
+		return defaultValue
+	}
+	return setting.Value
+}
+
+func SetSetting(key, value string) error {
+	return database.DB.Save(&models.Setting{Key: key, Value: value}).Error
+}
+
+func GetBoolSetting(key string, defaultValue bool) bool {
+	v, err := strconv.ParseBool(GetSetting(key, strconv.FormatBool(defaultValue)))
+	if err != nil {
+		return defaultValue
+	}
+	return v
+}
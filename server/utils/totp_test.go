@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed from RFC 6238 appendix B.
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+// TestTOTPRFC6238Vectors checks the SHA-1 test vectors of RFC 6238, whose
+// 8-digit codes end in the 6 digits authenticator apps show.
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},          // 94287082
+		{1111111109, "081804"},  // 07081804
+		{1111111111, "050471"},  // 14050471
+		{1234567890, "005924"},  // 89005924
+		{2000000000, "279037"},  // 69279037
+		{20000000000, "353130"}, // 65353130
+	}
+	for _, v := range vectors {
+		step, ok := ValidateTOTP(rfc6238Secret, v.code, time.Unix(v.unix, 0))
+		if !ok || step != v.unix/totpPeriod {
+			t.Errorf("T=%d code %s: got step %d, %v", v.unix, v.code, step, ok)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	const code = "005924" // Valid at T=1234567890
+	at := time.Unix(1234567890, 0)
+
+	for _, drift := range []time.Duration{-30 * time.Second, 30 * time.Second} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, at.Add(drift)); !ok {
+			t.Errorf("rejected with %v clock drift", drift)
+		}
+	}
+	for _, drift := range []time.Duration{-90 * time.Second, 90 * time.Second} {
+		if _, ok := ValidateTOTP(rfc6238Secret, code, at.Add(drift)); ok {
+			t.Errorf("accepted %v outside the window", drift)
+		}
+	}
+	for _, bad := range []string{"", "00592", "0059240", "005925"} {
+		if _, ok := ValidateTOTP(rfc6238Secret, bad, at); ok {
+			t.Errorf("accepted %q", bad)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", code, at); ok {
+		t.Error("accepted an invalid secret")
+	}
+}
@@ -0,0 +1,46 @@
+import apiClient from './client'
+import type { AccessRequest, AccessRequestStatus, CreateAccessRequestDto } from '@/types'
+
+/**
+ * 临时访问申请相关 API
+ */
+export const accessRequestsApi = {
+  /**
+   * 获取访问申请（管理员获取全部，普通用户只获取自己的）
+   */
+  getAccessRequests: async (params?: { status?: AccessRequestStatus; mine?: boolean }): Promise<AccessRequest[]> => {
+    const response = await apiClient.get<AccessRequest[]>('/access-requests', { params })
+    return response.data
+  },
+
+  /**
+   * 申请访问集群
+   */
+  createAccessRequest: async (data: CreateAccessRequestDto): Promise<AccessRequest> => {
+    const response = await apiClient.post<AccessRequest>('/access-requests', data)
+    return response.data
+  },
+
+  /**
+   * 批准申请
+   */
+  approve: async (id: number, note?: string): Promise<AccessRequest> => {
+    const response = await apiClient.post<AccessRequest>(`/access-requests/${id}/approve`, { note })
+    return response.data
+  },
+
+  /**
+   * 拒绝申请
+   */
+  deny: async (id: number, note?: string): Promise<AccessRequest> => {
+    const response = await apiClient.post<AccessRequest>(`/access-requests/${id}/deny`, { note })
+    return response.data
+  },
+
+  /**
+   * 撤回自己的待审批申请
+   */
+  cancel: async (id: number): Promise<void> => {
+    await apiClient.delete(`/access-requests/${id}`)
+  }
+}
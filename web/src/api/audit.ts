@@ -8,8 +8,8 @@ export const auditApi = {
   /**
    * 获取审计日志列表
    */
-  getAuditLogs: async (): Promise<AuditLog[]> => {
-    const response = await apiClient.get<AuditLog[]>('/audit')
+  getAuditLogs: async (params?: { severity?: string }): Promise<AuditLog[]> => {
+    const response = await apiClient.get<AuditLog[]>('/audit', { params })
     return response.data
   }
 }
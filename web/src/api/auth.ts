@@ -1,5 +1,15 @@
 import apiClient from './client'
-import type { LoginDto, LoginResponse, User } from '@/types'
+import type {
+  AuthConfig,
+  DeviceCode,
+  LoginDto,
+  LoginResponse,
+  MfaChallenge,
+  MfaEnrollment,
+  PasswordPolicy,
+  Session,
+  User
+} from '@/types'
 
 /**
  * 认证相关 API
@@ -8,11 +18,90 @@ export const authApi = {
   /**
    * 用户登录
    */
-  login: async (data: LoginDto): Promise<LoginResponse> => {
-    const response = await apiClient.post<LoginResponse>('/login', data)
+  login: async (data: LoginDto): Promise<LoginResponse | MfaChallenge> => {
+    const response = await apiClient.post<LoginResponse | MfaChallenge>('/login', data)
     return response.data
   },
 
+  /**
+   * 提交 MFA 验证码完成登录
+   */
+  loginMfa: async (data: { mfa_token: string; code: string }): Promise<LoginResponse> => {
+    const response = await apiClient.post<LoginResponse>('/login/mfa', data)
+    return response.data
+  },
+
+  /**
+   * 使用认证代理传递的身份登录
+   */
+  loginProxy: async (): Promise<LoginResponse> => {
+    const response = await apiClient.post<LoginResponse>('/login/proxy')
+    return response.data
+  },
+
+  /**
+   * 登录过程中开始 MFA 绑定（策略要求但尚未绑定时），需要管理员发放的绑定令牌
+   */
+  enrollMfa: async (mfaToken: string, enrollmentToken: string): Promise<MfaEnrollment> => {
+    const response = await apiClient.post<MfaEnrollment>('/login/mfa/enroll', {
+      mfa_token: mfaToken,
+      enrollment_token: enrollmentToken
+    })
+    return response.data
+  },
+
+  /**
+   * 获取可用的登录方式
+   */
+  getAuthConfig: async (): Promise<AuthConfig> => {
+    const response = await apiClient.get<AuthConfig>('/auth/config')
+    return response.data
+  },
+
+  /**
+   * SSO 登录入口地址（浏览器跳转）
+   */
+  oidcLoginUrl: (): string => {
+    return `${apiClient.defaults.baseURL}/oidc/login`
+  },
+
+  /**
+   * 获取当前用户的活动会话
+   */
+  getMySessions: async (): Promise<Session[]> => {
+    const response = await apiClient.get<Session[]>('/my/sessions')
+    return response.data
+  },
+
+  /**
+   * 注销当前用户的某个会话
+   */
+  revokeMySession: async (id: number): Promise<void> => {
+    await apiClient.delete(`/my/sessions/${id}`)
+  },
+
+  /**
+   * 注销当前会话以外的所有会话
+   */
+  revokeOtherSessions: async (): Promise<void> => {
+    await apiClient.delete('/my/sessions')
+  },
+
+  /**
+   * 查询 CLI 设备登录请求
+   */
+  getDeviceCode: async (userCode: string): Promise<DeviceCode> => {
+    const response = await apiClient.get<DeviceCode>(`/my/device/${encodeURIComponent(userCode)}`)
+    return response.data
+  },
+
+  /**
+   * 批准或拒绝 CLI 设备登录请求
+   */
+  approveDevice: async (userCode: string, approve: boolean): Promise<void> => {
+    await apiClient.post('/my/device', { user_code: userCode, approve })
+  },
+
   /**
    * 用户登出
    */
@@ -29,9 +118,18 @@ export const authApi = {
   },
 
   /**
-   * 修改当前用户密码
+   * 修改当前用户密码，返回替换当前会话的新令牌
    */
-  updateMyPassword: async (data: { old_password: string; new_password: string }): Promise<void> => {
-    await apiClient.post('/my/password', data)
+  updateMyPassword: async (data: { old_password: string; new_password: string }): Promise<{ token?: string }> => {
+    const response = await apiClient.post<{ token?: string }>('/my/password', data)
+    return response.data
+  },
+
+  /**
+   * 获取密码策略
+   */
+  getPasswordPolicy: async (): Promise<PasswordPolicy> => {
+    const response = await apiClient.get<PasswordPolicy>('/password-policy')
+    return response.data
   }
 }
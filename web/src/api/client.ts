@@ -1,6 +1,7 @@
 import axios, { type AxiosInstance, type AxiosError, type InternalAxiosRequestConfig } from 'axios'
 import { message } from 'ant-design-vue'
-import { getToken, clearAuth } from '@/utils/token'
+import { getToken, setToken, getRefreshToken, setRefreshToken, clearAuth } from '@/utils/token'
+import type { LoginResponse } from '@/types'
 
 // 创建 Axios 实例
 const apiClient: AxiosInstance = axios.create({
@@ -26,13 +27,50 @@ apiClient.interceptors.request.use(
   }
 )
 
+// 刷新中的请求，保证并发 401 只触发一次刷新
+let refreshPromise: Promise<string> | null = null
+
+const refreshAccessToken = (): Promise<string> => {
+  if (!refreshPromise) {
+    const refreshToken = getRefreshToken()
+    refreshPromise = (refreshToken
+      ? axios
+          .post<LoginResponse>(`${apiClient.defaults.baseURL}/refresh`, { refresh_token: refreshToken })
+          .then(({ data }) => {
+            setToken(data.token)
+            setRefreshToken(data.refresh_token)
+            return data.token
+          })
+      : Promise.reject(new Error('No refresh token'))
+    ).finally(() => {
+      refreshPromise = null
+    })
+  }
+  return refreshPromise
+}
+
 // 响应拦截器 - 处理错误
 apiClient.interceptors.response.use(
   (response) => {
     return response
   },
-  (error: AxiosError) => {
-    const { response } = error
+  async (error: AxiosError) => {
+    const { response, config } = error
+    // 登录接口本身的 401 表示凭证错误，而不是会话过期
+    const isLoginRequest = !!config?.url?.startsWith('/login')
+
+    // 访问令牌过期时使用刷新令牌换取新令牌并重试一次
+    const retryConfig = config as (InternalAxiosRequestConfig & { _retried?: boolean }) | undefined
+    if (response?.status === 401 && retryConfig && !retryConfig._retried && !isLoginRequest) {
+      retryConfig._retried = true
+      try {
+        const token = await refreshAccessToken()
+        retryConfig.headers.Authorization = `Bearer ${token}`
+        return apiClient(retryConfig)
+      } catch {
+        // 刷新失败，按登录过期处理
+      }
+    }
 
     // 网络错误
     if (!response) {
@@ -50,8 +88,8 @@ apiClient.interceptors.response.use(
             Object.keys(data.errors).forEach(key => {
               message.error(`${key}: ${data.errors[key]}`)
             })
-          } else if (data.message) {
-            message.error(data.message)
+          } else if (data.message || data.error) {
+            message.error(data.message || data.error)
           } else {
             message.error('请求参数错误')
           }
@@ -61,6 +99,11 @@ apiClient.interceptors.response.use(
         break
 
       case 401:
+        if (isLoginRequest) {
+          const data = response.data as any
+          message.error(data?.error || '用户名或密码错误')
+          break
+        }
         // 清除认证信息并重定向到登录页
         message.error('登录已过期，请重新登录')
         clearAuth()
@@ -71,6 +114,11 @@ apiClient.interceptors.response.use(
         break
 
       case 403:
+        if ((response.data as any)?.password_change_required) {
+          message.error('请先修改密码')
+          window.location.href = '/login'
+          break
+        }
         message.error('您没有权限执行此操作')
         break
 
@@ -78,6 +126,10 @@ apiClient.interceptors.response.use(
         message.error('请求的资源不存在')
         break
 
+      case 429:
+        message.error((response.data as any)?.error || '尝试次数过多，请稍后再试')
+        break
+
       case 500:
         message.error('服务器错误，请稍后重试')
         break
@@ -1,11 +1,17 @@
 import apiClient from './client'
 import type {
+  AccessLevel,
   Cluster,
   CreateClusterDto,
   KubeconfigResponse,
   ImportKubeconfigDto,
+  ClusterOwners,
+  BreakGlassDto,
+  BreakGlassResponse,
+  AuditLog,
   ClusterPermissionsResponse,
-  UpdateClusterPermissionsDto
+  UpdateClusterPermissionsDto,
+  PermissionGrant
 } from '@/types'
 
 /**
@@ -15,8 +21,10 @@ export const clustersApi = {
   /**
    * 获取集群列表
    */
-  getClusters: async (): Promise<Cluster[]> => {
-    const response = await apiClient.get<Cluster[]>('/clusters')
+  getClusters: async (selector?: string): Promise<Cluster[]> => {
+    const response = await apiClient.get<Cluster[]>('/clusters', {
+      params: selector ? { selector } : undefined
+    })
     return response.data
   },
 
@@ -28,6 +36,22 @@ export const clustersApi = {
     return response.data
   },
 
+  /**
+   * 设置集群标签
+   */
+  setLabels: async (id: number, labels: Record<string, string>): Promise<Cluster> => {
+    const response = await apiClient.post<Cluster>(`/clusters/${id}/labels`, { labels })
+    return response.data
+  },
+
+  /**
+   * 设置允许下载 kubeconfig 的来源 IP 白名单
+   */
+  setAllowlist: async (id: number, allowedCidrs: string[]): Promise<Cluster> => {
+    const response = await apiClient.post<Cluster>(`/clusters/${id}/allowlist`, { allowed_cidrs: allowedCidrs })
+    return response.data
+  },
+
   /**
    * 删除集群
    */
@@ -43,6 +67,13 @@ export const clustersApi = {
     return response.data.kubeconfig
   },
 
+  /**
+   * 删除 view/edit 级别的 Kubeconfig
+   */
+  deleteKubeconfig: async (id: number, level: AccessLevel): Promise<void> => {
+    await apiClient.delete(`/clusters/${id}/credentials/${level}`)
+  },
+
   /**
    * 导入 Kubeconfig
    */
@@ -50,6 +81,37 @@ export const clustersApi = {
     await apiClient.post(`/clusters/${id}/import`, data)
   },
 
+  /**
+   * 紧急访问（break-glass）
+   */
+  breakGlass: async (id: number, data: BreakGlassDto): Promise<BreakGlassResponse> => {
+    const response = await apiClient.post<BreakGlassResponse>(`/clusters/${id}/break-glass`, data)
+    return response.data
+  },
+
+  /**
+   * 获取集群负责人
+   */
+  getOwners: async (id: number): Promise<ClusterOwners> => {
+    const response = await apiClient.get<ClusterOwners>(`/clusters/${id}/owners`)
+    return response.data
+  },
+
+  /**
+   * 设置集群负责人
+   */
+  setOwners: async (id: number, owners: ClusterOwners): Promise<void> => {
+    await apiClient.post(`/clusters/${id}/owners`, owners)
+  },
+
+  /**
+   * 获取集群的审计日志
+   */
+  getAuditLogs: async (id: number): Promise<AuditLog[]> => {
+    const response = await apiClient.get<AuditLog[]>(`/clusters/${id}/audit`)
+    return response.data
+  },
+
   /**
    * 获取集群权限（哪些用户可以访问）
    */
@@ -58,6 +120,14 @@ export const clustersApi = {
     return response.data.user_ids || []
   },
 
+  /**
+   * 获取集群的授权及有效期
+   */
+  getClusterGrants: async (id: number): Promise<PermissionGrant[]> => {
+    const response = await apiClient.get<ClusterPermissionsResponse>(`/clusters/${id}/permissions`)
+    return response.data.grants || []
+  },
+
   /**
    * 更新集群权限
    */
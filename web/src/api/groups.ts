@@ -0,0 +1,99 @@
+import apiClient from './client'
+import type {
+  Group,
+  GroupDto,
+  GroupGrant,
+  GroupMembersResponse,
+  GroupPermissionsResponse,
+  LabelGrant,
+  LabelPermissionsResponse
+} from '@/types'
+
+/**
+ * 用户组相关 API（管理员）
+ */
+export const groupsApi = {
+  /**
+   * 获取用户组列表
+   */
+  getGroups: async (): Promise<Group[]> => {
+    const response = await apiClient.get<Group[]>('/groups')
+    return response.data
+  },
+
+  /**
+   * 创建用户组
+   */
+  createGroup: async (data: GroupDto): Promise<Group> => {
+    const response = await apiClient.post<Group>('/groups', data)
+    return response.data
+  },
+
+  /**
+   * 修改用户组名称和描述
+   */
+  updateGroup: async (id: number, data: GroupDto): Promise<Group> => {
+    const response = await apiClient.post<Group>(`/groups/${id}`, data)
+    return response.data
+  },
+
+  /**
+   * 删除用户组
+   */
+  deleteGroup: async (id: number): Promise<void> => {
+    await apiClient.delete(`/groups/${id}`)
+  },
+
+  /**
+   * 获取组成员
+   */
+  getMembers: async (id: number): Promise<number[]> => {
+    const response = await apiClient.get<GroupMembersResponse>(`/groups/${id}/members`)
+    return response.data.user_ids || []
+  },
+
+  /**
+   * 设置组成员
+   */
+  setMembers: async (id: number, userIds: number[]): Promise<void> => {
+    await apiClient.post(`/groups/${id}/members`, { user_ids: userIds })
+  },
+
+  /**
+   * 获取组的集群权限
+   */
+  getPermissions: async (id: number): Promise<GroupGrant[]> => {
+    const response = await apiClient.get<GroupPermissionsResponse>(`/groups/${id}/permissions`)
+    return response.data.grants || []
+  },
+
+  /**
+   * 设置组的集群权限
+   */
+  setPermissions: async (id: number, grants: GroupGrant[]): Promise<void> => {
+    await apiClient.post(`/groups/${id}/permissions`, { grants })
+  },
+
+  /**
+   * 获取组的标签选择器授权
+   */
+  getLabelGrants: async (id: number): Promise<LabelGrant[]> => {
+    const response = await apiClient.get<LabelPermissionsResponse>(`/groups/${id}/label-permissions`)
+    return response.data.grants || []
+  },
+
+  /**
+   * 设置组的标签选择器授权
+   */
+  setLabelGrants: async (id: number, grants: LabelGrant[]): Promise<void> => {
+    await apiClient.post(`/groups/${id}/label-permissions`, { grants })
+  },
+
+  /**
+   * 设置用户组的来源 IP 白名单，对所有成员生效
+   */
+  setAllowlist: async (id: number, allowedCidrs: string[]): Promise<Group> => {
+    const response = await apiClient.post<Group>(`/groups/${id}/allowlist`, { allowed_cidrs: allowedCidrs })
+    return response.data
+  }
+}
@@ -3,3 +3,8 @@ export * from './auth'
 export * from './clusters'
 export * from './users'
 export * from './audit'
+export * from './serviceAccounts'
+export * from './groups'
+export * from './accessRequests'
+export * from './roles'
+export * from './policies'
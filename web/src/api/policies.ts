@@ -0,0 +1,46 @@
+import apiClient from './client'
+import type { Policy, PolicyDto, EvaluatePolicyDto, PolicyDecision } from '@/types'
+
+/**
+ * 访问策略相关 API
+ */
+export const policiesApi = {
+  /**
+   * 获取策略列表
+   */
+  getPolicies: async (): Promise<Policy[]> => {
+    const response = await apiClient.get<Policy[]>('/policies')
+    return response.data
+  },
+
+  /**
+   * 创建策略
+   */
+  createPolicy: async (data: PolicyDto): Promise<Policy> => {
+    const response = await apiClient.post<Policy>('/policies', data)
+    return response.data
+  },
+
+  /**
+   * 修改策略
+   */
+  updatePolicy: async (id: number, data: PolicyDto): Promise<Policy> => {
+    const response = await apiClient.post<Policy>(`/policies/${id}`, data)
+    return response.data
+  },
+
+  /**
+   * 删除策略
+   */
+  deletePolicy: async (id: number): Promise<void> => {
+    await apiClient.delete(`/policies/${id}`)
+  },
+
+  /**
+   * 试运行：评估策略对某个假设请求的决定
+   */
+  evaluate: async (data: EvaluatePolicyDto): Promise<PolicyDecision> => {
+    const response = await apiClient.post<PolicyDecision>('/policies/evaluate', data)
+    return response.data
+  }
+}
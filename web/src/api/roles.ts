@@ -0,0 +1,46 @@
+import apiClient from './client'
+import type { Capability, Role, RoleDto } from '@/types'
+
+/**
+ * 角色相关 API
+ */
+export const rolesApi = {
+  /**
+   * 获取角色列表
+   */
+  getRoles: async (): Promise<Role[]> => {
+    const response = await apiClient.get<Role[]>('/roles')
+    return response.data
+  },
+
+  /**
+   * 获取可分配的全部能力
+   */
+  getCapabilities: async (): Promise<Capability[]> => {
+    const response = await apiClient.get<Capability[]>('/capabilities')
+    return response.data
+  },
+
+  /**
+   * 创建角色
+   */
+  createRole: async (data: RoleDto): Promise<Role> => {
+    const response = await apiClient.post<Role>('/roles', data)
+    return response.data
+  },
+
+  /**
+   * 修改角色描述和能力（角色不能改名）
+   */
+  updateRole: async (id: number, data: RoleDto): Promise<Role> => {
+    const response = await apiClient.post<Role>(`/roles/${id}`, data)
+    return response.data
+  },
+
+  /**
+   * 删除角色
+   */
+  deleteRole: async (id: number): Promise<void> => {
+    await apiClient.delete(`/roles/${id}`)
+  }
+}
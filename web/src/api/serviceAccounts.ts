@@ -0,0 +1,68 @@
+import apiClient from './client'
+import type { ApiToken, CreateApiTokenDto, CreateServiceAccountDto, ServiceAccountOwnersDto, User } from '@/types'
+
+/**
+ * 服务账号相关 API
+ */
+export const serviceAccountsApi = {
+  /**
+   * 获取所有服务账号（管理员）
+   */
+  getServiceAccounts: async (): Promise<User[]> => {
+    const response = await apiClient.get<User[]>('/service-accounts')
+    return response.data
+  },
+
+  /**
+   * 获取当前用户负责的服务账号
+   */
+  getMyServiceAccounts: async (): Promise<User[]> => {
+    const response = await apiClient.get<User[]>('/my/service-accounts')
+    return response.data
+  },
+
+  /**
+   * 创建服务账号（管理员）
+   */
+  createServiceAccount: async (data: CreateServiceAccountDto): Promise<User> => {
+    const response = await apiClient.post<User>('/service-accounts', data)
+    return response.data
+  },
+
+  /**
+   * 修改服务账号负责人和负责用户组（管理员）
+   */
+  setOwner: async (id: number, owners: ServiceAccountOwnersDto): Promise<void> => {
+    await apiClient.post(`/service-accounts/${id}/owner`, owners)
+  },
+
+  /**
+   * 删除服务账号（管理员）
+   */
+  deleteServiceAccount: async (id: number): Promise<void> => {
+    await apiClient.delete(`/service-accounts/${id}`)
+  },
+
+  /**
+   * 获取服务账号的令牌
+   */
+  getTokens: async (id: number): Promise<ApiToken[]> => {
+    const response = await apiClient.get<ApiToken[]>(`/service-accounts/${id}/tokens`)
+    return response.data
+  },
+
+  /**
+   * 创建服务账号令牌，返回只显示一次的明文令牌
+   */
+  createToken: async (id: number, data: CreateApiTokenDto): Promise<{ token: string; api_token: ApiToken }> => {
+    const response = await apiClient.post<{ token: string; api_token: ApiToken }>(`/service-accounts/${id}/tokens`, data)
+    return response.data
+  },
+
+  /**
+   * 吊销服务账号令牌
+   */
+  deleteToken: async (id: number, tokenId: number): Promise<void> => {
+    await apiClient.delete(`/service-accounts/${id}/tokens/${tokenId}`)
+  }
+}
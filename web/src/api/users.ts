@@ -4,7 +4,11 @@ import type {
   CreateUserDto,
   UpdateUserRoleDto,
   UserPermissionsResponse,
-  UpdateUserPermissionsDto
+  UpdateUserPermissionsDto,
+  PermissionGrant,
+  LabelGrant,
+  LabelPermissionsResponse,
+  Session
 } from '@/types'
 
 /**
@@ -48,6 +52,28 @@ export const usersApi = {
     await apiClient.post(`/users/${id}/role`, data)
   },
 
+  /**
+   * 获取用户的活动会话
+   */
+  getUserSessions: async (id: number): Promise<Session[]> => {
+    const response = await apiClient.get<Session[]>(`/users/${id}/sessions`)
+    return response.data
+  },
+
+  /**
+   * 注销用户的某个会话
+   */
+  revokeUserSession: async (id: number, sessionId: number): Promise<void> => {
+    await apiClient.delete(`/users/${id}/sessions/${sessionId}`)
+  },
+
+  /**
+   * 注销用户的所有会话
+   */
+  revokeUserSessions: async (id: number): Promise<void> => {
+    await apiClient.delete(`/users/${id}/sessions`)
+  },
+
   /**
    * 获取用户权限（用户可以访问哪些集群）
    */
@@ -56,10 +82,41 @@ export const usersApi = {
     return response.data.cluster_ids || []
   },
 
+  /**
+   * 获取用户的授权及有效期
+   */
+  getUserGrants: async (id: number): Promise<PermissionGrant[]> => {
+    const response = await apiClient.get<UserPermissionsResponse>(`/users/${id}/permissions`)
+    return response.data.grants || []
+  },
+
   /**
    * 更新用户权限
    */
   updateUserPermissions: async (id: number, data: UpdateUserPermissionsDto): Promise<void> => {
     await apiClient.post(`/users/${id}/permissions`, data)
+  },
+
+  /**
+   * 获取用户的标签选择器授权
+   */
+  getLabelGrants: async (id: number): Promise<LabelGrant[]> => {
+    const response = await apiClient.get<LabelPermissionsResponse>(`/users/${id}/label-permissions`)
+    return response.data.grants || []
+  },
+
+  /**
+   * 设置用户的标签选择器授权
+   */
+  setLabelGrants: async (id: number, grants: LabelGrant[]): Promise<void> => {
+    await apiClient.post(`/users/${id}/label-permissions`, { grants })
+  },
+
+  /**
+   * 设置用户的来源 IP 白名单
+   */
+  setAllowlist: async (id: number, allowedCidrs: string[]): Promise<User> => {
+    const response = await apiClient.post<User>(`/users/${id}/allowlist`, { allowed_cidrs: allowedCidrs })
+    return response.data
   }
 }
@@ -16,9 +16,22 @@ export function useAuth() {
   const currentUser = computed(() => authStore.currentUser)
 
   // 登录
+  // 返回 MFA 挑战或需要修改密码时由调用方继续下一步
   const login = async (credentials: LoginDto) => {
-    await authStore.login(credentials)
-    // 登录成功后跳转
+    const challenge = await authStore.login(credentials)
+    if (!challenge && !authStore.passwordChangeRequired) {
+      redirectAfterLogin()
+    }
+    return challenge
+  }
+
+  // 提交验证码，返回首次绑定时生成的恢复码
+  const completeMfa = async (mfaToken: string, code: string) => {
+    return authStore.completeMfa(mfaToken, code)
+  }
+
+  // 登录成功后跳转
+  const redirectAfterLogin = () => {
     const redirect = router.currentRoute.value.query.redirect as string
     router.push(redirect || '/')
   }
@@ -46,6 +59,8 @@ export function useAuth() {
     currentUser,
     // 方法
     login,
+    completeMfa,
+    redirectAfterLogin,
     logout,
     refreshUser,
     updatePassword
@@ -1,57 +1,70 @@
 import { computed } from 'vue'
 import { useAuthStore } from '@/stores'
+import { Capability } from '@/types'
 
 /**
- * 权限检查相关的组合式函数
+ * 权限检查相关的组合式函数，基于当前角色的能力
  */
 export function usePermission() {
   const authStore = useAuthStore()
 
-  // 是否可以管理集群
-  const canManageClusters = computed(() => authStore.isAdmin)
+  const can = (capability: Capability) => computed(() => authStore.hasCapability(capability))
+
+  // 是否可以添加/删除集群
+  const canCreateClusters = can(Capability.CLUSTERS_CREATE)
+  const canDeleteClusters = can(Capability.CLUSTERS_DELETE)
+
+  // 是否可以导入 kubeconfig
+  const canImportKubeconfig = can(Capability.KUBECONFIG_IMPORT)
 
   // 是否可以管理用户
-  const canManageUsers = computed(() => authStore.isAdmin)
+  const canManageUsers = can(Capability.USERS_MANAGE)
+
+  // 是否可以管理角色
+  const canManageRoles = can(Capability.ROLES_MANAGE)
+
+  // 是否可以管理用户组
+  const canManageGroups = can(Capability.GROUPS_MANAGE)
+
+  // 是否可以管理所有服务账号
+  const canManageServiceAccounts = can(Capability.SERVICE_ACCOUNTS_MANAGE)
 
   // 是否可以查看审计日志
-  const canViewAudit = computed(() => authStore.isAdmin)
+  const canViewAudit = can(Capability.AUDIT_READ)
 
   // 是否可以管理权限
-  const canManagePermissions = computed(() => authStore.isAdmin)
+  const canManagePermissions = can(Capability.PERMISSIONS_MANAGE)
 
-  // 检查是否有特定权限
-  const hasPermission = (permission: string): boolean => {
-    if (!authStore.isAuthenticated) {
-      return false
-    }
+  // 是否可以审批访问申请
+  const canReviewAccessRequests = can(Capability.ACCESS_REQUESTS_REVIEW)
 
-    // 管理员拥有所有权限
-    if (authStore.isAdmin) {
-      return true
-    }
+  // 是否可以管理访问策略
+  const canManagePolicies = can(Capability.POLICIES_MANAGE)
 
-    // 根据权限名称检查
-    switch (permission) {
-      case 'view:clusters':
-        return true // 所有认证用户都可以查看集群
-      case 'manage:clusters':
-        return authStore.isAdmin
-      case 'manage:users':
-        return authStore.isAdmin
-      case 'view:audit':
-        return authStore.isAdmin
-      case 'manage:permissions':
-        return authStore.isAdmin
-      default:
-        return false
+  // 是否可以紧急访问（break-glass）任意集群
+  const canBreakGlass = can(Capability.BREAK_GLASS)
+
+  // 检查是否有特定能力
+  const hasPermission = (permission: Capability): boolean => {
+    if (!authStore.isAuthenticated) {
+      return false
     }
+    return authStore.hasCapability(permission)
   }
 
   return {
-    canManageClusters,
+    canCreateClusters,
+    canDeleteClusters,
+    canImportKubeconfig,
     canManageUsers,
+    canManageRoles,
+    canManageGroups,
+    canManageServiceAccounts,
     canViewAudit,
     canManagePermissions,
+    canReviewAccessRequests,
+    canManagePolicies,
+    canBreakGlass,
     hasPermission
   }
 }
@@ -25,6 +25,12 @@ export function setupRouterGuards(router: Router) {
         return
       }
 
+      // 必须先修改密码，留在登录页完成
+      if (authStore.passwordChangeRequired) {
+        next({ name: 'Login' })
+        return
+      }
+
       // 检查是否需要管理员权限
       if (to.meta.requiresAdmin && !authStore.isAdmin) {
         // 非管理员，重定向到 Dashboard
@@ -34,7 +40,7 @@ export function setupRouterGuards(router: Router) {
     }
 
     // 如果已登录且访问登录页，重定向到 Dashboard
-    if (to.name === 'Login' && authStore.isAuthenticated) {
+    if (to.name === 'Login' && authStore.isAuthenticated && !authStore.passwordChangeRequired) {
       next({ name: 'Dashboard' })
       return
     }
@@ -11,6 +11,24 @@ const routes: RouteRecordRaw[] = [
       requiresAuth: false
     }
   },
+  {
+    path: '/oidc/callback',
+    name: 'OidcCallback',
+    component: () => import('@/views/OidcCallback.vue'),
+    meta: {
+      title: '登录 - KubeSwitch',
+      requiresAuth: false
+    }
+  },
+  {
+    path: '/device',
+    name: 'DeviceLogin',
+    component: () => import('@/views/DeviceLogin.vue'),
+    meta: {
+      title: '设备登录 - KubeSwitch',
+      requiresAuth: true
+    }
+  },
   {
     path: '/',
     name: 'Dashboard',
@@ -18,10 +18,11 @@ export const useAuditStore = defineStore('audit', () => {
   const getPagination = computed(() => pagination.value)
 
   // Actions
-  const fetchAuditLogs = async () => {
+  // severity 为 high 时只获取需要复核的事件
+  const fetchAuditLogs = async (severity?: string) => {
     loading.value = true
     try {
-      const data = await auditApi.getAuditLogs()
+      const data = await auditApi.getAuditLogs(severity ? { severity } : undefined)
       logs.value = data
       pagination.value.total = data.length
     } finally {
@@ -1,8 +1,8 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
 import { authApi } from '@/api'
-import { setToken, setRole, clearAuth } from '@/utils/token'
-import type { User, UserRole, LoginDto } from '@/types'
+import { setToken, setRefreshToken, setRole, clearAuth } from '@/utils/token'
+import type { User, UserRole, Capability, LoginDto, LoginResponse, MfaChallenge } from '@/types'
 
 export const useAuthStore = defineStore(
   'auth',
@@ -11,20 +11,50 @@ export const useAuthStore = defineStore(
     const token = ref<string | null>(null)
     const role = ref<UserRole | null>(null)
     const user = ref<User | null>(null)
+    // 角色拥有的能力，决定可以看到哪些管理功能
+    const capabilities = ref<Capability[]>([])
+    // 密码过期或被管理员重置后，必须先修改密码才能使用其他功能
+    const passwordChangeRequired = ref(false)
 
     // Getters
     const isAuthenticated = computed(() => !!token.value)
     const isAdmin = computed(() => role.value === 'admin')
     const currentUser = computed(() => user.value)
+    const hasCapability = (capability: Capability) => capabilities.value.includes(capability)
 
     // Actions
-    const login = async (credentials: LoginDto) => {
+    // 需要二次验证时返回 MFA 挑战，否则直接完成登录
+    const login = async (credentials: LoginDto): Promise<MfaChallenge | null> => {
       const response = await authApi.login(credentials)
+      if ('mfa_required' in response) {
+        return response
+      }
+      await setSession(response)
+      return null
+    }
+
+    const completeMfa = async (mfaToken: string, code: string): Promise<string[]> => {
+      const response = await authApi.loginMfa({ mfa_token: mfaToken, code })
+      await setSession(response)
+      return response.recovery_codes || []
+    }
+
+    // 部署在认证代理之后时，直接使用代理传递的身份登录
+    const loginWithProxy = async () => {
+      const response = await authApi.loginProxy()
+      await setSession(response)
+    }
+
+    // 保存登录结果（密码登录和 SSO 回调共用）
+    const setSession = async (response: LoginResponse) => {
       token.value = response.token
       role.value = response.role
-      
+      capabilities.value = response.capabilities || []
+      passwordChangeRequired.value = !!response.password_change_required
+
       // 存储到 localStorage
       setToken(response.token)
+      setRefreshToken(response.refresh_token)
       setRole(response.role)
 
       // 获取用户详细信息
@@ -44,7 +74,9 @@ export const useAuthStore = defineStore(
         // 清除状态
         token.value = null
         role.value = null
+        capabilities.value = []
         user.value = null
+        passwordChangeRequired.value = false
         clearAuth()
       }
     }
@@ -53,16 +85,24 @@ export const useAuthStore = defineStore(
       try {
         const userData = await authApi.getCurrentUser()
         user.value = userData
+        // 角色的能力可能已被修改
+        role.value = userData.role
+        capabilities.value = userData.capabilities || []
       } catch (error) {
         console.error('Failed to refresh user:', error)
       }
     }
 
     const updatePassword = async (oldPassword: string, newPassword: string) => {
-      await authApi.updateMyPassword({
+      const response = await authApi.updateMyPassword({
         old_password: oldPassword,
         new_password: newPassword
       })
+      if (response.token) {
+        token.value = response.token
+        setToken(response.token)
+      }
+      passwordChangeRequired.value = false
     }
 
     return {
@@ -70,12 +110,18 @@ export const useAuthStore = defineStore(
       token,
       role,
       user,
+      capabilities,
+      passwordChangeRequired,
       // Getters
       isAuthenticated,
       isAdmin,
       currentUser,
+      hasCapability,
       // Actions
       login,
+      completeMfa,
+      loginWithProxy,
+      setSession,
       logout,
       refreshUser,
       updatePassword
@@ -1,7 +1,7 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
 import { clustersApi } from '@/api'
-import type { Cluster, CreateClusterDto, ImportKubeconfigDto } from '@/types'
+import type { AccessLevel, Cluster, CreateClusterDto, ImportKubeconfigDto, GrantSelection } from '@/types'
 
 export const useClusterStore = defineStore('cluster', () => {
   // State
@@ -16,10 +16,11 @@ export const useClusterStore = defineStore('cluster', () => {
   })
 
   // Actions
-  const fetchClusters = async () => {
+  // selector 为标签选择器，例如 env=prod，为空时获取全部集群
+  const fetchClusters = async (selector?: string) => {
     loading.value = true
     try {
-      clusters.value = await clustersApi.getClusters()
+      clusters.value = await clustersApi.getClusters(selector)
     } finally {
       loading.value = false
     }
@@ -31,6 +32,11 @@ export const useClusterStore = defineStore('cluster', () => {
     return newCluster
   }
 
+  const setClusterLabels = async (id: number, labels: Record<string, string>) => {
+    const updated = await clustersApi.setLabels(id, labels)
+    clusters.value = clusters.value.map(c => (c.id === id ? { ...c, labels: updated.labels } : c))
+  }
+
   const deleteCluster = async (id: number) => {
     await clustersApi.deleteCluster(id)
     clusters.value = clusters.value.filter(c => c.id !== id)
@@ -44,12 +50,27 @@ export const useClusterStore = defineStore('cluster', () => {
     await clustersApi.importKubeconfig(id, data)
   }
 
-  const fetchClusterPermissions = async (id: number): Promise<number[]> => {
-    return await clustersApi.getClusterPermissions(id)
+  const deleteKubeconfig = async (id: number, level: AccessLevel) => {
+    await clustersApi.deleteKubeconfig(id, level)
+  }
+
+  const fetchClusterPermissions = async (id: number): Promise<GrantSelection[]> => {
+    const grants = await clustersApi.getClusterGrants(id)
+    return grants.map(g => ({
+      id: g.user_id,
+      level: g.level,
+      not_before: g.not_before,
+      expires_at: g.expires_at,
+      break_glass: g.break_glass
+    }))
   }
 
-  const updateClusterPermissions = async (id: number, userIds: number[]) => {
-    await clustersApi.updateClusterPermissions(id, { user_ids: userIds })
+  const updateClusterPermissions = async (id: number, grants: GrantSelection[]) => {
+    await clustersApi.updateClusterPermissions(id, {
+      grants: grants
+        .filter(g => !g.break_glass)
+        .map(g => ({ user_id: g.id, level: g.level, not_before: g.not_before, expires_at: g.expires_at }))
+    })
   }
 
   const setSelectedCluster = (cluster: Cluster | null) => {
@@ -67,9 +88,11 @@ export const useClusterStore = defineStore('cluster', () => {
     // Actions
     fetchClusters,
     createCluster,
+    setClusterLabels,
     deleteCluster,
     getKubeconfig,
     importKubeconfig,
+    deleteKubeconfig,
     fetchClusterPermissions,
     updateClusterPermissions,
     setSelectedCluster
@@ -1,7 +1,7 @@
 import { defineStore } from 'pinia'
 import { ref, computed } from 'vue'
 import { usersApi } from '@/api'
-import type { User, CreateUserDto, UserRole } from '@/types'
+import type { User, CreateUserDto, UserRole, GrantSelection } from '@/types'
 
 export const useUserStore = defineStore('user', () => {
   // State
@@ -48,12 +48,23 @@ export const useUserStore = defineStore('user', () => {
     }
   }
 
-  const fetchUserPermissions = async (id: number): Promise<number[]> => {
-    return await usersApi.getUserPermissions(id)
+  const fetchUserPermissions = async (id: number): Promise<GrantSelection[]> => {
+    const grants = await usersApi.getUserGrants(id)
+    return grants.map(g => ({
+      id: g.cluster_id,
+      level: g.level,
+      not_before: g.not_before,
+      expires_at: g.expires_at,
+      break_glass: g.break_glass
+    }))
   }
 
-  const updateUserPermissions = async (id: number, clusterIds: number[]) => {
-    await usersApi.updateUserPermissions(id, { cluster_ids: clusterIds })
+  const updateUserPermissions = async (id: number, grants: GrantSelection[]) => {
+    await usersApi.updateUserPermissions(id, {
+      grants: grants
+        .filter(g => !g.break_glass)
+        .map(g => ({ cluster_id: g.id, level: g.level, not_before: g.not_before, expires_at: g.expires_at }))
+    })
   }
 
   return {
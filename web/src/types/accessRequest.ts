@@ -0,0 +1,28 @@
+import type { AccessLevel } from './cluster'
+
+export type AccessRequestStatus = 'pending' | 'approved' | 'denied' | 'cancelled'
+
+// 临时访问申请，批准后生成带有效期的集群权限
+export interface AccessRequest {
+  id: number
+  user_id: number
+  cluster_id: number
+  level: AccessLevel
+  reason: string
+  duration_minutes: number
+  status: AccessRequestStatus
+  reviewer_id?: number
+  review_note?: string
+  reviewed_at?: string
+  created_at: string
+  user: { username: string }
+  cluster: { name: string }
+  reviewer?: { username: string }
+}
+
+export interface CreateAccessRequestDto {
+  cluster: string
+  reason: string
+  duration: string
+  level?: AccessLevel
+}
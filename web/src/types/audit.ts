@@ -6,6 +6,10 @@ export interface AuditLog {
   }
   action: string
   detail: string
+  actor?: string
+  cluster_id?: number
+  // high 表示需要复核的事件，例如紧急访问
+  severity?: 'high'
   ip_address: string
   created_at: string
 }
@@ -1,4 +1,5 @@
 import type { User, UserRole } from './user'
+import type { Capability } from './role'
 
 export interface LoginDto {
   username: string
@@ -7,8 +8,51 @@ export interface LoginDto {
 
 export interface LoginResponse {
   token: string
+  refresh_token: string
+  expires_in: number
   role: UserRole
+  capabilities: Capability[]
   user?: User
+  recovery_codes?: string[]
+  password_change_required?: boolean
+}
+
+// 开启 MFA 的用户密码校验通过后返回的二次验证挑战
+export interface MfaChallenge {
+  mfa_required: true
+  mfa_enrolled: boolean
+  mfa_token: string
+}
+
+export interface MfaEnrollment {
+  secret: string
+  provisioning_uri: string
+}
+
+// 服务端密码策略
+export interface PasswordPolicy {
+  min_length: number
+  require_uppercase: boolean
+  require_lowercase: boolean
+  require_digit: boolean
+  require_symbol: boolean
+  history_size: number
+  max_age_days: number
+  deny_common: boolean
+}
+
+// 等待批准的 CLI 设备登录请求
+export interface DeviceCode {
+  user_code: string
+  client_ip: string
+  expires_at: string
+  created_at: string
+}
+
+export interface AuthConfig {
+  oidc: boolean
+  // 部署在认证代理（如 oauth2-proxy）之后
+  proxy: boolean
 }
 
 export interface AuthState {
@@ -1,7 +1,33 @@
+// 访问级别，从低到高；admin 对应集群本身的 kubeconfig
+export type AccessLevel = 'view' | 'edit' | 'admin'
+
+export const ACCESS_LEVELS: AccessLevel[] = ['view', 'edit', 'admin']
+
+// 从 kubeconfig 中提取的信息，server 和 auth_type 对应 current-context
+export interface KubeconfigInfo {
+  server: string
+  current_context: string
+  contexts: string[]
+  // token、client-certificate、exec、auth-provider、basic 或 none
+  auth_type: string
+}
+
 export interface Cluster {
   id: number
   name: string
   description?: string
+  // 标签，例如 env=prod，用于按标签选择器授权
+  labels?: Record<string, string> | null
+  // 只能从这些网段下载 kubeconfig，为空表示不限制
+  allowed_cidrs?: string[] | null
+  // 添加或导入时校验通过的 kubeconfig 信息，旧数据可能没有
+  kubeconfig_info?: KubeconfigInfo
+  // 已配置 kubeconfig 的访问级别
+  levels?: AccessLevel[]
+  // 当前用户被授予的访问级别
+  access_level?: AccessLevel
+  // 当前用户是否为集群负责人，负责人可以管理该集群的授权、kubeconfig 和审计日志
+  owned?: boolean
   created_at?: string
   updated_at?: string
 }
@@ -10,12 +36,36 @@ export interface CreateClusterDto {
   name: string
   description?: string
   kubeconfig: string
+  labels?: Record<string, string>
 }
 
 export interface KubeconfigResponse {
   kubeconfig: string
+  level: AccessLevel
 }
 
 export interface ImportKubeconfigDto {
   kubeconfig: string
+  // 不填时替换 admin 级别的 kubeconfig
+  level?: AccessLevel
+}
+
+// 集群负责人：用户或用户组
+export interface ClusterOwners {
+  user_ids: number[]
+  group_ids: number[]
+}
+
+// 紧急访问：填写原因后立即获得短期访问权限，会记录高危审计事件并发送通知
+export interface BreakGlassDto {
+  reason: string
+  // 默认 1h，最长 4h
+  duration?: string
+  level?: AccessLevel
+}
+
+export interface BreakGlassResponse {
+  cluster_id: number
+  level: AccessLevel
+  expires_at: string
 }
@@ -0,0 +1,35 @@
+import type { AccessLevel } from './cluster'
+
+// 用户组：组内成员共享组的集群权限
+export interface Group {
+  id: number
+  name: string
+  description: string
+  member_count: number
+  // 成员只能从这些网段访问，与成员自己的白名单同时生效
+  allowed_cidrs?: string[] | null
+  created_at: string
+  updated_at: string
+}
+
+export interface GroupDto {
+  name: string
+  description?: string
+}
+
+// 用户组的集群授权，not_before/expires_at 与用户授权含义相同
+export interface GroupGrant {
+  cluster_id: number
+  level?: AccessLevel
+  not_before?: string
+  expires_at?: string
+}
+
+export interface GroupPermissionsResponse {
+  cluster_ids: number[]
+  grants?: GroupGrant[]
+}
+
+export interface GroupMembersResponse {
+  user_ids: number[]
+}
@@ -4,3 +4,7 @@ export * from './permission'
 export * from './audit'
 export * from './auth'
 export * from './api'
+export * from './group'
+export * from './accessRequest'
+export * from './role'
+export * from './policy'
@@ -1,3 +1,5 @@
+import type { AccessLevel } from './cluster'
+
 export interface Permission {
   user_id: number
   cluster_id: number
@@ -6,18 +8,56 @@ export interface Permission {
   granted_at?: string
 }
 
+// 带有效期的授权，not_before/expires_at 为空表示立即生效/永久有效
+export interface PermissionGrant {
+  user_id: number
+  cluster_id: number
+  level?: AccessLevel
+  not_before?: string
+  expires_at?: string
+  // 紧急访问（break-glass）自行授予的权限
+  break_glass?: boolean
+}
+
+// 授权编辑器中的一项，id 为集群或用户 ID
+export interface GrantSelection {
+  id: number
+  level?: AccessLevel
+  not_before?: string
+  expires_at?: string
+  // 紧急访问授权只读展示，保存时不会提交，也不会被覆盖
+  break_glass?: boolean
+}
+
+// 按标签选择器授权，例如 env!=prod,team=payments，之后新建的匹配集群自动生效
+export interface LabelGrant {
+  selector: string
+  level?: AccessLevel
+  // 有效期仅可通过 API 设置，Web UI 保存时原样保留
+  not_before?: string
+  expires_at?: string
+}
+
+export interface LabelPermissionsResponse {
+  grants: LabelGrant[]
+}
+
 export interface ClusterPermissionsResponse {
   user_ids: number[]
+  grants?: PermissionGrant[]
 }
 
 export interface UserPermissionsResponse {
   cluster_ids: number[]
+  grants?: PermissionGrant[]
 }
 
 export interface UpdateClusterPermissionsDto {
-  user_ids: number[]
+  user_ids?: number[]
+  grants?: Omit<PermissionGrant, 'cluster_id'>[]
 }
 
 export interface UpdateUserPermissionsDto {
-  cluster_ids: number[]
+  cluster_ids?: number[]
+  grants?: Omit<PermissionGrant, 'user_id'>[]
 }
@@ -0,0 +1,48 @@
+// 访问策略：CEL 表达式，条件为 true 时拒绝请求
+export type PolicyAction = 'kubeconfig' | 'admin' | '*'
+
+export interface Policy {
+  id: number
+  name: string
+  description: string
+  action: PolicyAction
+  condition: string
+  // 拒绝时返回给用户的提示
+  message: string
+  disabled: boolean
+  created_at: string
+  updated_at: string
+}
+
+export interface PolicyDto {
+  name: string
+  description?: string
+  action: PolicyAction
+  condition: string
+  message?: string
+  disabled?: boolean
+}
+
+// 试运行：描述一个假设的请求，condition 不为空时只评估该表达式
+export interface EvaluatePolicyDto {
+  user_id: number
+  cluster_id?: number
+  action: Exclude<PolicyAction, '*'>
+  level?: string
+  ip?: string
+  time?: string
+  condition?: string
+}
+
+export interface PolicyResult {
+  policy: Policy
+  denied: boolean
+  error?: string
+}
+
+export interface PolicyDecision {
+  allowed: boolean
+  denied_by?: Policy
+  message?: string
+  results: PolicyResult[]
+}
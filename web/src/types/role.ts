@@ -0,0 +1,39 @@
+// 角色能力，与服务端 utils/role.go 保持一致
+export const Capability = {
+  CLUSTERS_CREATE: 'clusters:create',
+  CLUSTERS_DELETE: 'clusters:delete',
+  CLUSTERS_LIST: 'clusters:list',
+  KUBECONFIG_READ: 'kubeconfig:read',
+  KUBECONFIG_IMPORT: 'kubeconfig:import',
+  PERMISSIONS_MANAGE: 'permissions:manage',
+  GROUPS_MANAGE: 'groups:manage',
+  USERS_MANAGE: 'users:manage',
+  ROLES_MANAGE: 'roles:manage',
+  SERVICE_ACCOUNTS_MANAGE: 'service-accounts:manage',
+  AUDIT_READ: 'audit:read',
+  SETTINGS_MANAGE: 'settings:manage',
+  ACCESS_REQUESTS_REVIEW: 'access-requests:review',
+  POLICIES_MANAGE: 'policies:manage',
+  BREAK_GLASS: 'clusters:break-glass'
+} as const
+
+export type Capability = typeof Capability[keyof typeof Capability]
+
+// 角色：一组命名的能力，内置角色 admin 和 user 不可修改
+export interface Role {
+  id: number
+  name: string
+  description: string
+  // 逗号分隔，"*" 表示全部能力
+  capabilities: string
+  built_in: boolean
+  user_count: number
+  created_at: string
+  updated_at: string
+}
+
+export interface RoleDto {
+  name: string
+  description?: string
+  capabilities: Capability[]
+}
@@ -1,18 +1,72 @@
+import type { Capability } from './role'
+
 export const UserRole = {
   ADMIN: 'admin',
   USER: 'user'
 } as const
 
-export type UserRole = typeof UserRole[keyof typeof UserRole]
+// 除内置角色外，管理员还可以自定义角色
+export type UserRole = string
 
 export interface User {
   id: number
   username: string
   role: UserRole
+  // 当前用户角色拥有的能力，仅 /my/user 返回
+  capabilities?: Capability[]
+  auth_source?: string
+  owner_id?: number
+  // 负责的用户组，组内成员都可以管理该服务账号
+  owner_group_id?: number
+  description?: string
+  // 允许访问的来源网段，为空表示不限制
+  allowed_cidrs?: string[] | null
   created_at?: string
   updated_at?: string
 }
 
+// 负责人和负责用户组至少设置一个
+export interface ServiceAccountOwnersDto {
+  owner_id?: number
+  owner_group_id?: number
+}
+
+export interface CreateServiceAccountDto extends ServiceAccountOwnersDto {
+  name: string
+  description?: string
+}
+
+// API 令牌，明文只在创建时返回一次
+export interface ApiToken {
+  id: number
+  user_id: number
+  name: string
+  prefix: string
+  scopes: string
+  expires_at: string
+  last_used_at?: string
+  created_at: string
+}
+
+export interface CreateApiTokenDto {
+  name: string
+  scopes: string[]
+  expires_in_days?: number
+}
+
+// 登录会话（每次登录对应一个设备）
+export interface Session {
+  id: number
+  user_id: number
+  device: string
+  ip: string
+  user_agent: string
+  last_seen_at: string
+  expires_at: string
+  created_at: string
+  current: boolean
+}
+
 export interface CreateUserDto {
   username: string
   password: string
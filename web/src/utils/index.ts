@@ -1,3 +1,4 @@
 export * from './token'
 export * from './storage'
 export * from './validators'
+export * from './labels'
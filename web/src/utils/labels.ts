@@ -0,0 +1,24 @@
+/**
+ * 集群标签工具函数，标签在表单中以 "env=prod, team=payments" 的形式编辑
+ */
+
+export const formatLabels = (labels?: Record<string, string> | null): string => {
+  return Object.entries(labels || {})
+    .map(([key, value]) => `${key}=${value}`)
+    .join(', ')
+}
+
+/**
+ * 解析 "key=value" 列表，格式错误时返回 null；键和值的合法性由服务端校验
+ */
+export const parseLabels = (text: string): Record<string, string> | null => {
+  const labels: Record<string, string> = {}
+  for (const part of text.split(',')) {
+    const item = part.trim()
+    if (!item) continue
+    const index = item.indexOf('=')
+    if (index <= 0) return null
+    labels[item.slice(0, index).trim()] = item.slice(index + 1).trim()
+  }
+  return labels
+}
@@ -1,5 +1,6 @@
 const TOKEN_KEY = 'kubeswitch_token'
 const ROLE_KEY = 'kubeswitch_role'
+const REFRESH_TOKEN_KEY = 'kubeswitch_refresh_token'
 
 export const getToken = (): string | null => {
   return localStorage.getItem(TOKEN_KEY)
@@ -13,6 +14,18 @@ export const removeToken = (): void => {
   localStorage.removeItem(TOKEN_KEY)
 }
 
+export const getRefreshToken = (): string | null => {
+  return localStorage.getItem(REFRESH_TOKEN_KEY)
+}
+
+export const setRefreshToken = (token: string): void => {
+  localStorage.setItem(REFRESH_TOKEN_KEY, token)
+}
+
+export const removeRefreshToken = (): void => {
+  localStorage.removeItem(REFRESH_TOKEN_KEY)
+}
+
 export const getRole = (): string | null => {
   return localStorage.getItem(ROLE_KEY)
 }
@@ -27,5 +40,6 @@ export const removeRole = (): void => {
 
 export const clearAuth = (): void => {
   removeToken()
+  removeRefreshToken()
   removeRole()
 }
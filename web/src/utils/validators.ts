@@ -1,3 +1,5 @@
+import type { PasswordPolicy } from '@/types'
+
 /**
  * 表单验证工具函数
  */
@@ -15,11 +17,16 @@ export const validators = {
 
   /**
    * 验证密码
-   * 规则：至少6个字符
+   * 规则：由服务端密码策略决定，这里只检查长度和字符类型，
+   * 常见密码和历史密码由服务端校验
    */
-  password: (value: string): boolean => {
-    if (!value) return false
-    return value.length >= 6
+  password: (value: string, policy: PasswordPolicy): boolean => {
+    if (!value || value.length < policy.min_length) return false
+    if (policy.require_uppercase && !/[A-Z]/.test(value)) return false
+    if (policy.require_lowercase && !/[a-z]/.test(value)) return false
+    if (policy.require_digit && !/[0-9]/.test(value)) return false
+    if (policy.require_symbol && !/[^A-Za-z0-9]/.test(value)) return false
+    return true
   },
 
   /**
@@ -53,6 +60,19 @@ export const validators = {
   }
 }
 
+/**
+ * 将密码策略描述为提示文字
+ */
+export const describePasswordPolicy = (policy: PasswordPolicy): string => {
+  const parts = [`至少${policy.min_length}个字符`]
+  if (policy.require_uppercase) parts.push('包含大写字母')
+  if (policy.require_lowercase) parts.push('包含小写字母')
+  if (policy.require_digit) parts.push('包含数字')
+  if (policy.require_symbol) parts.push('包含符号')
+  if (policy.history_size > 0) parts.push(`不能与最近${policy.history_size}次密码相同`)
+  return parts.join('，')
+}
+
 /**
  * Ant Design Vue 表单验证规则生成器
  */
@@ -64,8 +84,7 @@ export const rules = {
   ],
 
   password: [
-    { required: true, message: '请输入密码' },
-    { min: 6, message: '密码至少6个字符' }
+    { required: true, message: '请输入密码' }
   ],
 
   clusterName: [